@@ -1,71 +1,66 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	"github.com/cnopslabs/oshiv/internal/resources"
 	"github.com/cnopslabs/oshiv/internal/utils"
-	"github.com/oracle/oci-go-sdk/v65/bastion"
-	"github.com/oracle/oci-go-sdk/v65/containerengine"
-	"github.com/oracle/oci-go-sdk/v65/identity"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var bastionCmd = &cobra.Command{
-	Use:     "bastion",
-	Short:   "Find, list, and connect to resources via the OCI bastion service",
-	Long:    "Find, list, and connect to resources via the OCI bastion service",
-	Aliases: []string{"bast"},
-	Run: func(cmd *cobra.Command, args []string) {
-		identityClient, identityErr := identity.NewIdentityClientWithConfigurationProvider(utils.OciConfig())
-		utils.CheckError(identityErr)
-
-		// Read tenancy ID flag and calculate tenancy
-		FlagTenancyId := rootCmd.Flags().Lookup("tenancy-id")
-		utils.SetTenancyConfig(FlagTenancyId, utils.OciConfig())
-		tenancyId := viper.GetString("tenancy-id")
-		tenancyName := viper.GetString("tenancy-name")
-
-		// Read compartment flag and add to Viper config
-		FlagCompartment := rootCmd.Flags().Lookup("compartment")
-		compartments := resources.FetchCompartments(tenancyId, identityClient)
-		utils.SetCompartmentConfig(FlagCompartment, compartments, tenancyName)
-		compartment := viper.GetString("compartment")
-
-		compartmentId := resources.LookupCompartmentId(compartments, tenancyId, tenancyName, compartment)
-
-		containerEngineClient, err := containerengine.NewContainerEngineClientWithConfigurationProvider(utils.OciConfig())
-		utils.CheckError(err)
-
-		bastionClient, err := bastion.NewBastionClientWithConfigurationProvider(utils.OciConfig())
-		utils.CheckError(err)
-
-		region, envVarExists := os.LookupEnv("OCI_CLI_REGION")
-		if envVarExists {
-			containerEngineClient.SetRegion(region)
-			bastionClient.SetRegion(region)
+	Use:         "bastion",
+	Short:       "Find, list, and connect to resources via the OCI bastion service",
+	Long:        "Find, list, and connect to resources via the OCI bastion service",
+	Aliases:     []string{"bast"},
+	Annotations: compartmentAnnotations,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ociCtx := getOciContext(cmd)
+
+		bastionClient, err := ociCtx.BastionClient()
+		if err != nil {
+			return err
 		}
 
-		bastions := resources.FetchBastions(compartmentId, bastionClient)
+		computeClient, err := ociCtx.ComputeClient()
+		if err != nil {
+			return err
+		}
+
+		vnetClient, err := ociCtx.VirtualNetworkClient()
+		if err != nil {
+			return err
+		}
 
 		flagList, _ := cmd.Flags().GetBool("list")
 
 		flagCreate, _ := cmd.Flags().GetBool("create")
 		flagSessionType, _ := cmd.Flags().GetString("type")
+		flagConnect, _ := cmd.Flags().GetBool("connect")
 
 		// Flags applicable to all session types
+		// Note: the current context's default bastion is only used if neither --bastion-name nor --bastion-id is set
+		flagBastionName := contextFlag(cmd, "bastion-name", "bastion")
 		flagBastionId, _ := cmd.Flags().GetString("bastion-id")
+		if flagBastionId != "" {
+			flagBastionName = flagBastionId
+		}
+		flagTarget, _ := cmd.Flags().GetString("target")
 		flagTargetIp, _ := cmd.Flags().GetString("target-ip")
 		flagTtl, _ := cmd.Flags().GetInt("ttl")
-		flagSshPrivateKey, _ := cmd.Flags().GetString("private-key")
-		flagSshPublicKey, _ := cmd.Flags().GetString("public-key")
+		flagNoReuse, _ := cmd.Flags().GetBool("no-reuse")
+		flagReuseMinTtl, _ := cmd.Flags().GetInt("reuse-min-ttl")
 
 		// Flags applicable to managed sessions
 		flagInstanceId, _ := cmd.Flags().GetString("instance-id")
-		flagSshUser, _ := cmd.Flags().GetString("user")
+		flagSshUser := contextFlag(cmd, "user", "ssh-user")
 
 		// Flags applicable to port forward sessions
 		flagOkeName, _ := cmd.Flags().GetString("oke-name")
@@ -79,80 +74,282 @@ var bastionCmd = &cobra.Command{
 		}
 
 		if flagList {
-			resources.ListBastions(bastions, tenancyName, compartment)
-			os.Exit(0)
+			bastions, err := resources.FetchBastions(ociCtx.CompartmentId, bastionClient)
+			if err != nil {
+				return err
+			}
+
+			return resources.ListBastions(bastionClient, bastions, ociCtx.TenancyName, ociCtx.Compartment)
 		} else if flagCreate {
-			// Check if there's only one bastion, if so use it (no input required)
-			var bastionId string
-			_, uniqueBastionId := resources.CheckForUniqueBastion(bastions)
-			if uniqueBastionId != "" {
-				bastionId = uniqueBastionId
-			} else {
-				if flagBastionId == "" {
-					fmt.Println("Multiple bastions found, must pass flag --bastion-id:")
-					fmt.Println("Bastions:")
-
-					for k, v := range bastions {
-						fmt.Println(" - " + k + ": " + v)
-					}
+			// Only one of target, IP, or instance ID is required, lookup the others
+			var targetSubnetId string
+			if flagOkeName == "" {
+				lookupTarget := flagTarget
+
+				if lookupTarget != "" && (flagTargetIp != "" || flagInstanceId != "") {
+					return utils.UsageError("pass only one of --target, --target-ip, or --instance-id")
+				} else if lookupTarget == "" && flagTargetIp != "" && flagInstanceId == "" && flagSessionType == "managed" {
+					lookupTarget = flagTargetIp
+				} else if lookupTarget == "" && flagInstanceId != "" && flagTargetIp == "" {
+					lookupTarget = flagInstanceId
+				}
 
-					os.Exit(1)
+				if lookupTarget != "" {
+					target, err := resolveTarget(computeClient, vnetClient, ociCtx.CompartmentId, lookupTarget)
+					if err != nil {
+						return err
+					}
+					flagTargetIp = target.Ip
+					flagInstanceId = target.Id
+					targetSubnetId = target.SubnetId
 				}
+			}
+
+			// Select bastion: by flag, the only one available, or the one that can reach the target
+			selectedBastion, err := selectBastion(bastionClient, ociCtx.CompartmentId, flagBastionName, func(bastions []resources.Bastion) ([]resources.Bastion, error) {
+				return resources.SelectBastionsForTarget(vnetClient, bastions, flagTargetIp, targetSubnetId)
+			})
+			if err != nil {
+				return err
+			}
+			bastionId := selectedBastion.Id
 
-				bastionId = flagBastionId
+			flagTtl, err = sessionTtl(bastionClient, selectedBastion, flagTtl)
+			if err != nil {
+				return err
 			}
 
-			// Get SSH public key
-			publicKeyContent, err := os.ReadFile(flagSshPublicKey)
-			utils.CheckError(err)
+			sshKey, err := sessionSshKey(cmd)
+			if err != nil {
+				return err
+			}
+			defer sshKey.Destroy()
 
 			// Create the bastion session
-			utils.FaintMagenta.Println("Tenancy(Compartment): " + tenancyName + "(" + compartment + ")")
+			ociCtx.printTenancyCompartment()
 
-			var sessionId *string
+			sessionHostFwPort := flagHostFwPort
 			if flagOkeName != "" {
-				sessionId = resources.CreateBastionSession(bastionClient, bastionId, flagSessionType, string(publicKeyContent), flagTargetIp, 22, 6443, flagTtl, flagInstanceId, flagSshUser)
-			} else {
-				sessionId = resources.CreateBastionSession(bastionClient, bastionId, flagSessionType, string(publicKeyContent), flagTargetIp, 22, flagHostFwPort, flagTtl, flagInstanceId, flagSshUser)
+				sessionHostFwPort = 6443
+			}
+
+			// Reuse an existing session for the same target and key if possible, creating a session takes a minute or more
+			// Ephemeral keys are never shared between sessions
+			var sessionId *string
+			if !flagNoReuse && !sshKey.Ephemeral {
+				sessionId, err = resources.FindReusableSession(bastionClient, bastionId, flagSessionType, sshKey.PublicKey, flagTargetIp, 22, sessionHostFwPort, flagSshUser, flagReuseMinTtl)
+				if err != nil {
+					return err
+				}
 			}
 
-			session := resources.FetchSession(bastionClient, sessionId, flagSessionType)
+			if sessionId == nil {
+				sessionId, err = resources.CreateBastionSession(cmd.Context(), bastionClient, bastionId, flagSessionType, sshKey.PublicKey, flagTargetIp, 22, sessionHostFwPort, flagTtl, flagInstanceId, flagSshUser)
+				if err != nil {
+					return err
+				}
+			}
 
 			// Wait until session is active
-			for session.State != "ACTIVE" {
-				if session.State == "DELETED" {
-					fmt.Println("\nSession has been deleted, exiting")
-					fmt.Println("State: " + session.State)
-					fmt.Println("\nSession Info")
-					fmt.Println(session)
-					os.Exit(1)
-				} else {
-					fmt.Println("Session not yet active, waiting... (State: " + session.State + ")")
-					time.Sleep(10 * time.Second)
-					session = resources.FetchSession(bastionClient, sessionId, flagSessionType)
+			err = resources.WaitForActiveSession(cmd.Context(), bastionClient, sessionId)
+			if err != nil {
+				return err
+			}
+
+			// Ephemeral keys only exist in memory, unless external ssh/scp commands need an identity file
+			if sshKey.Ephemeral && !flagConnect {
+				_, err = sshKey.WriteToTempDir()
+				if err != nil {
+					return err
 				}
 			}
 
 			// Flex print commands between port forward and managed type
 			if flagSessionType == "port-forward" {
+				var flagOkeId string
 				if flagOkeName != "" {
 					// If creating bastion session to an OKE cluster, lookup cluster ID and set ports to 6443
-					flagOkeId := resources.FetchClusterId(containerEngineClient, compartmentId, flagOkeName)
-					fmt.Println("flagOkeId")
-					resources.PrintPortFwSshCommands(bastionClient, sessionId, flagTargetIp, 22, flagSshPrivateKey, 6443, 6443, flagOkeId)
-				} else {
-					resources.PrintPortFwSshCommands(bastionClient, sessionId, flagTargetIp, 22, flagSshPrivateKey, flagLocalFwPort, flagHostFwPort, "")
+					containerEngineClient, err := ociCtx.ContainerEngineClient()
+					if err != nil {
+						return err
+					}
+
+					flagOkeId, err = resources.FetchClusterId(containerEngineClient, ociCtx.CompartmentId, flagOkeName)
+					if err != nil {
+						return err
+					}
+					flagLocalFwPort, flagHostFwPort = 6443, 6443
+				}
+
+				if flagConnect {
+					if flagOkeId != "" {
+						resources.PrintOkeKubeconfigCommand(flagOkeId)
+					}
+
+					return resources.ForwardPort(bastionClient, sessionId, flagTargetIp, flagLocalFwPort, flagHostFwPort, sshKey)
 				}
+
+				err = resources.PrintPortFwSshCommands(bastionClient, sessionId, flagTargetIp, 22, sshKey.PrivateKeyPath, flagLocalFwPort, flagHostFwPort, flagOkeId)
 			} else if flagSessionType == "managed" {
-				resources.PrintManagedSshCommands(bastionClient, sessionId, flagTargetIp, flagSshUser, 22, flagSshPrivateKey, flagLocalFwPort, flagHostFwPort)
+				if flagConnect {
+					exitStatus, err := resources.ConnectManagedSsh(bastionClient, sessionId, flagTargetIp, flagSshUser, 22, sshKey)
+					if err != nil {
+						return err
+					}
+
+					// Exit with the remote shell's status (after the deferred ephemeral key cleanup)
+					if exitStatus != 0 {
+						return utils.ExitStatus(exitStatus)
+					}
+					return nil
+				}
+
+				err = resources.PrintManagedSshCommands(bastionClient, sessionId, flagTargetIp, flagSshUser, 22, sshKey.PrivateKeyPath, flagLocalFwPort, flagHostFwPort)
+			}
+			if err != nil {
+				return err
+			}
+
+			// The printed commands need the ephemeral identity file, keep it until the session expires
+			if sshKey.Ephemeral {
+				waitForSessionExpiry(sshKey, flagTtl)
 			}
 		}
+
+		return nil
 	},
 }
 
-func init() {
-	rootCmd.AddCommand(bastionCmd)
+// Select the bastion to use by name or OCID, otherwise the only bastion in the compartment
+// With several bastions, reachesTarget (if not nil) returns the ones able to reach the session target, a single match is used
+// If several bastions reach the target only those are listed, otherwise every bastion in the compartment
+func selectBastion(bastionClient resources.BastionClient, compartmentId string, bastionName string, reachesTarget func(bastions []resources.Bastion) ([]resources.Bastion, error)) (resources.Bastion, error) {
+	bastions, err := resources.FetchBastions(compartmentId, bastionClient)
+	if err != nil {
+		return resources.Bastion{}, err
+	}
+
+	if bastionName != "" {
+		b, found := resources.LookupBastion(bastions, bastionName)
+		if !found {
+			printBastionNames(bastions)
+			return resources.Bastion{}, utils.UsageError("bastion " + bastionName + " not found")
+		}
+		return b, nil
+	}
+
+	if b, unique := resources.CheckForUniqueBastion(bastions); unique {
+		return b, nil
+	}
 
+	if reachesTarget != nil {
+		matches, err := reachesTarget(bastions)
+		if err != nil {
+			return resources.Bastion{}, err
+		}
+
+		if len(matches) == 1 {
+			utils.Faint.Println("Using bastion " + matches[0].Name + " (reaches target network)")
+			return matches[0], nil
+		}
+
+		if len(matches) > 1 {
+			printBastionNames(matches)
+			return resources.Bastion{}, utils.UsageError("several bastions reach the target, must pass flag --bastion-name or --bastion-id")
+		}
+	}
+
+	printBastionNames(bastions)
+	return resources.Bastion{}, utils.UsageError("unable to determine which bastion to use, must pass flag --bastion-name")
+}
+
+// Limit a session TTL to the bastion's max session TTL, sessions can not outlive it
+func sessionTtl(bastionClient resources.BastionClient, b resources.Bastion, ttl int) (int, error) {
+	b, err := resources.FetchBastionDetails(bastionClient, b)
+	if err != nil {
+		return 0, err
+	}
+
+	if b.MaxSessionTtl > 0 && ttl > b.MaxSessionTtl {
+		utils.Faint.Println("TTL " + strconv.Itoa(ttl) + " exceeds bastion max session TTL, using " + strconv.Itoa(b.MaxSessionTtl))
+		return b.MaxSessionTtl, nil
+	}
+
+	return ttl, nil
+}
+
+// Get the session's SSH key pair, generated for this session only (--ephemeral-key) or read from --private-key and --public-key
+func sessionSshKey(cmd *cobra.Command) (*resources.SshKeyPair, error) {
+	flagSshPrivateKey, _ := cmd.Flags().GetString("private-key")
+	flagSshPublicKey, _ := cmd.Flags().GetString("public-key")
+	flagEphemeralKey, _ := cmd.Flags().GetBool("ephemeral-key")
+	flagEphemeralKeyType, _ := cmd.Flags().GetString("ephemeral-key-type")
+
+	if flagEphemeralKey {
+		return resources.GenerateEphemeralSshKeyPair(flagEphemeralKeyType)
+	}
+
+	return resources.LoadSshKeyPair(flagSshPrivateKey, flagSshPublicKey)
+}
+
+// Print available bastions when one can not be selected automatically
+func printBastionNames(bastions []resources.Bastion) {
+	fmt.Println("Bastions:")
+
+	for _, b := range bastions {
+		fmt.Println(" - " + b.Name + ": " + b.Id)
+	}
+}
+
+// Resolve a bastion target to exactly one instance, return an error after listing the candidates if it is ambiguous
+func resolveTarget(computeClient resources.ComputeClient, vnetClient resources.VirtualNetworkClient, compartmentId string, target string) (resources.InstanceTarget, error) {
+	candidates, err := resources.ResolveInstanceTarget(computeClient, vnetClient, compartmentId, target)
+	if err != nil {
+		return resources.InstanceTarget{}, err
+	}
+
+	if len(candidates) == 0 {
+		return resources.InstanceTarget{}, errors.New("no instance found matching " + target)
+	} else if len(candidates) > 1 {
+		fmt.Println("Multiple instances match " + target + ":")
+
+		for _, candidate := range candidates {
+			fmt.Print(" - " + candidate.Name + " ")
+			utils.Yellow.Println(candidate.Id + " " + candidate.Ip + " (" + candidate.Hostname + ")")
+		}
+
+		return resources.InstanceTarget{}, utils.UsageError("multiple instances match " + target + ", pass an instance ID or IP instead")
+	}
+
+	resolved := candidates[0]
+	utils.Faint.Println("Target: " + resolved.Name + " " + resolved.Ip + " (" + resolved.Id + ")")
+
+	return resolved, nil
+}
+
+// Block until the bastion session TTL elapses or the user interrupts, then delete the ephemeral key
+func waitForSessionExpiry(sshKey *resources.SshKeyPair, sessionTtl int) {
+	expiry := time.Now().Add(time.Duration(sessionTtl) * time.Second)
+
+	fmt.Print("\nEphemeral identity file: ")
+	utils.Yellow.Println(sshKey.PrivateKeyPath)
+	fmt.Println("It will be deleted when the session expires (" + expiry.Format(time.Kitchen) + ") or on Ctrl-C")
+
+	// SIGHUP is sent when the terminal is closed
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Until(expiry)):
+	}
+
+	sshKey.Destroy()
+	fmt.Println("\nEphemeral key deleted")
+}
+
+// Default SSH key pair paths, $HOME/.ssh/id_rsa(.pub) unless OSHIV_SSH_HOME is set
+func defaultSshKeyPaths() (string, string) {
 	homeDir := utils.HomeDir()
 	// If OSHIV_SSH_HOME is set, we'll use this location for the SSH keys
 	sshKeyHomeEnv := os.Getenv("OSHIV_SSH_HOME")
@@ -166,20 +363,33 @@ func init() {
 		sshKeyHome = sshKeyHomeEnv
 	}
 
-	defaultPrivateKeyPath := sshKeyHome + "/id_rsa"
-	defaultPublicKeyPath := sshKeyHome + "/id_rsa.pub"
+	return sshKeyHome + "/id_rsa", sshKeyHome + "/id_rsa.pub"
+}
+
+func init() {
+	rootCmd.AddCommand(bastionCmd)
+
+	defaultPrivateKeyPath, defaultPublicKeyPath := defaultSshKeyPaths()
 
 	bastionCmd.Flags().BoolP("list", "l", false, "List all bastions")
 
 	bastionCmd.Flags().BoolP("create", "r", true, "Create bastion session")
 	bastionCmd.Flags().StringP("type", "y", "managed", "The type of bastion session to create (managed/port-forward)")
+	bastionCmd.Flags().BoolP("connect", "x", false, "Connect via the built-in SSH client (managed: interactive shell, port-forward: local port forwarder)")
 
 	// Flags applicable to all session types
-	bastionCmd.Flags().StringP("bastion-id", "b", "", "ID of the bastion to use")    // TODO: Switch to bastion name
-	bastionCmd.Flags().StringP("target-ip", "i", "", "IP of the host to connect to") // TODO: Only require one of: (hostname, IP, or instance ID). The lookup the others
+	bastionCmd.Flags().StringP("bastion-name", "b", "", "Name of the bastion to use (discovered from the target when omitted)")
+	bastionCmd.Flags().String("bastion-id", "", "ID of the bastion to use")
+	bastionCmd.MarkFlagsMutuallyExclusive("bastion-name", "bastion-id")
+	bastionCmd.Flags().StringP("target", "n", "", "Instance name, OCID, private IP, or hostname to connect to (the others are looked up)")
+	bastionCmd.Flags().StringP("target-ip", "i", "", "IP of the host to connect to")
 	bastionCmd.Flags().IntP("ttl", "m", 10800, "Bastion session TTL")
+	bastionCmd.Flags().Bool("no-reuse", false, "Always create a new session instead of reusing an active session for the same target")
+	bastionCmd.Flags().Int("reuse-min-ttl", 900, "Minimum seconds remaining for an active session to be reused")
 	bastionCmd.Flags().StringP("private-key", "a", defaultPrivateKeyPath, "Path to SSH private key (identity file)")
 	bastionCmd.Flags().StringP("public-key", "e", defaultPublicKeyPath, "Path to SSH public key")
+	bastionCmd.Flags().Bool("ephemeral-key", false, "Generate a single use SSH key pair for this session instead of using --private-key/--public-key")
+	bastionCmd.Flags().String("ephemeral-key-type", "ed25519", "Type of ephemeral SSH key to generate (ed25519/rsa)")
 
 	// Flags applicable to managed sessions
 	bastionCmd.Flags().StringP("instance-id", "o", "", "The OCID of the instance to connect to")
@@ -0,0 +1,358 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/cnopslabs/oshiv/internal/resources"
+	"github.com/cnopslabs/oshiv/internal/utils"
+	"github.com/oracle/oci-go-sdk/v65/bastion"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/containerengine"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/database"
+	"github.com/oracle/oci-go-sdk/v65/identity"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Command annotation selecting what the root PersistentPreRunE resolves before the command runs
+// Commands without it (info, version, help, completion) don't touch OCI at all
+const bootstrapAnnotation = "oshiv/bootstrap"
+
+const (
+	bootstrapTenancy     = "tenancy"     // Tenancy and region
+	bootstrapCompartment = "compartment" // Tenancy, region, and compartment
+)
+
+// Command annotation allowing stale cached responses, refreshed in the background by running the command again (see utils.Cached)
+// Only for commands that don't change anything or connect to anything (list and find commands)
+const backgroundRefreshAnnotation = "oshiv/background-refresh"
+
+// Annotations for commands that list or connect to resources in a compartment
+var compartmentAnnotations = map[string]string{bootstrapAnnotation: bootstrapCompartment}
+
+// Annotations for commands that only list or find resources in a compartment
+var listAnnotations = map[string]string{bootstrapAnnotation: bootstrapCompartment, backgroundRefreshAnnotation: "true"}
+
+type ociContextKey struct{}
+
+// Endpoint all OCI requests are sent to, only set by the end to end tests to use the local OCI API emulator (see cmd_test.go)
+var endpointOverride string
+
+// Tenancy, compartment, region, and OCI clients shared by all subcommands
+// Resolved once by the root PersistentPreRunE, clients are created on first use with the region applied
+// Copies for other compartments share the clients, copies for other regions have their own (see withCompartment and withRegion)
+type ociContext struct {
+	ConfigProvider  common.ConfigurationProvider
+	Region          string // Empty to use the region from the OCI config file
+	Endpoint        string // Endpoint all requests are sent to (see endpointOverride), empty to use the regional service endpoints
+	TenancyId       string
+	TenancyName     string
+	Compartment     string                  // Compartment name, the tenancy name for the root compartment
+	CompartmentId   string                  // Only set for commands annotated with bootstrapCompartment
+	CompartmentPath string                  // E.g. prod/network, only set for commands annotated with bootstrapCompartment
+	Compartments    []resources.Compartment // All compartments of the tenancy, only set for commands annotated with bootstrapCompartment
+
+	clients *ociClients
+}
+
+// OCI clients of a region, created on first use by concurrent fetches (E.g. --recursive)
+type ociClients struct {
+	mu                    sync.Mutex
+	identityClient        *identity.IdentityClient
+	computeClient         *core.ComputeClient
+	vnetClient            *core.VirtualNetworkClient
+	containerEngineClient *containerengine.ContainerEngineClient
+	databaseClient        *database.DatabaseClient
+	bastionClient         *bastion.BastionClient
+}
+
+// Resolve the OCI context for a command (root PersistentPreRunE) and attach it to the command's context
+func bootstrap(cmd *cobra.Command, args []string) error {
+	// Conflicting flags (E.g. --bastion-name and --bastion-id) are usage errors, cobra only checks them after this hook
+	err := cmd.ValidateFlagGroups()
+	if err != nil {
+		return utils.UsageError(err.Error() + "\nSee '" + cmd.CommandPath() + " --help'")
+	}
+
+	level, found := cmd.Annotations[bootstrapAnnotation]
+	if !found {
+		return nil
+	}
+
+	if cmd.Annotations[backgroundRefreshAnnotation] == "true" {
+		utils.EnableBackgroundRefresh()
+	}
+
+	// The current context (oshiv context) provides values not set by flag or environment variable
+	err = utils.UseCurrentContext()
+	if err != nil {
+		return err
+	}
+
+	configProvider, err := utils.OciConfig()
+	if err != nil {
+		return err
+	}
+
+	ociCtx := &ociContext{ConfigProvider: configProvider, clients: &ociClients{}}
+
+	// Region from --region or OCI_CLI_REGION, empty to use the OCI config file region
+	ociCtx.Region = viper.GetString("region")
+	ociCtx.Endpoint = endpointOverride
+
+	// Note: the persistent flags are read from cmd.Root(), referencing rootCmd here would be an initialization cycle
+	flags := cmd.Root().PersistentFlags()
+
+	err = ociCtx.resolveTenancy(flags)
+	if err != nil {
+		return err
+	}
+
+	if level == bootstrapCompartment {
+		err = ociCtx.resolveCompartment(flags)
+		if err != nil {
+			return err
+		}
+	}
+
+	cmd.SetContext(context.WithValue(cmd.Context(), ociContextKey{}, ociCtx))
+	return nil
+}
+
+// Return the OCI context resolved for the command by bootstrap
+func getOciContext(cmd *cobra.Command) *ociContext {
+	ociCtx, ok := cmd.Context().Value(ociContextKey{}).(*ociContext)
+	if !ok {
+		// Programming error, the command is missing its bootstrap annotation
+		panic("no OCI context for command " + cmd.CommandPath())
+	}
+
+	return ociCtx
+}
+
+// Determine tenancy ID (1)Set, 2)flag, 3)ENV, 6)OCI config file) and validate it (OCI API call)
+func (ociCtx *ociContext) resolveTenancy(flags *pflag.FlagSet) error {
+	// Get tenancy ID from OCI config file and set as the default (lowest precedence order) in viper config
+	ociConfigTenancyId, err := ociCtx.ConfigProvider.TenancyOCID()
+	if err != nil {
+		return err
+	}
+	viper.SetDefault("tenancy-id", ociConfigTenancyId)
+
+	// Attempt to add tenancy ID to Viper config from environment variable (3rd lowest precedence order)
+	// Note: OCI_CLI_TENANCY env var follows OCI CLI convention for Tenancy ID
+	_, envVarExists := os.LookupEnv("OCI_CLI_TENANCY")
+	if envVarExists {
+		viper.BindEnv("tenancy-id", "OCI_CLI_TENANCY")
+	} else if !flags.Changed("tenancy-id") {
+		// Since OCI_CLI_TENANCY (ID) is not set by env var, see if OCI_TENANCY_NAME is
+		// OCI_TENANCY_NAME does not follow OCI CLI convention but is nicer for humans
+		tenancyFromEnv, envVarExists := os.LookupEnv("OCI_TENANCY_NAME")
+
+		if envVarExists {
+			// Since OCI_TENANCY_NAME is set, let's use it to lookup and set Tenancy ID
+			tenancyId, err := utils.LookUpTenancyID(tenancyFromEnv)
+			if err != nil {
+				return err
+			}
+
+			// Override tenancy ID
+			viper.Set("tenancy-id", tenancyId)
+		}
+	}
+
+	identityClient, err := ociCtx.IdentityClient()
+	if err != nil {
+		return err
+	}
+
+	err = utils.SetTenancyConfig(flags.Lookup("tenancy-id"), *identityClient)
+	if err != nil {
+		return err
+	}
+
+	ociCtx.TenancyId = viper.GetString("tenancy-id")
+	ociCtx.TenancyName = viper.GetString("tenancy-name")
+
+	return nil
+}
+
+// Determine compartment name or path (2)flag, 3)ENV) and lookup its ID, the root compartment is used if it isn't in the tenancy (OCI API call)
+// A compartment passed with -c that isn't in the tenancy is an error
+func (ociCtx *ociContext) resolveCompartment(flags *pflag.FlagSet) error {
+	identityClient, err := ociCtx.IdentityClient()
+	if err != nil {
+		return err
+	}
+
+	compartments, err := resources.FetchCompartments(ociCtx.TenancyId, identityClient)
+	if err != nil {
+		return err
+	}
+
+	// Attempt to add compartment to Viper config from environment variable (3rd lowest precedence order)
+	viper.BindEnv("compartment", "OCI_COMPARTMENT")
+	err = utils.SetCompartmentConfig(flags.Lookup("compartment"), func(compartment string) bool {
+		return compartment == ociCtx.TenancyName || resources.CompartmentExists(compartments, compartment)
+	}, ociCtx.TenancyName)
+	if err != nil {
+		return err
+	}
+
+	ociCtx.Compartments = compartments
+	ociCtx.Compartment = viper.GetString("compartment")
+
+	// Note: compartment names shared by nested compartments are an error, the compartment path must be used
+	ociCtx.CompartmentId, err = resources.LookupCompartmentId(compartments, ociCtx.TenancyId, ociCtx.TenancyName, ociCtx.Compartment)
+	if err != nil {
+		return err
+	}
+	ociCtx.CompartmentPath = resources.LookupCompartmentPath(compartments, ociCtx.TenancyId, ociCtx.TenancyName, ociCtx.CompartmentId)
+
+	return nil
+}
+
+// Configure a new client: send its requests through the shared request pool, and to the endpoint override if set
+func (ociCtx *ociContext) configureClient(client *common.BaseClient) {
+	if ociCtx.Endpoint != "" {
+		client.Host = ociCtx.Endpoint
+	}
+
+	utils.UseRequestPool(client)
+}
+
+// Identity client, created on first use
+func (ociCtx *ociContext) IdentityClient() (*identity.IdentityClient, error) {
+	ociCtx.clients.mu.Lock()
+	defer ociCtx.clients.mu.Unlock()
+
+	if ociCtx.clients.identityClient == nil {
+		client, err := identity.NewIdentityClientWithConfigurationProvider(ociCtx.ConfigProvider)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create identity client: %w", err)
+		}
+
+		if ociCtx.Region != "" {
+			client.SetRegion(ociCtx.Region)
+		}
+		ociCtx.configureClient(&client.BaseClient)
+		ociCtx.clients.identityClient = &client
+	}
+
+	return ociCtx.clients.identityClient, nil
+}
+
+// Compute client, created on first use
+func (ociCtx *ociContext) ComputeClient() (*core.ComputeClient, error) {
+	ociCtx.clients.mu.Lock()
+	defer ociCtx.clients.mu.Unlock()
+
+	if ociCtx.clients.computeClient == nil {
+		client, err := core.NewComputeClientWithConfigurationProvider(ociCtx.ConfigProvider)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create compute client: %w", err)
+		}
+
+		if ociCtx.Region != "" {
+			client.SetRegion(ociCtx.Region)
+		}
+		ociCtx.configureClient(&client.BaseClient)
+		ociCtx.clients.computeClient = &client
+	}
+
+	return ociCtx.clients.computeClient, nil
+}
+
+// Virtual network client, created on first use
+func (ociCtx *ociContext) VirtualNetworkClient() (*core.VirtualNetworkClient, error) {
+	ociCtx.clients.mu.Lock()
+	defer ociCtx.clients.mu.Unlock()
+
+	if ociCtx.clients.vnetClient == nil {
+		client, err := core.NewVirtualNetworkClientWithConfigurationProvider(ociCtx.ConfigProvider)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create virtual network client: %w", err)
+		}
+
+		if ociCtx.Region != "" {
+			client.SetRegion(ociCtx.Region)
+		}
+		ociCtx.configureClient(&client.BaseClient)
+		ociCtx.clients.vnetClient = &client
+	}
+
+	return ociCtx.clients.vnetClient, nil
+}
+
+// Container engine (OKE) client, created on first use
+func (ociCtx *ociContext) ContainerEngineClient() (*containerengine.ContainerEngineClient, error) {
+	ociCtx.clients.mu.Lock()
+	defer ociCtx.clients.mu.Unlock()
+
+	if ociCtx.clients.containerEngineClient == nil {
+		client, err := containerengine.NewContainerEngineClientWithConfigurationProvider(ociCtx.ConfigProvider)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create container engine client: %w", err)
+		}
+
+		if ociCtx.Region != "" {
+			client.SetRegion(ociCtx.Region)
+		}
+		ociCtx.configureClient(&client.BaseClient)
+		ociCtx.clients.containerEngineClient = &client
+	}
+
+	return ociCtx.clients.containerEngineClient, nil
+}
+
+// Database client, created on first use
+func (ociCtx *ociContext) DatabaseClient() (*database.DatabaseClient, error) {
+	ociCtx.clients.mu.Lock()
+	defer ociCtx.clients.mu.Unlock()
+
+	if ociCtx.clients.databaseClient == nil {
+		client, err := database.NewDatabaseClientWithConfigurationProvider(ociCtx.ConfigProvider)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create database client: %w", err)
+		}
+
+		if ociCtx.Region != "" {
+			client.SetRegion(ociCtx.Region)
+		}
+		ociCtx.configureClient(&client.BaseClient)
+		ociCtx.clients.databaseClient = &client
+	}
+
+	return ociCtx.clients.databaseClient, nil
+}
+
+// Bastion client, created on first use
+func (ociCtx *ociContext) BastionClient() (*bastion.BastionClient, error) {
+	ociCtx.clients.mu.Lock()
+	defer ociCtx.clients.mu.Unlock()
+
+	if ociCtx.clients.bastionClient == nil {
+		client, err := bastion.NewBastionClientWithConfigurationProvider(ociCtx.ConfigProvider)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create bastion client: %w", err)
+		}
+
+		if ociCtx.Region != "" {
+			client.SetRegion(ociCtx.Region)
+		}
+		ociCtx.configureClient(&client.BaseClient)
+		ociCtx.clients.bastionClient = &client
+	}
+
+	return ociCtx.clients.bastionClient, nil
+}
+
+// Print the tenancy and compartment commands operate on
+func (ociCtx *ociContext) printTenancyCompartment() {
+	utils.FaintMagenta.Println("Tenancy(Compartment): " + ociCtx.TenancyName + "(" + ociCtx.Compartment + ")")
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/cnopslabs/oshiv/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage cached OCI responses",
+	Long: "Manage cached OCI responses\n" +
+		"List calls (E.g. instances, VNIC attachments, private IPs, compartments) are cached in " + utils.CacheDir() + "\n" +
+		"Cached responses are used for --cache-ttl, list and find commands use older responses (up to a day) and refresh them in the background\n" +
+		"Use --refresh to ignore cached responses or --no-cache to disable the cache",
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all cached responses",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := utils.ClearCache()
+		if err != nil {
+			return err
+		}
+
+		fmt.Print("Cache cleared: ")
+		utils.Yellow.Println(utils.CacheDir())
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+}
@@ -0,0 +1,555 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cnopslabs/oshiv/internal/fake"
+	"github.com/cnopslabs/oshiv/internal/resources"
+	"github.com/cnopslabs/oshiv/internal/testutil"
+	"github.com/cnopslabs/oshiv/internal/utils"
+	"github.com/oracle/oci-go-sdk/v65/common"
+)
+
+// Rewrite golden files with the current output: go test ./cmd -update
+var update = flag.Bool("update", false, "update golden files")
+
+// The test binary runs oshiv when re-executed by runOshiv, each command runs in its own process like the real CLI
+// OCI requests are sent to the emulator, the oshiv binary has no way to override the endpoint
+func TestMain(m *testing.M) {
+	if os.Getenv("OSHIV_TEST_CLI") == "1" {
+		endpointOverride = os.Getenv("OSHIV_TEST_ENDPOINT")
+		Execute()
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// Output and exit code of an oshiv command
+type result struct {
+	stdout   string
+	stderr   string
+	exitCode int
+}
+
+// Create a temporary HOME directory with an OCI config file and SSH keys
+func newHome(t *testing.T) string {
+	t.Helper()
+
+	home := t.TempDir()
+	testutil.WriteOciConfig(t, filepath.Join(home, ".oci"))
+	testutil.WriteSshKeyPair(t, filepath.Join(home, ".ssh"))
+
+	return home
+}
+
+// Run oshiv with its OCI requests sent to an emulator, HOME is a new temporary directory (see newHome)
+func runOshiv(t *testing.T, server *testutil.Server, args ...string) result {
+	t.Helper()
+
+	return runOshivIn(t, server, newHome(t), args...)
+}
+
+// Run oshiv in a HOME directory created by newHome, E.g. to run a command that uses a context saved by another
+func runOshivIn(t *testing.T, server *testutil.Server, home string, args ...string) result {
+	t.Helper()
+
+	command := newOshivCommand(server, home, args...)
+
+	var stdout, stderr bytes.Buffer
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	err := command.Run()
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatal(err)
+	}
+
+	normalize := newNormalizer(server, home)
+	return result{normalize.Replace(stdout.String()), normalize.Replace(stderr.String()), command.ProcessState.ExitCode()}
+}
+
+// Return the command running oshiv (the test binary, see TestMain) in home, times are printed in UTC
+func newOshivCommand(server *testutil.Server, home string, args ...string) *exec.Cmd {
+	command := exec.Command(os.Args[0], args...)
+	command.Env = []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + home,
+		"USERPROFILE=" + home,
+		"XDG_CONFIG_HOME=" + filepath.Join(home, ".config"),
+		"XDG_CACHE_HOME=" + filepath.Join(home, ".cache"),
+		"OCI_CLI_CONFIG_FILE=" + filepath.Join(home, ".oci", "config"),
+		"OSHIV_TEST_ENDPOINT=" + server.URL,
+		"OSHIV_NO_CACHE=true",
+		"OSHIV_TEST_CLI=1",
+		"TZ=UTC",
+	}
+
+	return command
+}
+
+// Temporary paths and the emulator's random port vary between runs
+func newNormalizer(server *testutil.Server, home string) *strings.Replacer {
+	return strings.NewReplacer(home, "$HOME", strings.TrimPrefix(server.URL, "http://"), "emulator")
+}
+
+// Compare output with a golden file in testdata, stderr follows stdout when there is any
+func assertGolden(t *testing.T, name string, output result) {
+	t.Helper()
+
+	got := output.stdout
+	if output.stderr != "" {
+		got += "--- stderr ---\n" + output.stderr
+	}
+
+	goldenPath := filepath.Join("testdata", name+".golden")
+	if *update {
+		err := os.WriteFile(goldenPath, []byte(got), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("unable to read golden file (create it with -update): %v", err)
+	}
+
+	if got != string(want) {
+		t.Errorf("output of %s differs from %s\n--- got ---\n%s\n--- want ---\n%s", name, goldenPath, got, want)
+	}
+}
+
+// Start an emulator serving the default fixture, paginated to exercise the list calls' paging
+func newServer(t *testing.T) *testutil.Server {
+	t.Helper()
+
+	backend, err := fake.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.PageSize = 2
+
+	// Sessions are created at a fixed time, like the fixture's sessions
+	backend.Now = func() time.Time { return time.Date(2024, 5, 2, 12, 0, 0, 0, time.UTC) }
+
+	return testutil.NewServer(t, backend)
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		exitCode int
+	}{
+		{"compartment_list", []string{"compartment", "-l"}, 0},
+		{"compartment_tree", []string{"compartment", "--tree"}, 0},
+		{"instance_list", []string{"instance", "-l", "-c", "prod"}, 0},
+		{"instance_list_wide", []string{"instance", "-l", "-c", "prod", "--output", "wide"}, 0},
+		{"instance_list_json", []string{"instance", "-l", "-c", "prod", "--output", "json"}, 0},
+		{"instance_list_template", []string{"instance", "-l", "-c", "prod", "--output", "go-template={{.name}} {{.private_ip}}"}, 0},
+		{"instance_list_custom_columns", []string{"instance", "-l", "-c", "prod", "--output", "custom-columns=NAME:.name,IP:.private_ip,SHAPE:.shape"}, 0},
+		{"instance_list_custom_columns_invalid", []string{"instance", "-l", "-c", "prod", "--output", "custom-columns=NAME:.name,IP:.ip"}, 2},
+		{"instance_find", []string{"instance", "-f", "^web", "-c", "prod"}, 0},
+		{"instance_find_query", []string{"instance", "-f", "tag:team=payments OR ip:10.0.1.10", "-c", "prod", "--output", "table"}, 0},
+		{"instance_find_invalid_query", []string{"instance", "-f", "web OR", "-c", "prod"}, 2},
+		{"instance_state_stopped", []string{"instance", "-l", "-c", "prod", "--state", "stopped"}, 0},
+		{"instance_state_all", []string{"instance", "-l", "-c", "prod", "--state", "all", "--output", "table"}, 0},
+		{"instance_terminated_image_details", []string{"instance", "-f", "old-1", "-c", "prod", "--state", "all", "-i"}, 0},
+		{"instance_terminated_wide", []string{"instance", "-f", "old-1", "-c", "prod", "--state", "all", "--output", "wide"}, 0},
+		{"instance_state_invalid", []string{"instance", "-l", "-c", "prod", "--state", "paused"}, 2},
+		{"instance_recursive", []string{"instance", "-l", "--recursive"}, 0},
+		{"instance_all_regions", []string{"instance", "-f", "^web", "-c", "prod", "--all-regions", "--output", "table"}, 0},
+		{"instance_stop", []string{"instance", "stop", "web-1", "-c", "prod", "--yes"}, 0},
+		{"instance_start_no_wait", []string{"instance", "start", "etl-1", "-c", "prod", "--yes", "--no-wait"}, 0},
+		{"instance_stop_not_confirmed", []string{"instance", "stop", "web-1", "-c", "prod"}, 1},
+		{"instance_start_no_match", []string{"instance", "start", "web-1", "-c", "prod", "--yes"}, 1},
+		{"instance_stop_prefix", []string{"instance", "stop", "web", "-c", "prod", "--yes"}, 1},
+		{"instance_stop_duplicate_names", []string{"instance", "stop", "api", "-c", "prod", "--yes"}, 2},
+		{"instance_stop_query_yes", []string{"instance", "stop", "-f", "^web", "-c", "prod", "--yes"}, 2},
+		{"instance_stop_all_matching", []string{"instance", "stop", "-f", "^web", "-c", "prod", "--yes", "--all-matching", "--no-wait"}, 0},
+		{"instance_stop_name_and_query", []string{"instance", "stop", "web-1", "-f", "^web", "-c", "prod", "--yes"}, 2},
+		{"image_list", []string{"image", "-l", "-c", "prod"}, 0},
+		{"image_find_json", []string{"image", "-f", "ubuntu", "-c", "prod", "--output", "json"}, 0},
+		{"subnet_list", []string{"subnet", "-l", "-c", "prod"}, 0},
+		{"policy_list", []string{"policy", "-l"}, 0},
+		{"policy_find", []string{"policy", "-n", "admin"}, 0},
+		{"oke_list", []string{"oke", "-l", "-c", "prod"}, 0},
+		{"oke_all_regions", []string{"oke", "-l", "-c", "prod", "--all-regions", "--output", "table"}, 0},
+		{"db_list", []string{"db", "-l", "-c", "prod"}, 0},
+		{"bastion_list", []string{"bastion", "-l", "-c", "prod"}, 0},
+		{"bastion_managed", []string{"bastion", "-c", "prod", "-n", "web-1"}, 0},
+		{"bastion_port_forward", []string{"bastion", "-c", "prod", "-n", "db-1", "-y", "port-forward", "-f", "5432"}, 0},
+		{"bastion_port_forward_oke", []string{"bastion", "-c", "prod", "-y", "port-forward", "-k", "prod-oke", "-i", "10.0.3.5"}, 0},
+		{"bastion_name_and_id", []string{"bastion", "-c", "prod", "-n", "web-1", "-b", "prod-bastion", "--bastion-id", "ocid1.bastion.oc1.iad.prod"}, 2},
+		{"session_list", []string{"bastion", "session", "-c", "prod"}, 0},
+		{"session_list_all", []string{"bastion", "session", "-c", "prod", "-a", "--output", "wide"}, 0},
+		{"info_no_tenancy_map", []string{"info"}, 0},
+		{"compartment_not_in_tenancy", []string{"instance", "-l", "-c", "missing"}, 2},
+		{"invalid_flag", []string{"instance", "--missing"}, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			output := runOshiv(t, newServer(t), test.args...)
+			if output.exitCode != test.exitCode {
+				t.Errorf("exit code = %d, want %d\n%s", output.exitCode, test.exitCode, output.stderr)
+			}
+
+			assertGolden(t, test.name, output)
+		})
+	}
+}
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name       string
+		operation  string
+		statusCode int
+		count      int
+		args       []string
+		exitCode   int
+		requests   int
+	}{
+		// Throttled requests and reads the service was unable to handle are retried (see utils.UseRequestPool)
+		{"fault_throttled", "ListInstances", 429, 2, []string{"instance", "-l", "-c", "prod"}, 0, 2 + 3},
+		{"fault_unavailable", "ListInstances", 503, 1, []string{"instance", "-l", "-c", "prod"}, 0, 1 + 3},
+		{"fault_not_authenticated", "GetTenancy", 401, 1, []string{"instance", "-l", "-c", "prod"}, 3, 1},
+		{"fault_not_found", "ListBastions", 404, 1, []string{"bastion", "-l", "-c", "prod"}, 4, 1},
+		// Writes aren't retried
+		{"fault_create_session", "CreateSession", 500, 1, []string{"bastion", "-c", "prod", "-n", "web-1"}, 6, 1},
+		{"fault_instance_action", "InstanceAction", 500, 1, []string{"instance", "stop", "web-1", "-c", "prod", "--yes"}, 6, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := newServer(t)
+			server.Fault(test.operation, test.statusCode, test.count)
+
+			output := runOshiv(t, server, test.args...)
+			if output.exitCode != test.exitCode {
+				t.Errorf("exit code = %d, want %d\n%s", output.exitCode, test.exitCode, output.stderr)
+			}
+
+			if requests := server.Requests(test.operation); requests != test.requests {
+				t.Errorf("%s requests = %d, want %d", test.operation, requests, test.requests)
+			}
+
+			assertGolden(t, test.name, output)
+		})
+	}
+}
+
+// A command of a sequence and its expected exit code
+type step struct {
+	args     []string
+	exitCode int
+}
+
+// Session names end in a random ID (see resources.CreateBastionSession), replaced by one of the same length
+var sessionNameId = regexp.MustCompile(`(oshiv-(?:mng-ssh|pt-fw|dyn-fw)\S*)[A-Za-z0-9_-]{6}(\s|"|$)`)
+
+var generatedTime = regexp.MustCompile(`# Generated: .*`)
+
+// Log records have a time, connections to the proxy a random client port
+var logTime = regexp.MustCompile(`"time":"[^"]*"`)
+var clientAddress = regexp.MustCompile(`"client":"[^"]*"`)
+
+// Commands run one after another in the same HOME against the same emulator, E.g. to use a context saved by an earlier command
+// files are written to HOME before the first command, "$HOME" in arguments is replaced with its path
+// The golden file has every command's output, followed by the outputs files written to HOME
+func TestSequences(t *testing.T) {
+	tenancyMap := "- environment: production\n" +
+		"  tenancy: fake-tenancy\n" +
+		"  tenancy_id: " + fake.TenancyId + "\n" +
+		"  realm: oc1\n" +
+		"  compartments: prod dev\n" +
+		"  regions: us-ashburn-1 us-phoenix-1\n"
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		steps   []step
+		outputs []string
+	}{
+		{"context", nil, []step{
+			{[]string{"context", "current"}, 1},
+			{[]string{"context", "set", "prod", "-c", "prod", "-b", "prod-bastion", "-u", "opc"}, 0},
+			{[]string{"context", "set", "dev", "-c", "dev", "--region", "us-phoenix-1"}, 0},
+			{[]string{"context", "list"}, 0},
+			{[]string{"config"}, 0},
+			{[]string{"bastion", "session", "--output", "table"}, 0},
+			{[]string{"context", "use", "dev"}, 0},
+			{[]string{"context", "current"}, 0},
+			{[]string{"config"}, 0},
+			{[]string{"context", "use", "missing"}, 2},
+			{[]string{"context", "delete", "dev"}, 0},
+			{[]string{"context", "current"}, 1},
+			{[]string{"context", "list", "--output", "json"}, 0},
+		}, []string{".config/oshiv/config.yaml"}},
+		{"cache", nil, []step{
+			{[]string{"compartment", "-l", "--no-cache=false"}, 0},
+			{[]string{"cache", "clear"}, 0},
+		}, nil},
+		{"info", map[string]string{".oci/tenancy-map.yaml": tenancyMap}, []step{
+			{[]string{"info"}, 0},
+			{[]string{"info", "-g", "fake-tenancy"}, 0},
+			{[]string{"info", "-g", "missing"}, 1},
+		}, nil},
+		{"session_delete", nil, []step{
+			{[]string{"bastion", "session", "delete", "manual-session", "-c", "prod"}, 0},
+			{[]string{"bastion", "session", "delete", "manual-session", "-c", "prod"}, 1},
+			{[]string{"bastion", "session", "delete", "ocid1.bastionsession.oc1.iad.db1", "-c", "prod"}, 0},
+			{[]string{"bastion", "session", "-c", "prod", "--output", "table"}, 0},
+		}, nil},
+		{"session_prune", nil, []step{
+			{[]string{"bastion", "-c", "prod", "-n", "web-2"}, 0},
+			// The default key doesn't apply with --older-than, no session is old enough
+			{[]string{"bastion", "session", "prune", "-c", "prod", "--older-than", "100000h", "--dry-run"}, 0},
+			{[]string{"bastion", "session", "prune", "-c", "prod", "--dry-run", "--output", "json"}, 0},
+			{[]string{"bastion", "session", "prune", "-c", "prod"}, 0},
+			{[]string{"bastion", "session", "prune", "-c", "prod", "-e", "$HOME/missing.pub", "--older-than", "24h"}, 0},
+			{[]string{"bastion", "session", "prune", "-c", "prod", "-e", "$HOME/missing.pub"}, 2},
+			{[]string{"bastion", "session", "-c", "prod", "-a", "--output", "table"}, 0},
+		}, nil},
+		{"ssh_config", nil, []step{
+			{[]string{"bastion", "-c", "prod", "-n", "web-2"}, 0},
+			{[]string{"bastion", "ssh-config", "-c", "prod"}, 0},
+			{[]string{"bastion", "ssh-config", "-c", "prod", "-e", "$HOME/missing.pub", "-o", "$HOME/.ssh/config.d/all"}, 0},
+		}, []string{".ssh/config.d/oshiv", ".ssh/config.d/all"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := newServer(t)
+			home := newHome(t)
+
+			for path, content := range test.files {
+				err := os.WriteFile(filepath.Join(home, path), []byte(content), 0600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var got strings.Builder
+			for _, step := range test.steps {
+				args := make([]string, len(step.args))
+				for i, arg := range step.args {
+					args[i] = strings.ReplaceAll(arg, "$HOME", home)
+				}
+
+				output := runOshivIn(t, server, home, args...)
+				if output.exitCode != step.exitCode {
+					t.Errorf("%s: exit code = %d, want %d\n%s", strings.Join(step.args, " "), output.exitCode, step.exitCode, output.stderr)
+				}
+
+				got.WriteString("$ oshiv " + strings.Join(step.args, " ") + "\n" + output.stdout)
+				if output.stderr != "" {
+					got.WriteString("--- stderr ---\n" + output.stderr)
+				}
+				if output.exitCode != 0 {
+					got.WriteString("--- exit status " + strconv.Itoa(output.exitCode) + " ---\n")
+				}
+				got.WriteString("\n")
+			}
+
+			normalize := newNormalizer(server, home)
+			for _, path := range test.outputs {
+				content, err := os.ReadFile(filepath.Join(home, path))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got.WriteString("--- $HOME/" + path + " ---\n" + generatedTime.ReplaceAllString(normalize.Replace(string(content)), "# Generated: TIME"))
+			}
+
+			assertGolden(t, test.name, result{stdout: sessionNameId.ReplaceAllString(got.String(), "${1}XXXXXX$2")})
+		})
+	}
+}
+
+// The proxy runs until interrupted: start it, send it a SOCKS request, then interrupt it like Ctrl-C
+func TestProxy(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("processes can't be interrupted on Windows")
+	}
+
+	tests := []struct {
+		name  string
+		args  []string
+		reply byte // SOCKS reply to a CONNECT request for db.internal:5432, 0 to send no request
+	}{
+		// The bastion has DNS proxy enabled, hosts are resolved by the bastion
+		{"proxy_dynamic", []string{"bastion", "proxy", "-c", "prod"}, 0},
+		// Without the DNS proxy only IPs can be reached, no session is created for a host name
+		{"proxy_per_target", []string{"bastion", "proxy", "-c", "prod", "--per-target"}, 0x08},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := newServer(t)
+			home := newHome(t)
+
+			port := freePort(t)
+			address := net.JoinHostPort("localhost", strconv.Itoa(port))
+
+			command := newOshivCommand(server, home, append(test.args, "--socks", strconv.Itoa(port))...)
+
+			var stdout, stderr bytes.Buffer
+			command.Stdout = &stdout
+			command.Stderr = &stderr
+
+			err := command.Start()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			conn := dialProxy(t, address)
+
+			if test.reply != 0 {
+				request := []byte{0x05, 1, 0x00, 0x05, 0x01, 0x00, 0x03, byte(len("db.internal"))}
+				request = append(request, "db.internal"...)
+				request = append(request, 0x15, 0x38)
+
+				_, err = conn.Write(request)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				reply := make([]byte, 4)
+				_, err = io.ReadFull(conn, reply)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if reply[3] != test.reply {
+					t.Errorf("SOCKS reply = %d, want %d", reply[3], test.reply)
+				}
+			}
+			conn.Close()
+
+			err = command.Process.Signal(os.Interrupt)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = command.Wait()
+			if err != nil {
+				t.Errorf("proxy exited with %v\n%s", err, stderr.String())
+			}
+
+			if requests := server.Requests("CreateSession"); requests != 0 {
+				t.Errorf("CreateSession requests = %d, want 0", requests)
+			}
+
+			normalize := strings.NewReplacer(address, "localhost:PORT")
+			output := result{stdout: normalize.Replace(stdout.String()), stderr: normalize.Replace(stderr.String())}
+			output.stderr = clientAddress.ReplaceAllString(logTime.ReplaceAllString(output.stderr, `"time":"TIME"`), `"client":"CLIENT"`)
+			assertGolden(t, test.name, output)
+		})
+	}
+}
+
+// Return a free local port
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// Connect to the proxy once it's listening
+func dialProxy(t *testing.T, address string) net.Conn {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			return conn
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("proxy not listening on %s: %v", address, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestSelectBastion(t *testing.T) {
+	backend, err := fake.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Three bastions in the compartment, the two "app" bastions reach the target
+	template := backend.Bastions[0]
+	backend.Bastions = nil
+	for _, name := range []string{"app-1", "app-2", "db"} {
+		b := template
+		b.Id = common.String("ocid1.bastion.oc1.iad." + name)
+		b.Name = common.String(name)
+		backend.Bastions = append(backend.Bastions, b)
+	}
+
+	reachesTarget := func(bastions []resources.Bastion) ([]resources.Bastion, error) {
+		var matches []resources.Bastion
+		for _, b := range bastions {
+			if strings.HasPrefix(b.Name, "app") {
+				matches = append(matches, b)
+			}
+		}
+		return matches, nil
+	}
+
+	stdout := os.Stdout
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = writer
+	_, err = selectBastion(backend, fake.CompartmentId, "", reachesTarget)
+	os.Stdout = stdout
+	writer.Close()
+	listed, _ := io.ReadAll(reader)
+
+	var exitErr *utils.ExitCodeError
+	if !errors.As(err, &exitErr) || exitErr.Code != utils.ExitUsage {
+		t.Fatalf("error = %v, want usage error", err)
+	}
+
+	// Only the bastions reaching the target are listed
+	want := "Bastions:\n - app-1: ocid1.bastion.oc1.iad.app-1\n - app-2: ocid1.bastion.oc1.iad.app-2\n"
+	if string(listed) != want {
+		t.Errorf("listed bastions:\n%s\nwant:\n%s", listed, want)
+	}
+}
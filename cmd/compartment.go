@@ -1,14 +1,9 @@
 package cmd
 
 import (
-	"fmt"
-	"os"
-
 	"github.com/cnopslabs/oshiv/internal/resources"
 	"github.com/cnopslabs/oshiv/internal/utils"
-	"github.com/oracle/oci-go-sdk/v65/identity"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var compartmentCmd = &cobra.Command{
@@ -16,35 +11,35 @@ var compartmentCmd = &cobra.Command{
 	Short:   "Find and list compartments",
 	Long:    "Find and list compartments",
 	Aliases: []string{"compart"},
-	Run: func(cmd *cobra.Command, args []string) {
-		// Read tenancy ID flag and calculate tenancy
-		FlagTenancyId := rootCmd.Flags().Lookup("tenancy-id")
-		utils.SetTenancyConfig(FlagTenancyId, utils.OciConfig())
-
-		// Get tenancy ID and tenancy name from Viper config
-		tenancyName := viper.GetString("tenancy-name")
-		tenancyId := viper.GetString("tenancy-id")
-
-		identityClient, identityErr := identity.NewIdentityClientWithConfigurationProvider(utils.OciConfig())
-		utils.CheckError(identityErr)
-
-		region, envVarExists := os.LookupEnv("OCI_CLI_REGION")
-		if envVarExists {
-			identityClient.SetRegion(region)
+	// Only the tenancy is needed, compartments are what this command lists
+	Annotations: map[string]string{bootstrapAnnotation: bootstrapTenancy, backgroundRefreshAnnotation: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ociCtx := getOciContext(cmd)
+
+		identityClient, err := ociCtx.IdentityClient()
+		if err != nil {
+			return err
 		}
 
-		compartments := resources.FetchCompartments(tenancyId, identityClient)
-
 		flagList, _ := cmd.Flags().GetBool("list")
 		flagFind, _ := cmd.Flags().GetString("find")
-
-		if flagList {
-			resources.ListCompartments(compartments, tenancyId, tenancyName)
+		flagTree, _ := cmd.Flags().GetBool("tree")
+
+		if flagList || flagTree {
+			compartments, err := resources.FetchCompartments(ociCtx.TenancyId, identityClient)
+			if err != nil {
+				return err
+			}
+
+			if flagTree {
+				return resources.PrintCompartmentTree(compartments, ociCtx.TenancyId, ociCtx.TenancyName)
+			}
+			return resources.ListCompartments(compartments, ociCtx.TenancyId, ociCtx.TenancyName)
 		} else if flagFind != "" {
-			resources.FindCompartments(tenancyId, tenancyName, identityClient, flagFind)
-		} else {
-			fmt.Println("Invalid sub-command or flag")
+			return resources.FindCompartments(ociCtx.TenancyId, ociCtx.TenancyName, identityClient, flagFind)
 		}
+
+		return utils.UsageError("invalid sub-command or flag")
 	},
 }
 
@@ -53,4 +48,6 @@ func init() {
 
 	compartmentCmd.Flags().BoolP("list", "l", false, "List all compartments")
 	compartmentCmd.Flags().StringP("find", "f", "", "Find compartment by name pattern search")
+	// Note: no shorthand, -t is the global tenancy-id flag
+	compartmentCmd.Flags().Bool("tree", false, "Display the compartment hierarchy as a tree")
 }
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/cnopslabs/oshiv/internal/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var contextCmd = &cobra.Command{
+	Use:   "context",
+	Short: "Save and switch between tenancy, compartment, and region contexts",
+	Long: "Save and switch between tenancy, compartment, and region contexts (like kubectl contexts)\n" +
+		"The current context's values are used when not set by flag or environment variable\n" +
+		"Contexts are saved in " + utils.ConfigFile(),
+	Aliases: []string{"ctx"},
+}
+
+var contextSetCmd = &cobra.Command{
+	Use:   "set [NAME]",
+	Short: "Create or update a context, the current context if NAME is omitted",
+	Long: "Create or update a context, the current context if NAME is omitted (\"default\" if there is no current context)\n" +
+		"Only the values given by flag are changed, E.g. oshiv context set prod -t TENANCY_ID -c prod/network --region us-ashburn-1\n" +
+		"The first context created becomes the current context",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := utils.LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		name := config.CurrentContext
+		if len(args) > 0 {
+			name = args[0]
+		}
+		if name == "" {
+			name = "default"
+		}
+
+		context := config.Contexts[name]
+
+		// Global flags (tenancy-id, compartment, region, profile) are set on the context instead of being used
+		for flagName, value := range map[string]*string{
+			"tenancy-id":  &context.TenancyId,
+			"compartment": &context.Compartment,
+			"region":      &context.Region,
+			"profile":     &context.Profile,
+			"bastion":     &context.Bastion,
+			"ssh-user":    &context.SshUser,
+		} {
+			if cmd.Flags().Changed(flagName) {
+				*value, _ = cmd.Flags().GetString(flagName)
+			}
+		}
+
+		config.Contexts[name] = context
+		if config.CurrentContext == "" {
+			config.CurrentContext = name
+		}
+
+		err = config.Save()
+		if err != nil {
+			return err
+		}
+
+		fmt.Print("Context saved: ")
+		utils.Yellow.Println(name)
+		return nil
+	},
+}
+
+var contextUseCmd = &cobra.Command{
+	Use:   "use NAME",
+	Short: "Switch the current context",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := utils.LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		name := args[0]
+		if _, found := config.Contexts[name]; !found {
+			return utils.UsageError("context " + name + " not found, run 'oshiv context list' to list contexts")
+		}
+
+		config.CurrentContext = name
+		err = config.Save()
+		if err != nil {
+			return err
+		}
+
+		fmt.Print("Switched to context: ")
+		utils.Yellow.Println(name)
+		return nil
+	},
+}
+
+// Context with its name, for context list output
+type namedContext struct {
+	Name          string `json:"name" yaml:"name"`
+	Current       bool   `json:"current" yaml:"current"`
+	utils.Context `yaml:",inline"`
+}
+
+var contextListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "List contexts",
+	Aliases: []string{"ls"},
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := utils.LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, 0, len(config.Contexts))
+		for name := range config.Contexts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		columns := []utils.Column{{Header: "Current"}, {Header: "Name"}, {Header: "Tenancy ID"}, {Header: "Compartment"}, {Header: "Region"}, {Header: "Profile"}, {Header: "Bastion"}, {Header: "SSH User"}}
+
+		var contexts []namedContext
+		var rows [][]string
+		for _, name := range names {
+			context := config.Contexts[name]
+			current := name == config.CurrentContext
+
+			contexts = append(contexts, namedContext{name, current, context})
+
+			currentMarker := ""
+			if current {
+				currentMarker = "*"
+			}
+			rows = append(rows, []string{currentMarker, name, context.TenancyId, context.Compartment, context.Region, context.Profile, context.Bastion, context.SshUser})
+		}
+
+		return utils.PrintOutput(contexts, columns, rows)
+	},
+}
+
+var contextCurrentCmd = &cobra.Command{
+	Use:   "current",
+	Short: "Print the current context",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := utils.LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		if config.CurrentContext == "" {
+			return errors.New("no current context, run 'oshiv context use NAME' to select one")
+		}
+
+		fmt.Println(config.CurrentContext)
+		return nil
+	},
+}
+
+var contextDeleteCmd = &cobra.Command{
+	Use:   "delete NAME",
+	Short: "Delete a context",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := utils.LoadConfig()
+		if err != nil {
+			return err
+		}
+
+		name := args[0]
+		if _, found := config.Contexts[name]; !found {
+			return utils.UsageError("context " + name + " not found, run 'oshiv context list' to list contexts")
+		}
+
+		delete(config.Contexts, name)
+		if config.CurrentContext == name {
+			config.CurrentContext = ""
+		}
+
+		err = config.Save()
+		if err != nil {
+			return err
+		}
+
+		fmt.Print("Context deleted: ")
+		utils.Yellow.Println(name)
+		return nil
+	},
+}
+
+// Return a flag's value, or the current context's value (contextKey) if the flag wasn't set, or the flag's default
+func contextFlag(cmd *cobra.Command, flagName string, contextKey string) string {
+	value, _ := cmd.Flags().GetString(flagName)
+
+	if !cmd.Flags().Changed(flagName) && viper.GetString(contextKey) != "" {
+		value = viper.GetString(contextKey)
+	}
+
+	return value
+}
+
+func init() {
+	rootCmd.AddCommand(contextCmd)
+	contextCmd.AddCommand(contextSetCmd)
+	contextCmd.AddCommand(contextUseCmd)
+	contextCmd.AddCommand(contextListCmd)
+	contextCmd.AddCommand(contextCurrentCmd)
+	contextCmd.AddCommand(contextDeleteCmd)
+
+	contextSetCmd.Flags().StringP("bastion", "b", "", "Default bastion name for bastion and session commands")
+	contextSetCmd.Flags().StringP("ssh-user", "u", "", "Default SSH user for bastion sessions")
+}
@@ -1,59 +1,56 @@
 package cmd
 
 import (
-	"fmt"
-	"os"
-
 	"github.com/cnopslabs/oshiv/internal/resources"
 	"github.com/cnopslabs/oshiv/internal/utils"
-	"github.com/oracle/oci-go-sdk/v65/database"
-	"github.com/oracle/oci-go-sdk/v65/identity"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var dbCmd = &cobra.Command{
-	Use:   "db",
-	Short: "Find and list databases",
-	Long:  "Find and list databases",
-	Run: func(cmd *cobra.Command, args []string) {
-		identityClient, identityErr := identity.NewIdentityClientWithConfigurationProvider(utils.OciConfig())
-		utils.CheckError(identityErr)
+	Use:         "db",
+	Short:       "Find and list databases",
+	Long:        "Find and list databases",
+	Annotations: listAnnotations,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ociCtx := getOciContext(cmd)
 
-		// Read tenancy ID flag and calculate tenancy
-		FlagTenancyId := rootCmd.Flags().Lookup("tenancy-id")
-		utils.SetTenancyConfig(FlagTenancyId, utils.OciConfig())
-		tenancyId := viper.GetString("tenancy-id")
-		tenancyName := viper.GetString("tenancy-name")
+		flagList, _ := cmd.Flags().GetBool("list")
+		flagFind, _ := cmd.Flags().GetString("find")
+		show := resultScope(cmd)
 
-		// Read compartment flag and add to Viper config
-		FlagCompartment := rootCmd.Flags().Lookup("compartment")
-		compartments := resources.FetchCompartments(tenancyId, identityClient)
-		utils.SetCompartmentConfig(FlagCompartment, compartments, tenancyName)
-		compartment := viper.GetString("compartment")
+		if !flagList && flagFind == "" {
+			return utils.UsageError("invalid flag or flag arguments")
+		}
 
-		compartmentId := resources.LookupCompartmentId(compartments, tenancyId, tenancyName, compartment)
+		// List is a find without a pattern
+		databases, err := fetchScopes(cmd, ociCtx, func(scope *ociContext) ([]resources.Database, error) {
+			databaseClient, err := scope.DatabaseClient()
+			if err != nil {
+				return nil, err
+			}
 
-		databaseClient, err := database.NewDatabaseClientWithConfigurationProvider(utils.OciConfig())
-		utils.CheckError(err)
+			databases, err := resources.FindDatabases(databaseClient, scope.CompartmentId, flagFind)
+			if err != nil {
+				return nil, err
+			}
 
-		region, envVarExists := os.LookupEnv("OCI_CLI_REGION")
-		if envVarExists {
-			databaseClient.SetRegion(region)
-		}
+			for i := range databases {
+				if show.ShowRegion {
+					databases[i].Region = scope.Region
+				}
+				if show.ShowCompartment {
+					databases[i].Compartment = scope.CompartmentPath
+				}
+			}
 
-		flagList, _ := cmd.Flags().GetBool("list")
-		flagFind, _ := cmd.Flags().GetString("find")
-
-		if flagList {
-			databases := resources.FindDatabases(databaseClient, compartmentId, "")
-			resources.PrintDatabases(databases, tenancyName, compartment)
-		} else if flagFind != "" {
-			databases := resources.FindDatabases(databaseClient, compartmentId, flagFind)
-			resources.PrintDatabases(databases, tenancyName, compartment)
-		} else {
-			fmt.Println("Invalid flag or flag arguments")
+			return databases, nil
+		})
+		if err != nil {
+			return err
 		}
+
+		utils.PrintCount(len(databases), flagFind, "database(s)")
+		return resources.PrintDatabases(databases, ociCtx.TenancyName, ociCtx.Compartment, show)
 	},
 }
 
@@ -62,4 +59,6 @@ func init() {
 
 	dbCmd.Flags().BoolP("list", "l", false, "List all databases")
 	dbCmd.Flags().StringP("find", "f", "", "Find databases by name pattern search")
+	dbCmd.Flags().Bool("all-regions", false, "Search all subscribed regions")
+	dbCmd.Flags().Bool("recursive", false, "Search all compartments nested under the compartment")
 }
@@ -1,60 +1,62 @@
 package cmd
 
 import (
-	"fmt"
 	"os"
 
 	"github.com/cnopslabs/oshiv/internal/resources"
 	"github.com/cnopslabs/oshiv/internal/utils"
-	"github.com/oracle/oci-go-sdk/v65/core"
-	"github.com/oracle/oci-go-sdk/v65/identity"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var imageCmd = &cobra.Command{
-	Use:     "image",
-	Short:   "Find and list OCI compute images",
-	Long:    "Find and list OCI compute images",
-	Aliases: []string{"img"},
-	Run: func(cmd *cobra.Command, args []string) {
-		identityClient, identityErr := identity.NewIdentityClientWithConfigurationProvider(utils.OciConfig())
-		utils.CheckError(identityErr)
+	Use:         "image",
+	Short:       "Find and list OCI compute images",
+	Long:        "Find and list OCI compute images",
+	Aliases:     []string{"img"},
+	Annotations: listAnnotations,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ociCtx := getOciContext(cmd)
 
-		// Read tenancy ID flag and calculate tenancy
-		FlagTenancyId := rootCmd.Flags().Lookup("tenancy-id")
-		utils.SetTenancyConfig(FlagTenancyId, utils.OciConfig())
-		tenancyId := viper.GetString("tenancy-id")
-		tenancyName := viper.GetString("tenancy-name")
+		flagList, _ := cmd.Flags().GetBool("list")
+		flagFind, _ := cmd.Flags().GetString("find")
+		show := resultScope(cmd)
 
-		// Read compartment flag and add to Viper config
-		FlagCompartment := rootCmd.Flags().Lookup("compartment")
-		compartments := resources.FetchCompartments(tenancyId, identityClient)
-		utils.SetCompartmentConfig(FlagCompartment, compartments, tenancyName)
-		compartment := viper.GetString("compartment")
+		if !flagList && flagFind == "" {
+			return utils.UsageError("invalid flag or flag arguments")
+		}
 
-		compartmentId := resources.LookupCompartmentId(compartments, tenancyId, tenancyName, compartment)
+		if !flagList {
+			// TODO: implement find
+			utils.Faint.Fprintln(os.Stderr, "Image search is not yet enabled, listing all images. Use grep!")
+		}
 
-		computeClient, err := core.NewComputeClientWithConfigurationProvider(utils.OciConfig())
-		utils.CheckError(err)
+		images, err := fetchScopes(cmd, ociCtx, func(scope *ociContext) ([]resources.Image, error) {
+			computeClient, err := scope.ComputeClient()
+			if err != nil {
+				return nil, err
+			}
 
-		region, envVarExists := os.LookupEnv("OCI_CLI_REGION")
-		if envVarExists {
-			computeClient.SetRegion(region)
-		}
+			images, err := resources.FetchImages(computeClient, scope.CompartmentId)
+			if err != nil {
+				return nil, err
+			}
 
-		flagList, _ := cmd.Flags().GetBool("list")
-		flagFind, _ := cmd.Flags().GetString("find")
+			for i := range images {
+				if show.ShowRegion {
+					images[i].Region = scope.Region
+				}
+				if show.ShowCompartment {
+					images[i].Compartment = scope.CompartmentPath
+				}
+			}
 
-		if flagList {
-			resources.ListImages(computeClient, compartmentId, compartment, tenancyName)
-		} else if flagFind != "" {
-			// TODO: implement find
-			fmt.Println("Image search is not yet enabled, listing all images. Use grep!")
-			resources.ListImages(computeClient, compartmentId, compartment, tenancyName)
-		} else {
-			fmt.Println("Invalid flag or flag arguments")
+			return images, nil
+		})
+		if err != nil {
+			return err
 		}
+
+		return resources.PrintImages(images, ociCtx.TenancyName, ociCtx.Compartment, show)
 	},
 }
 
@@ -63,4 +65,6 @@ func init() {
 
 	imageCmd.Flags().BoolP("list", "l", false, "List all images")
 	imageCmd.Flags().StringP("find", "f", "", "Find image by name pattern search")
+	imageCmd.Flags().Bool("all-regions", false, "Search all subscribed regions")
+	imageCmd.Flags().Bool("recursive", false, "Search all compartments nested under the compartment")
 }
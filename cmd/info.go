@@ -11,19 +11,20 @@ var infoCmd = &cobra.Command{
 	Use:   "info",
 	Short: "Display your custom OCI tenancy information",
 	Long:  "Display your custom OCI tenancy information",
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		flagTenancyName, _ := cmd.Flags().GetString("lookup-tenancy-id")
 
 		if flagTenancyName != "" {
 			TenancyId, err := utils.LookUpTenancyID(flagTenancyName)
-			utils.CheckError(err)
-
-			if err == nil {
-				fmt.Println(TenancyId)
+			if err != nil {
+				return err
 			}
-		} else {
-			utils.PrintTenancyMap()
+
+			fmt.Println(TenancyId)
+			return nil
 		}
+
+		return utils.PrintTenancyMap()
 	},
 }
 
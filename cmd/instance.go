@@ -1,69 +1,172 @@
 package cmd
 
 import (
-	"fmt"
-	"os"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cnopslabs/oshiv/internal/resources"
 	"github.com/cnopslabs/oshiv/internal/utils"
-	"github.com/oracle/oci-go-sdk/v65/core"
-	"github.com/oracle/oci-go-sdk/v65/identity"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var instanceCmd = &cobra.Command{
-	Use:     "instance",
-	Short:   "Find and list OCI instances",
-	Long:    "Find and list OCI instances",
-	Aliases: []string{"inst"},
-	Run: func(cmd *cobra.Command, args []string) {
-		identityClient, identityErr := identity.NewIdentityClientWithConfigurationProvider(utils.OciConfig())
-		utils.CheckError(identityErr)
-
-		// Read tenancy ID flag and calculate tenancy
-		FlagTenancyId := rootCmd.Flags().Lookup("tenancy-id")
-		utils.SetTenancyConfig(FlagTenancyId, utils.OciConfig())
-		tenancyId := viper.GetString("tenancy-id")
-		tenancyName := viper.GetString("tenancy-name")
-
-		// Read compartment flag and add to Viper config
-		FlagCompartment := rootCmd.Flags().Lookup("compartment")
-		compartments := resources.FetchCompartments(tenancyId, identityClient)
-		utils.SetCompartmentConfig(FlagCompartment, compartments, tenancyName)
-		compartment := viper.GetString("compartment")
-		compartmentId := resources.LookupCompartmentId(compartments, tenancyId, tenancyName, compartment)
-
-		computeClient, err := core.NewComputeClientWithConfigurationProvider(utils.OciConfig())
-		utils.CheckError(err)
-
-		vnetClient, err := core.NewVirtualNetworkClientWithConfigurationProvider(utils.OciConfig())
-		utils.CheckError(err)
-
-		region, envVarExists := os.LookupEnv("OCI_CLI_REGION")
-		if envVarExists {
-			computeClient.SetRegion(region)
-			vnetClient.SetRegion(region)
-		}
+	Use:         "instance",
+	Short:       "Find and list OCI instances",
+	Long:        "Find and list OCI instances",
+	Aliases:     []string{"inst"},
+	Annotations: listAnnotations,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ociCtx := getOciContext(cmd)
 
 		flagList, _ := cmd.Flags().GetBool("list")
 		flagFind, _ := cmd.Flags().GetString("find")
 		flagDisplayImageDetails, _ := cmd.Flags().GetBool("image-details")
+		flagState, _ := cmd.Flags().GetString("state")
+		show := resultScope(cmd)
+
+		if !flagList && flagFind == "" {
+			return utils.UsageError("invalid flag or flag arguments")
+		}
 
-		if flagList {
-			resources.ListInstances(computeClient, compartmentId, vnetClient, flagDisplayImageDetails, compartment, tenancyName)
-		} else if flagFind != "" {
-			resources.FindInstances(computeClient, vnetClient, compartmentId, flagFind, flagDisplayImageDetails, compartment, tenancyName)
-		} else {
-			fmt.Println("Invalid flag or flag arguments")
+		state, err := resources.ParseInstanceState(flagState)
+		if err != nil {
+			return err
 		}
+
+		// List is a find without a pattern
+		instances, err := fetchScopes(cmd, ociCtx, func(scope *ociContext) ([]resources.Instance, error) {
+			computeClient, err := scope.ComputeClient()
+			if err != nil {
+				return nil, err
+			}
+
+			vnetClient, err := scope.VirtualNetworkClient()
+			if err != nil {
+				return nil, err
+			}
+
+			instances, err := resources.FindInstances(computeClient, vnetClient, scope.CompartmentId, state, flagFind, flagDisplayImageDetails, false)
+			if err != nil {
+				return nil, err
+			}
+
+			for i := range instances {
+				// The API returns short region keys for some regions (E.g. iad), use the subscribed region name instead
+				if show.ShowRegion {
+					instances[i].Region = scope.Region
+				}
+				if show.ShowCompartment {
+					instances[i].Compartment = scope.CompartmentPath
+				}
+			}
+
+			return instances, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		utils.PrintCount(len(instances), flagFind, "instances")
+		return resources.PrintInstances(instances, ociCtx.TenancyName, ociCtx.Compartment, show)
 	},
 }
 
+// Create an instance power action command (E.g. oshiv inst stop NAME), instances are matched by exact name or OCID, or like --find with --find
+func newInstanceActionCmd(action resources.InstanceAction) *cobra.Command {
+	actionCmd := &cobra.Command{
+		Use:         action.Name + " [NAME|OCID]",
+		Short:       action.Description,
+		Long:        action.Description + ", by exact instance name or OCID, or all instances matching a --find query (E.g. -f '^web', -f tag:team=payments)",
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: compartmentAnnotations,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ociCtx := getOciContext(cmd)
+
+			flagFind, _ := cmd.Flags().GetString("find")
+			flagAllMatching, _ := cmd.Flags().GetBool("all-matching")
+			flagYes, _ := cmd.Flags().GetBool("yes")
+			flagNoWait, _ := cmd.Flags().GetBool("no-wait")
+			flagTimeout, _ := cmd.Flags().GetDuration("timeout")
+
+			computeClient, err := ociCtx.ComputeClient()
+			if err != nil {
+				return err
+			}
+
+			vnetClient, err := ociCtx.VirtualNetworkClient()
+			if err != nil {
+				return err
+			}
+
+			if (len(args) == 0) == (flagFind == "") {
+				return utils.UsageError("pass either an instance name or OCID, or a --find query")
+			}
+
+			// Match on current instance states, not cached ones
+			var instances []resources.Instance
+			target := flagFind
+			if flagFind != "" {
+				instances, err = resources.FindInstances(computeClient, vnetClient, ociCtx.CompartmentId, action.State, flagFind, false, true)
+			} else {
+				target = args[0]
+				instances, err = resources.FindInstancesByName(computeClient, vnetClient, ociCtx.CompartmentId, action.State, target, true)
+			}
+			if err != nil {
+				return err
+			}
+
+			if len(instances) == 0 && flagFind == "" {
+				return errors.New("no " + strings.ToLower(string(action.State)) + " instance named " + target)
+			}
+
+			if len(instances) == 0 {
+				return errors.New("no " + strings.ToLower(string(action.State)) + " instances matching " + target)
+			}
+
+			// Without a prompt, acting on several instances has to be asked for explicitly
+			if flagYes && len(instances) > 1 && !flagAllMatching {
+				// Display names aren't unique, instances matched by name are listed by OCID
+				names := make([]string, len(instances))
+				for i, instance := range instances {
+					names[i] = instance.Name
+					if flagFind == "" {
+						names[i] = instance.Id
+					}
+				}
+
+				return utils.UsageError(strconv.Itoa(len(instances)) + " instances match " + target + " (" + strings.Join(names, ", ") + "), pass --all-matching to " + action.Name + " all of them")
+			}
+
+			if !flagYes && !resources.ConfirmInstanceAction(instances, action) {
+				return errors.New("aborted, no instances were changed")
+			}
+
+			return resources.RunInstanceAction(computeClient, ociCtx.CompartmentId, instances, action, !flagNoWait, flagTimeout)
+		},
+	}
+
+	actionCmd.Flags().StringP("find", "f", "", "Act on all instances matching a name pattern or field query (see oshiv instance --find)")
+	actionCmd.Flags().Bool("all-matching", false, "With --yes, act on every matching instance when more than one matches")
+	actionCmd.Flags().BoolP("yes", "y", false, "Don't ask for confirmation")
+	actionCmd.Flags().Bool("no-wait", false, "Don't wait for instances to reach the "+strings.ToLower(string(action.TargetState))+" state")
+	actionCmd.Flags().Duration("timeout", 20*time.Minute, "Time to wait for instances to reach the "+strings.ToLower(string(action.TargetState))+" state")
+
+	return actionCmd
+}
+
 func init() {
 	rootCmd.AddCommand(instanceCmd)
 
+	for _, action := range resources.InstanceActions {
+		instanceCmd.AddCommand(newInstanceActionCmd(action))
+	}
+
 	instanceCmd.Flags().BoolP("list", "l", false, "List all instances")
-	instanceCmd.Flags().StringP("find", "f", "", "Find instance by name pattern search")
+	instanceCmd.Flags().StringP("find", "f", "", "Find instances by name pattern or field query (E.g. ip:10.0.3.14, host:api-*, tag:team=payments)")
 	instanceCmd.Flags().BoolP("image-details", "i", false, "Display image details")
+	instanceCmd.Flags().String("state", "running", "Only instances in this lifecycle state: "+strings.Join(resources.InstanceStates(), ", "))
+	instanceCmd.Flags().Bool("all-regions", false, "Search all subscribed regions")
+	instanceCmd.Flags().Bool("recursive", false, "Search all compartments nested under the compartment")
 }
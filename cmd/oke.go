@@ -1,59 +1,56 @@
 package cmd
 
 import (
-	"fmt"
-	"os"
-
 	"github.com/cnopslabs/oshiv/internal/resources"
 	"github.com/cnopslabs/oshiv/internal/utils"
-	"github.com/oracle/oci-go-sdk/v65/containerengine"
-	"github.com/oracle/oci-go-sdk/v65/identity"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var okeCmd = &cobra.Command{
-	Use:   "oke",
-	Short: "Find and list OKE clusters",
-	Long:  "Find and list OKE clusters",
-	Run: func(cmd *cobra.Command, args []string) {
-		identityClient, identityErr := identity.NewIdentityClientWithConfigurationProvider(utils.OciConfig())
-		utils.CheckError(identityErr)
+	Use:         "oke",
+	Short:       "Find and list OKE clusters",
+	Long:        "Find and list OKE clusters",
+	Annotations: listAnnotations,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ociCtx := getOciContext(cmd)
 
-		// Read tenancy ID flag and calculate tenancy
-		FlagTenancyId := rootCmd.Flags().Lookup("tenancy-id")
-		utils.SetTenancyConfig(FlagTenancyId, utils.OciConfig())
-		tenancyId := viper.GetString("tenancy-id")
-		tenancyName := viper.GetString("tenancy-name")
+		flagList, _ := cmd.Flags().GetBool("list")
+		flagFind, _ := cmd.Flags().GetString("find")
+		show := resultScope(cmd)
 
-		// Read compartment flag and add to Viper config
-		FlagCompartment := rootCmd.Flags().Lookup("compartment")
-		compartments := resources.FetchCompartments(tenancyId, identityClient)
-		utils.SetCompartmentConfig(FlagCompartment, compartments, tenancyName)
-		compartment := viper.GetString("compartment")
+		if !flagList && flagFind == "" {
+			return utils.UsageError("invalid flag or flag arguments")
+		}
 
-		compartmentId := resources.LookupCompartmentId(compartments, tenancyId, tenancyName, compartment)
+		// List is a find without a pattern
+		clusters, err := fetchScopes(cmd, ociCtx, func(scope *ociContext) ([]resources.Cluster, error) {
+			containerEngineClient, err := scope.ContainerEngineClient()
+			if err != nil {
+				return nil, err
+			}
 
-		containerEngineClient, err := containerengine.NewContainerEngineClientWithConfigurationProvider(utils.OciConfig())
-		utils.CheckError(err)
+			clusters, err := resources.FindClusters(containerEngineClient, scope.CompartmentId, flagFind)
+			if err != nil {
+				return nil, err
+			}
 
-		region, envVarExists := os.LookupEnv("OCI_CLI_REGION")
-		if envVarExists {
-			containerEngineClient.SetRegion(region)
-		}
+			for i := range clusters {
+				if show.ShowRegion {
+					clusters[i].Region = scope.Region
+				}
+				if show.ShowCompartment {
+					clusters[i].Compartment = scope.CompartmentPath
+				}
+			}
 
-		flagList, _ := cmd.Flags().GetBool("list")
-		flagFind, _ := cmd.Flags().GetString("find")
-
-		if flagList {
-			clusters := resources.FindClusters(containerEngineClient, compartmentId, "")
-			resources.PrintClusters(clusters, tenancyName, compartment)
-		} else if flagFind != "" {
-			clusters := resources.FindClusters(containerEngineClient, compartmentId, flagFind)
-			resources.PrintClusters(clusters, tenancyName, compartment)
-		} else {
-			fmt.Println("Invalid flag or flag arguments")
+			return clusters, nil
+		})
+		if err != nil {
+			return err
 		}
+
+		utils.PrintCount(len(clusters), flagFind, "cluster(s)")
+		return resources.PrintClusters(clusters, ociCtx.TenancyName, ociCtx.Compartment, show)
 	},
 }
 
@@ -62,4 +59,6 @@ func init() {
 
 	okeCmd.Flags().BoolP("list", "l", false, "List all OKE clusters")
 	okeCmd.Flags().StringP("find", "f", "", "Find OKE cluster by name pattern search")
+	okeCmd.Flags().Bool("all-regions", false, "Search all subscribed regions")
+	okeCmd.Flags().Bool("recursive", false, "Search all compartments nested under the compartment")
 }
@@ -1,63 +1,69 @@
 package cmd
 
 import (
-	"fmt"
-	"os"
+	"strconv"
 
 	"github.com/cnopslabs/oshiv/internal/resources"
 	"github.com/cnopslabs/oshiv/internal/utils"
-	"github.com/oracle/oci-go-sdk/v65/identity"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var policyCmd = &cobra.Command{
-	Use:   "policy",
-	Short: "Find and list policies by name or statement",
-	Long:  "Find and list policies by name or statement",
-	Run: func(cmd *cobra.Command, args []string) {
-		identityClient, identityErr := identity.NewIdentityClientWithConfigurationProvider(utils.OciConfig())
-		utils.CheckError(identityErr)
-
-		region, envVarExists := os.LookupEnv("OCI_CLI_REGION")
-		if envVarExists {
-			identityClient.SetRegion(region)
-		}
-
-		// Read tenancy ID flag and calculate tenancy
-		FlagTenancyId := rootCmd.Flags().Lookup("tenancy-id")
-		utils.SetTenancyConfig(FlagTenancyId, utils.OciConfig())
-		tenancyId := viper.GetString("tenancy-id")
-		tenancyName := viper.GetString("tenancy-name")
-
-		// Read compartment flag and add to Viper config
-		FlagCompartment := rootCmd.Flags().Lookup("compartment")
-		compartments := resources.FetchCompartments(tenancyId, identityClient)
-		utils.SetCompartmentConfig(FlagCompartment, compartments, tenancyName)
-		compartment := viper.GetString("compartment")
-
-		compartmentId := resources.LookupCompartmentId(compartments, tenancyId, tenancyName, compartment)
+	Use:         "policy",
+	Short:       "Find and list policies by name or statement",
+	Long:        "Find and list policies by name or statement",
+	Annotations: listAnnotations,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ociCtx := getOciContext(cmd)
 
 		flagList, _ := cmd.Flags().GetBool("list")
 		flagFindByName, _ := cmd.Flags().GetString("find-by-name")
 		flagFindByStatement, _ := cmd.Flags().GetString("find-by-statement")
 		flagIncludeStatement, _ := cmd.Flags().GetBool("include-statements")
+		show := resultScope(cmd)
 
 		if flagList {
-			if flagIncludeStatement {
-				resources.ListPolicies(identityClient, compartmentId, false)
-			} else {
-				resources.ListPolicies(identityClient, compartmentId, true)
+			// List all policies, even if a search pattern was given too
+			flagFindByName, flagFindByStatement = "", ""
+		} else if flagFindByName == "" && flagFindByStatement == "" {
+			return utils.UsageError("invalid flag or flag arguments")
+		}
+
+		// Policies are not regional, only --recursive applies
+		policies, err := fetchScopes(cmd, ociCtx, func(scope *ociContext) ([]resources.Policy, error) {
+			identityClient, err := scope.IdentityClient()
+			if err != nil {
+				return nil, err
 			}
-		} else if flagFindByName != "" || flagFindByStatement != "" {
-			if flagIncludeStatement {
-				resources.FindPolicies(identityClient, compartmentId, flagFindByName, flagFindByStatement, false)
+
+			policies, err := resources.FindPolicies(identityClient, scope.CompartmentId, flagFindByName, flagFindByStatement)
+			if err != nil {
+				return nil, err
+			}
+
+			if show.ShowCompartment {
+				for i := range policies {
+					policies[i].Compartment = scope.CompartmentPath
+				}
+			}
+
+			return policies, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if !utils.StructuredOutput() {
+			if flagList {
+				utils.Faint.Println(strconv.Itoa(len(policies)) + " results")
+			} else if len(policies) > 0 {
+				utils.Faint.Println(strconv.Itoa(len(policies)) + " policy matches")
 			} else {
-				resources.FindPolicies(identityClient, compartmentId, flagFindByName, flagFindByStatement, true)
+				return nil
 			}
-		} else {
-			fmt.Println("Invalid flag or flag arguments")
 		}
+
+		return resources.PrintPolicies(policies, !flagIncludeStatement, show)
 	},
 }
 
@@ -68,4 +74,5 @@ func init() {
 	policyCmd.Flags().StringP("find-by-name", "n", "", "Find policy by name search pattern")
 	policyCmd.Flags().StringP("find-by-statement", "s", "", "Find policy by statement search pattern")
 	policyCmd.Flags().BoolP("include-statements", "a", false, "Include policy statements in results")
+	policyCmd.Flags().Bool("recursive", false, "Search all compartments nested under the compartment")
 }
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"github.com/cnopslabs/oshiv/internal/resources"
+	"github.com/cnopslabs/oshiv/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var proxyCmd = &cobra.Command{
+	Use:         "proxy",
+	Short:       "Run a local SOCKS5 proxy to private resources through a bastion",
+	Long:        "Run a local SOCKS5 proxy that reaches any private IP or hostname through a bastion. Uses a dynamic port forwarding session when the bastion has DNS proxy enabled, otherwise creates a port forwarding session per destination on demand",
+	Annotations: compartmentAnnotations,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ociCtx := getOciContext(cmd)
+
+		bastionClient, err := ociCtx.BastionClient()
+		if err != nil {
+			return err
+		}
+
+		flagSocksPort, _ := cmd.Flags().GetInt("socks")
+		flagBastionName := contextFlag(cmd, "bastion-name", "bastion")
+		flagPerTarget, _ := cmd.Flags().GetBool("per-target")
+		flagTtl, _ := cmd.Flags().GetInt("ttl")
+
+		// Destinations aren't known up front, so the bastion must be passed or be the only one
+		selectedBastion, err := selectBastion(bastionClient, ociCtx.CompartmentId, flagBastionName, nil)
+		if err != nil {
+			return err
+		}
+
+		flagTtl, err = sessionTtl(bastionClient, selectedBastion, flagTtl)
+		if err != nil {
+			return err
+		}
+
+		// Dynamic port forwarding sessions require the bastion's DNS proxy
+		dynamic := selectedBastion.DnsProxy && !flagPerTarget
+		if !selectedBastion.DnsProxy && !flagPerTarget {
+			utils.Faint.Println("Bastion " + selectedBastion.Name + " does not have DNS proxy enabled, creating a port forwarding session per destination")
+		}
+
+		sshKey, err := sessionSshKey(cmd)
+		if err != nil {
+			return err
+		}
+		defer sshKey.Destroy()
+
+		ociCtx.printTenancyCompartment()
+		return resources.RunSocksProxy(bastionClient, selectedBastion.Id, sshKey, flagTtl, flagSocksPort, dynamic)
+	},
+}
+
+func init() {
+	bastionCmd.AddCommand(proxyCmd)
+
+	defaultPrivateKeyPath, defaultPublicKeyPath := defaultSshKeyPaths()
+
+	proxyCmd.Flags().IntP("socks", "s", 1080, "Local port for the SOCKS5 proxy")
+	proxyCmd.Flags().StringP("bastion-name", "b", "", "Bastion name or OCID")
+	proxyCmd.Flags().BoolP("per-target", "p", false, "Always create a port forwarding session per destination, even if the bastion has DNS proxy enabled")
+	proxyCmd.Flags().IntP("ttl", "m", 10800, "Bastion session TTL")
+	proxyCmd.Flags().StringP("private-key", "a", defaultPrivateKeyPath, "Path to SSH private key (identity file)")
+	proxyCmd.Flags().StringP("public-key", "e", defaultPublicKeyPath, "Path to SSH public key")
+	proxyCmd.Flags().Bool("ephemeral-key", false, "Generate a single use SSH key pair instead of using --private-key/--public-key")
+	proxyCmd.Flags().String("ephemeral-key-type", "ed25519", "Type of ephemeral SSH key to generate (ed25519/rsa)")
+}
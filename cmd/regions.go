@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/cnopslabs/oshiv/internal/utils"
+	"github.com/oracle/oci-go-sdk/v65/identity"
+	"github.com/spf13/cobra"
+)
+
+// Fetch results in the command's region, or concurrently in every subscribed region with --all-regions (see utils.ForEach)
+// Results are merged in region order, fetch is expected to record the region on each result
+func fetchRegions[T any](cmd *cobra.Command, ociCtx *ociContext, fetch func(regionCtx *ociContext) ([]T, error)) ([]T, error) {
+	allRegions, _ := cmd.Flags().GetBool("all-regions")
+	if !allRegions {
+		return fetch(ociCtx)
+	}
+
+	regions, err := ociCtx.SubscribedRegions()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([][]T, len(regions))
+	err = utils.ForEach(len(regions), func(i int) error {
+		var err error
+		results[i], err = fetch(ociCtx.withRegion(regions[i]))
+		if err != nil {
+			return fmt.Errorf("%s: %w", regions[i], err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var merged []T
+	for _, regionResults := range results {
+		merged = append(merged, regionResults...)
+	}
+
+	return merged, nil
+}
+
+// Return the names of the regions the tenancy is subscribed to (OCI API call)
+func (ociCtx *ociContext) SubscribedRegions() ([]string, error) {
+	identityClient, err := ociCtx.IdentityClient()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := identityClient.ListRegionSubscriptions(context.Background(), identity.ListRegionSubscriptionsRequest{TenancyId: &ociCtx.TenancyId})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list region subscriptions: %w", err)
+	}
+
+	var regions []string
+	for _, subscription := range response.Items {
+		// Skip regions that are still being subscribed to
+		if subscription.Status == identity.RegionSubscriptionStatusReady {
+			regions = append(regions, *subscription.RegionName)
+		}
+	}
+	sort.Strings(regions)
+
+	return regions, nil
+}
+
+// Return a copy of the OCI context for another region, clients are created on first use in that region
+func (ociCtx *ociContext) withRegion(region string) *ociContext {
+	return &ociContext{
+		ConfigProvider:  ociCtx.ConfigProvider,
+		Region:          region,
+		Endpoint:        ociCtx.Endpoint,
+		TenancyId:       ociCtx.TenancyId,
+		TenancyName:     ociCtx.TenancyName,
+		Compartment:     ociCtx.Compartment,
+		CompartmentId:   ociCtx.CompartmentId,
+		CompartmentPath: ociCtx.CompartmentPath,
+		Compartments:    ociCtx.Compartments,
+		clients:         &ociClients{},
+	}
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"os"
+	"strings"
 
 	"github.com/cnopslabs/oshiv/internal/utils"
 	"github.com/spf13/cobra"
@@ -13,48 +14,30 @@ var rootCmd = &cobra.Command{
 	Use:   "oshiv",
 	Short: "A tool for finding and connecting to OCI resources via the bastion service",
 	Long:  "A tool for finding and connecting to OCI resources via the bastion service",
+	// Resolve tenancy, compartment, and region once for every sub-command that needs them (see bootstrap.go)
+	// Note: sub-commands must not define their own PersistentPreRunE, it would replace this one
+	PersistentPreRunE: bootstrap,
 	Run: func(cmd *cobra.Command, args []string) {
 		// TODO: Maybe add version here. Need to research how `cmd` handles version
 	},
 }
 
 func Execute() {
-	// We need to do some initialization prior to executing any sub-commands
-	// Note: all sub-commands depend in this initialization
-
-	// Get tenancy ID from OCI config file and set as the default (lowest precedence order) in viper config
-	ociConfigTenancyId, err_config := utils.OciConfig().TenancyOCID()
-	utils.CheckError(err_config)
-	viper.SetDefault("tenancy-id", ociConfigTenancyId)
-
-	// Attempt to add tenancy ID to Viper config from environment variable (3rd lowest precedence order)
-	// Note: OCI_CLI_TENANCY env var follows OCI CLI convention for Tenancy ID
-	_, envVarExists := os.LookupEnv("OCI_CLI_TENANCY")
-	if envVarExists {
-		viper.BindEnv("tenancy-id", "OCI_CLI_TENANCY")
-	} else {
-		// Since OCI_CLI_TENANCY (ID) is not set by env var, see if OCI_TENANCY_NAME is
-		// OCI_TENANCY_NAME does not follow OCI CLI convention but is nicer for humans
-		tenancy_from_env, envVarExists := os.LookupEnv("OCI_TENANCY_NAME")
-
-		if envVarExists {
-			// Since OCI_TENANCY_NAME is set, let's use it to lookup and set Tenancy ID
-			tenancyId, err := utils.LookUpTenancyID(tenancy_from_env)
-			utils.CheckError(err)
-
-			// Override tenancy ID
-			viper.Set("tenancy-id", tenancyId)
-		}
-	}
-
-	// Attempt to add compartment to Viper config from environment variable (3rd lowest precedence order)
-	viper.BindEnv("compartment", "OCI_COMPARTMENT")
+	// Errors are printed (with a hint for known OCI errors) by utils.HandleError, not by cobra
+	rootCmd.SilenceUsage = true
+	rootCmd.SilenceErrors = true
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return utils.UsageError(err.Error() + "\nSee '" + cmd.CommandPath() + " --help'")
+	})
 
 	// Execute adds all child commands to the root command and sets flags appropriately.
 	err := rootCmd.Execute()
 	if err != nil {
-		os.Exit(1)
+		os.Exit(utils.HandleError(err))
 	}
+
+	// Stale cached responses are refreshed after the command's output is complete
+	utils.RefreshStaleCache()
 }
 
 func init() {
@@ -66,5 +49,48 @@ func init() {
 
 	// Compartment is required by all OCI API calls except for compartment list
 	var flagCompartmentName string
-	rootCmd.PersistentFlags().StringVarP(&flagCompartmentName, "compartment", "c", "", "The name of the compartment to use")
+	rootCmd.PersistentFlags().StringVarP(&flagCompartmentName, "compartment", "c", "", "The name or path (E.g. prod/network) of the compartment to use")
+
+	// Output format for list and find commands, the default is detailed text
+	// Note: no shorthand, -o is used by bastion (instance-id) and ssh-config (file)
+	var flagOutput utils.OutputFlag
+	rootCmd.PersistentFlags().Var(&flagOutput, "output", "Output format: "+strings.Join(utils.OutputFormats, ", ")+" (default detailed text)")
+	viper.BindPFlag("output", rootCmd.PersistentFlags().Lookup("output"))
+
+	// Authentication method, the default uses the OCI config file profile as is
+	// Note: no shorthand, -a is used by bastion and proxy (private-key)
+	// Note: OCI_CLI_AUTH env var follows OCI CLI convention for authentication method
+	var flagAuth string
+	rootCmd.PersistentFlags().StringVar(&flagAuth, "auth", "", "Authentication method: "+strings.Join(utils.AuthMethods, ", ")+" (default OCI config file profile)")
+	viper.BindPFlag("auth", rootCmd.PersistentFlags().Lookup("auth"))
+	viper.BindEnv("auth", "OCI_CLI_AUTH")
+
+	// Region override, the default is the region from the OCI config file
+	// Note: no shorthand, -r is used by bastion (create)
+	// Note: OCI_CLI_REGION env var follows OCI CLI convention for region
+	var flagRegion string
+	rootCmd.PersistentFlags().StringVar(&flagRegion, "region", "", "The region to use (E.g. us-ashburn-1), overrides the OCI config file region")
+	viper.BindPFlag("region", rootCmd.PersistentFlags().Lookup("region"))
+	viper.BindEnv("region", "OCI_CLI_REGION")
+
+	// OCI config file profile
+	// Note: OCI_CLI_PROFILE env var follows OCI CLI convention for profile
+	var flagProfile string
+	rootCmd.PersistentFlags().StringVar(&flagProfile, "profile", "", "The OCI config file profile to use (default \"DEFAULT\")")
+	viper.BindPFlag("profile", rootCmd.PersistentFlags().Lookup("profile"))
+	viper.BindEnv("profile", "OCI_CLI_PROFILE")
+	viper.SetDefault("profile", "DEFAULT")
+
+	// Cached responses of list calls (see utils.Cached)
+	// Note: OSHIV_CACHE_TTL env var sets the TTL, E.g. 30m
+	rootCmd.PersistentFlags().Duration("cache-ttl", utils.DefaultCacheTTL, "Time cached responses are used before being refreshed")
+	viper.BindPFlag("cache-ttl", rootCmd.PersistentFlags().Lookup("cache-ttl"))
+	viper.BindEnv("cache-ttl", "OSHIV_CACHE_TTL")
+
+	rootCmd.PersistentFlags().Bool("refresh", false, "Ignore cached responses, cache fresh responses")
+	viper.BindPFlag("refresh", rootCmd.PersistentFlags().Lookup("refresh"))
+
+	rootCmd.PersistentFlags().Bool("no-cache", false, "Don't read or write cached responses")
+	viper.BindPFlag("no-cache", rootCmd.PersistentFlags().Lookup("no-cache"))
+	viper.BindEnv("no-cache", "OSHIV_NO_CACHE")
 }
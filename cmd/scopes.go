@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/cnopslabs/oshiv/internal/resources"
+	"github.com/cnopslabs/oshiv/internal/utils"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/spf13/cobra"
+)
+
+// Fetch results in the command's compartment and region
+// With --all-regions the fetch runs in every subscribed region, with --recursive in every compartment under the command's compartment
+// fetch is expected to record the region (scope.Region) and compartment path (scope.CompartmentPath) on each result if they are shown
+func fetchScopes[T any](cmd *cobra.Command, ociCtx *ociContext, fetch func(scope *ociContext) ([]T, error)) ([]T, error) {
+	return fetchRegions(cmd, ociCtx, func(regionCtx *ociContext) ([]T, error) {
+		return fetchCompartments(cmd, regionCtx, fetch)
+	})
+}
+
+// Fetch results in the command's compartment, or concurrently in the compartment and all compartments nested under it with --recursive (see utils.ForEach)
+// Results are merged in compartment path order
+// Compartments that can't be searched (not authorized or not found) are skipped with a warning
+func fetchCompartments[T any](cmd *cobra.Command, ociCtx *ociContext, fetch func(compartmentCtx *ociContext) ([]T, error)) ([]T, error) {
+	recursive, _ := cmd.Flags().GetBool("recursive")
+	if !recursive {
+		return fetch(ociCtx)
+	}
+
+	scopes := []*ociContext{ociCtx}
+	for _, compartment := range resources.CompartmentSubtree(ociCtx.Compartments, ociCtx.TenancyId, ociCtx.CompartmentId) {
+		scopes = append(scopes, ociCtx.withCompartment(compartment.Name, compartment.Id, compartment.Path))
+	}
+
+	results := make([][]T, len(scopes))
+	errs := make([]error, len(scopes))
+
+	// Errors are handled per compartment below
+	utils.ForEach(len(scopes), func(i int) error {
+		results[i], errs[i] = fetch(scopes[i])
+		return nil
+	})
+
+	var merged []T
+	for i, scope := range scopes {
+		if errs[i] != nil {
+			var serviceErr common.ServiceError
+			if errors.As(errs[i], &serviceErr) && serviceErr.GetHTTPStatusCode() == http.StatusNotFound {
+				fmt.Fprintln(os.Stderr, "Skipping compartment "+scope.CompartmentPath+": not authorized or not found")
+				continue
+			}
+
+			return nil, fmt.Errorf("compartment %s: %w", scope.CompartmentPath, errs[i])
+		}
+		merged = append(merged, results[i]...)
+	}
+
+	return merged, nil
+}
+
+// Region and compartment columns to show for the command's --all-regions and --recursive flags
+func resultScope(cmd *cobra.Command) resources.Scope {
+	allRegions, _ := cmd.Flags().GetBool("all-regions")
+	recursive, _ := cmd.Flags().GetBool("recursive")
+
+	return resources.Scope{ShowRegion: allRegions, ShowCompartment: recursive}
+}
+
+// Return a copy of the OCI context for another compartment, the copy shares the clients (created on first use by any copy)
+func (ociCtx *ociContext) withCompartment(name string, id string, path string) *ociContext {
+	compartmentCtx := *ociCtx
+	compartmentCtx.Compartment = name
+	compartmentCtx.CompartmentId = id
+	compartmentCtx.CompartmentPath = path
+
+	return &compartmentCtx
+}
@@ -1,84 +1,129 @@
 package cmd
 
 import (
-	"fmt"
 	"os"
 
 	"github.com/cnopslabs/oshiv/internal/resources"
 	"github.com/cnopslabs/oshiv/internal/utils"
 	"github.com/oracle/oci-go-sdk/v65/bastion"
-	"github.com/oracle/oci-go-sdk/v65/identity"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var sessionCmd = &cobra.Command{
-	Use:   "session",
-	Short: "List bastion sessions",
-	Long:  "List bastion sessions",
-	Run: func(cmd *cobra.Command, args []string) {
-		identityClient, identityErr := identity.NewIdentityClientWithConfigurationProvider(utils.OciConfig())
-		utils.CheckError(identityErr)
-
-		// Read tenancy ID flag and calculate tenancy
-		FlagTenancyId := rootCmd.Flags().Lookup("tenancy-id")
-		utils.SetTenancyConfig(FlagTenancyId, utils.OciConfig())
-		tenancyId := viper.GetString("tenancy-id")
-		tenancyName := viper.GetString("tenancy-name")
-
-		// Read compartment flag and add to Viper config
-		FlagCompartment := rootCmd.Flags().Lookup("compartment")
-		compartments := resources.FetchCompartments(tenancyId, identityClient)
-		utils.SetCompartmentConfig(FlagCompartment, compartments, tenancyName)
-		compartment := viper.GetString("compartment")
-
-		compartmentId := resources.LookupCompartmentId(compartments, tenancyId, tenancyName, compartment)
-
-		bastionClient, err := bastion.NewBastionClientWithConfigurationProvider(utils.OciConfig())
-		utils.CheckError(err)
-
-		region, envVarExists := os.LookupEnv("OCI_CLI_REGION")
-		if envVarExists {
-			identityClient.SetRegion(region)
-			bastionClient.SetRegion(region)
+	Use:         "session",
+	Short:       "List and manage bastion sessions",
+	Long:        "List and manage bastion sessions",
+	Annotations: compartmentAnnotations,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ociCtx := getOciContext(cmd)
+
+		bastionClient, bastionId, err := sessionBastion(cmd)
+		if err != nil {
+			return err
 		}
 
-		bastions := resources.FetchBastions(compartmentId, bastionClient)
+		flagListActiveBastionSessions, _ := cmd.Flags().GetBool("list")
+		flagListAllBastionSessions, _ := cmd.Flags().GetBool("list-all")
+
+		if flagListAllBastionSessions {
+			return resources.ListBastionSessions(bastionClient, bastionId, ociCtx.TenancyName, ociCtx.Compartment, false)
+		} else if flagListActiveBastionSessions {
+			return resources.ListBastionSessions(bastionClient, bastionId, ociCtx.TenancyName, ociCtx.Compartment, flagListActiveBastionSessions)
+		}
+
+		return nil
+	},
+}
+
+var sessionDeleteCmd = &cobra.Command{
+	Use:         "delete SESSION_ID|SESSION_NAME",
+	Short:       "Delete a bastion session by ID or name",
+	Long:        "Delete a bastion session by ID or name",
+	Args:        cobra.ExactArgs(1),
+	Annotations: compartmentAnnotations,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bastionClient, bastionId, err := sessionBastion(cmd)
+		if err != nil {
+			return err
+		}
+
+		return resources.DeleteBastionSession(bastionClient, bastionId, args[0])
+	},
+}
 
-		bastionNameFromFlag, _ := cmd.Flags().GetString("bastion-name")
+var sessionPruneCmd = &cobra.Command{
+	Use:         "prune",
+	Short:       "Delete oshiv sessions created with your key or older than a threshold",
+	Long:        "Delete oshiv created (oshiv- prefixed) bastion sessions that use your SSH public key or are older than --older-than. Sessions are only matched by key if --public-key is passed or --older-than isn't, with both a session matching either one is deleted",
+	Annotations: compartmentAnnotations,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		bastionClient, bastionId, err := sessionBastion(cmd)
+		if err != nil {
+			return err
+		}
 
-		var bastionName string
-		if bastionNameFromFlag == "" {
-			uniqueBastionName, _ := resources.CheckForUniqueBastion(bastions)
+		flagPublicKey, _ := cmd.Flags().GetString("public-key")
+		flagOlderThan, _ := cmd.Flags().GetDuration("older-than")
+		flagDryRun, _ := cmd.Flags().GetBool("dry-run")
 
-			if uniqueBastionName != "" {
-				bastionName = uniqueBastionName
+		// The default key only applies without --older-than, otherwise every session created with it would be deleted regardless of age
+		var publicKeyContent string
+		if cmd.Flags().Changed("public-key") || flagOlderThan == 0 {
+			content, err := os.ReadFile(flagPublicKey)
+			if err == nil {
+				publicKeyContent = string(content)
 			} else {
-				fmt.Print("\nMust specify bastion flag: ")
-				utils.Yellow.Println("-b BASTION_NAME")
-				os.Exit(1)
+				utils.Faint.Fprintln(os.Stderr, "Unable to read public key "+flagPublicKey+", only pruning by age")
 			}
-		} else {
-			bastionName = bastionNameFromFlag
 		}
 
-		bastionId := bastions[bastionName]
+		if publicKeyContent == "" && flagOlderThan == 0 {
+			return utils.UsageError("nothing to prune by, pass --public-key or --older-than")
+		}
 
-		flagListActiveBastionSessions, _ := cmd.Flags().GetBool("list")
-		flagListAllBastionSessions, _ := cmd.Flags().GetBool("list-all")
+		// Print the sessions deleted before a failed delete too
+		sessions, pruneErr := resources.PruneBastionSessions(bastionClient, bastionId, publicKeyContent, flagOlderThan, flagDryRun)
+		if pruneErr != nil && len(sessions) == 0 {
+			return pruneErr
+		}
 
-		if flagListAllBastionSessions {
-			resources.ListBastionSessions(bastionClient, bastionId, tenancyName, compartment, false)
-		} else if flagListActiveBastionSessions {
-			resources.ListBastionSessions(bastionClient, bastionId, tenancyName, compartment, flagListActiveBastionSessions)
+		err = resources.PrintPrunedSessions(sessions, flagDryRun)
+		if err != nil {
+			return err
 		}
+
+		return pruneErr
 	},
 }
 
+// Determine which bastion session commands apply to
+func sessionBastion(cmd *cobra.Command) (*bastion.BastionClient, string, error) {
+	ociCtx := getOciContext(cmd)
+
+	bastionClient, err := ociCtx.BastionClient()
+	if err != nil {
+		return bastionClient, "", err
+	}
+
+	b, err := selectBastion(bastionClient, ociCtx.CompartmentId, contextFlag(cmd, "bastion-name", "bastion"), nil)
+	if err != nil {
+		return bastionClient, "", err
+	}
+
+	return bastionClient, b.Id, nil
+}
+
 func init() {
 	bastionCmd.AddCommand(sessionCmd)
+	sessionCmd.AddCommand(sessionDeleteCmd)
+	sessionCmd.AddCommand(sessionPruneCmd)
 
-	sessionCmd.Flags().StringP("bastion-name", "b", "", "Bastion name to use for session commands")
+	sessionCmd.PersistentFlags().StringP("bastion-name", "b", "", "Bastion name to use for session commands")
 	sessionCmd.Flags().BoolP("list-all", "a", false, "List all bastion sessions")
 	sessionCmd.Flags().BoolP("list", "l", true, "List active bastion sessions")
+
+	_, defaultPublicKeyPath := defaultSshKeyPaths()
+	sessionPruneCmd.Flags().StringP("public-key", "e", defaultPublicKeyPath, "Prune sessions created with this SSH public key (the default key is only used without --older-than)")
+	sessionPruneCmd.Flags().DurationP("older-than", "m", 0, "Prune sessions older than this duration regardless of key (E.g. 2h), sessions matching --public-key are pruned too if it is passed")
+	sessionPruneCmd.Flags().Bool("dry-run", false, "Print sessions that would be deleted without deleting them")
 }
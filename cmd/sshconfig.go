@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/cnopslabs/oshiv/internal/resources"
+	"github.com/cnopslabs/oshiv/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var sshConfigCmd = &cobra.Command{
+	Use:         "ssh-config",
+	Short:       "Generate an ssh_config include file for active bastion sessions",
+	Long:        "Generate an ssh_config include file with a Host entry for every active oshiv managed SSH session, so plain ssh, scp, and VS Code Remote-SSH work by instance name",
+	Annotations: compartmentAnnotations,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ociCtx := getOciContext(cmd)
+
+		bastionClient, err := ociCtx.BastionClient()
+		if err != nil {
+			return err
+		}
+
+		flagSshPrivateKey, _ := cmd.Flags().GetString("private-key")
+		flagSshPublicKey, _ := cmd.Flags().GetString("public-key")
+		flagFile, _ := cmd.Flags().GetString("file")
+
+		// Without a readable public key, sessions are not filtered by key
+		var publicKeyContent string
+		content, err := os.ReadFile(flagSshPublicKey)
+		if err == nil {
+			publicKeyContent = string(content)
+		}
+
+		bastions, err := resources.FetchBastions(ociCtx.CompartmentId, bastionClient)
+		if err != nil {
+			return err
+		}
+
+		ociCtx.printTenancyCompartment()
+		return resources.WriteSshConfig(bastionClient, bastions, flagSshPrivateKey, publicKeyContent, flagFile)
+	},
+}
+
+func init() {
+	bastionCmd.AddCommand(sshConfigCmd)
+
+	defaultPrivateKeyPath, defaultPublicKeyPath := defaultSshKeyPaths()
+	defaultConfigPath := filepath.Join(utils.HomeDir(), ".ssh", "config.d", "oshiv")
+
+	sshConfigCmd.Flags().StringP("private-key", "a", defaultPrivateKeyPath, "Path to SSH private key (identity file) used by the generated entries")
+	sshConfigCmd.Flags().StringP("public-key", "e", defaultPublicKeyPath, "Only include sessions created with this SSH public key")
+	sshConfigCmd.Flags().StringP("file", "o", defaultConfigPath, "Path of the generated ssh_config include file")
+}
@@ -1,60 +1,61 @@
 package cmd
 
 import (
-	"fmt"
 	"os"
 
 	"github.com/cnopslabs/oshiv/internal/resources"
 	"github.com/cnopslabs/oshiv/internal/utils"
-	"github.com/oracle/oci-go-sdk/v65/core"
-	"github.com/oracle/oci-go-sdk/v65/identity"
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 var subnetCmd = &cobra.Command{
-	Use:   "subnet",
-	Short: "Find and list subnets",
-	Long:  "Find and list subnets",
-	Run: func(cmd *cobra.Command, args []string) {
-		identityClient, identityErr := identity.NewIdentityClientWithConfigurationProvider(utils.OciConfig())
-		utils.CheckError(identityErr)
+	Use:         "subnet",
+	Short:       "Find and list subnets",
+	Long:        "Find and list subnets",
+	Annotations: listAnnotations,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ociCtx := getOciContext(cmd)
 
-		// Read tenancy ID flag and calculate tenancy
-		FlagTenancyId := rootCmd.Flags().Lookup("tenancy-id")
-		utils.SetTenancyConfig(FlagTenancyId, utils.OciConfig())
-		tenancyId := viper.GetString("tenancy-id")
-		tenancyName := viper.GetString("tenancy-name")
+		flagList, _ := cmd.Flags().GetBool("list")
+		flagFind, _ := cmd.Flags().GetString("find")
+		show := resultScope(cmd)
 
-		// Read compartment flag and add to Viper config
-		FlagCompartment := rootCmd.Flags().Lookup("compartment")
-		compartments := resources.FetchCompartments(tenancyId, identityClient)
-		utils.SetCompartmentConfig(FlagCompartment, compartments, tenancyName)
-		compartment := viper.GetString("compartment")
+		if !flagList && flagFind == "" {
+			return utils.UsageError("invalid flag or flag arguments")
+		}
 
-		compartmentId := resources.LookupCompartmentId(compartments, tenancyId, tenancyName, compartment)
+		if !flagList {
+			// TODO: implement find
+			utils.Faint.Fprintln(os.Stderr, "Subnet search is not yet enabled, listing all subnets. Use grep!")
+		}
 
-		vnetClient, err := core.NewVirtualNetworkClientWithConfigurationProvider(utils.OciConfig())
-		utils.CheckError(err)
+		subnets, err := fetchScopes(cmd, ociCtx, func(scope *ociContext) ([]resources.Subnet, error) {
+			vnetClient, err := scope.VirtualNetworkClient()
+			if err != nil {
+				return nil, err
+			}
 
-		region, envVarExists := os.LookupEnv("OCI_CLI_REGION")
-		if envVarExists {
-			identityClient.SetRegion(region)
-			vnetClient.SetRegion(region)
-		}
+			subnets, err := resources.FetchSubnets(vnetClient, scope.CompartmentId)
+			if err != nil {
+				return nil, err
+			}
 
-		flagList, _ := cmd.Flags().GetBool("list")
-		flagFind, _ := cmd.Flags().GetString("find")
+			for i := range subnets {
+				if show.ShowRegion {
+					subnets[i].Region = scope.Region
+				}
+				if show.ShowCompartment {
+					subnets[i].Compartment = scope.CompartmentPath
+				}
+			}
 
-		if flagList {
-			resources.ListSubnets(vnetClient, compartmentId)
-		} else if flagFind != "" {
-			// TODO: implement find
-			fmt.Println("Subnet search is not yet enabled, listing all subnets. Use grep!")
-			resources.ListSubnets(vnetClient, compartmentId)
-		} else {
-			fmt.Println("Invalid flag or flag arguments")
+			return subnets, nil
+		})
+		if err != nil {
+			return err
 		}
+
+		return resources.PrintSubnets(subnets, show)
 	},
 }
 
@@ -63,4 +64,6 @@ func init() {
 
 	subnetCmd.Flags().BoolP("list", "l", false, "List all subnets")
 	subnetCmd.Flags().StringP("find", "f", "", "Find subnet by name pattern search")
+	subnetCmd.Flags().Bool("all-regions", false, "Search all subscribed regions")
+	subnetCmd.Flags().Bool("recursive", false, "Search all compartments nested under the compartment")
 }
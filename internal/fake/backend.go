@@ -0,0 +1,202 @@
+// Fake OCI backend for offline tests, implements the client interfaces of the resources package
+// Responses are served from fixture data (fixtures/tenancy.json, SDK JSON format) and paginated like OCI
+package fake
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v65/bastion"
+	"github.com/oracle/oci-go-sdk/v65/containerengine"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/database"
+	"github.com/oracle/oci-go-sdk/v65/identity"
+)
+
+// Service endpoint of the fake backend, part of cache keys like a region's endpoint
+const Endpoint = "https://fake.us-ashburn-1.oraclecloud.com"
+
+// Fixture IDs referenced by tests
+const (
+	TenancyId     = "ocid1.tenancy.oc1..fake"
+	CompartmentId = "ocid1.compartment.oc1..prod"
+	BastionId     = "ocid1.bastion.oc1.iad.prod"
+)
+
+//go:embed fixtures/tenancy.json
+var tenancyFixture []byte
+
+// OCI resources served by the fake backend, in SDK JSON format
+type Fixture struct {
+	Tenancy             identity.Tenancy                     `json:"tenancy"`
+	RegionSubscriptions []identity.RegionSubscription        `json:"regionSubscriptions"`
+	Compartments        []identity.Compartment               `json:"compartments"`
+	Policies            []identity.Policy                    `json:"policies"`
+	Instances           []core.Instance                      `json:"instances"`
+	VnicAttachments     []core.VnicAttachment                `json:"vnicAttachments"`
+	Vnics               []core.Vnic                          `json:"vnics"`
+	PrivateIps          []core.PrivateIp                     `json:"privateIps"`
+	Subnets             []core.Subnet                        `json:"subnets"`
+	Vcns                []core.Vcn                           `json:"vcns"`
+	Images              []core.Image                         `json:"images"`
+	Clusters            []containerengine.ClusterSummary     `json:"clusters"`
+	AutonomousDatabases []database.AutonomousDatabaseSummary `json:"autonomousDatabases"`
+	Bastions            []bastion.Bastion                    `json:"bastions"`
+	Sessions            []bastion.Session                    `json:"sessions"`
+}
+
+// Fake OCI backend, safe for concurrent use
+// Fixture data may be changed by tests before the backend is used
+type Backend struct {
+	Fixture
+
+	// Items per page of list calls, zero for a single page (a smaller request limit takes precedence)
+	PageSize int
+
+	// Errors returned by operations, by operation name (E.g. "ListInstances")
+	Errors map[string]error
+
+	// Creation time of resources created by operations (E.g. CreateSession), the current time if nil
+	Now func() time.Time
+
+	// Lifecycle state of sessions created by CreateSession, ACTIVE if empty (E.g. CREATING for sessions that never become active)
+	SessionState bastion.SessionLifecycleStateEnum
+
+	mu          sync.Mutex
+	calls       map[string]int
+	requests    []any
+	transitions map[string]core.InstanceLifecycleStateEnum // Target states of instances in a transitional state, by instance ID
+}
+
+// Create a fake backend serving the default fixture (fixtures/tenancy.json)
+func New() (*Backend, error) {
+	backend := &Backend{Errors: make(map[string]error), calls: make(map[string]int), transitions: make(map[string]core.InstanceLifecycleStateEnum)}
+
+	err := json.Unmarshal(tenancyFixture, &backend.Fixture)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse fixture: %w", err)
+	}
+
+	return backend, nil
+}
+
+// OCI service error returned by the fake backend (implements common.ServiceError)
+type ServiceError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (err ServiceError) Error() string {
+	return fmt.Sprintf("Error returned by fake OCI service. Http Status Code: %d. Error Code: %s. Message: %s", err.StatusCode, err.Code, err.Message)
+}
+
+func (err ServiceError) GetHTTPStatusCode() int  { return err.StatusCode }
+func (err ServiceError) GetMessage() string      { return err.Message }
+func (err ServiceError) GetCode() string         { return err.Code }
+func (err ServiceError) GetOpcRequestID() string { return "fake" }
+
+// Return a 404 service error for a resource that doesn't exist
+func notFound(resource string, id *string) error {
+	return ServiceError{404, "NotAuthorizedOrNotFound", resource + " " + value(id) + " not found"}
+}
+
+// Return the number of calls of an operation (E.g. "ListInstances")
+func (backend *Backend) Calls(operation string) int {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	return backend.calls[operation]
+}
+
+// Return the requests received, in order (E.g. core.ListInstancesRequest)
+func (backend *Backend) Requests() []any {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+
+	return append([]any(nil), backend.requests...)
+}
+
+// Record a call and return the error configured for the operation, if any
+// The backend is locked until unlock is called
+func (backend *Backend) call(operation string, request any) (unlock func(), err error) {
+	backend.mu.Lock()
+
+	backend.calls[operation]++
+	backend.requests = append(backend.requests, request)
+
+	return backend.mu.Unlock, backend.Errors[operation]
+}
+
+// Return the creation time of a new resource (see Now)
+func (backend *Backend) now() time.Time {
+	if backend.Now != nil {
+		return backend.Now()
+	}
+
+	return time.Now()
+}
+
+// Return a page of items and the next page token, pages are item offsets
+func paginate[T any](backend *Backend, items []T, page *string, limit *int) ([]T, *string, error) {
+	start := 0
+	if page != nil {
+		var err error
+		start, err = strconv.Atoi(*page)
+		if err != nil || start < 0 || start > len(items) {
+			return nil, nil, ServiceError{400, "InvalidParameter", "invalid page " + *page}
+		}
+	}
+
+	size := backend.PageSize
+	if limit != nil && *limit > 0 && (size == 0 || *limit < size) {
+		size = *limit
+	}
+
+	end := len(items)
+	if size > 0 && start+size < end {
+		end = start + size
+	}
+
+	var nextPage *string
+	if end < len(items) {
+		next := strconv.Itoa(end)
+		nextPage = &next
+	}
+
+	return items[start:end], nextPage, nil
+}
+
+// Return items for which match returns true
+func filter[T any](items []T, match func(item T) bool) []T {
+	var matches []T
+	for _, item := range items {
+		if match(item) {
+			matches = append(matches, item)
+		}
+	}
+
+	return matches
+}
+
+// Return the value of an optional string, empty if nil
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
+
+// Return true if an optional filter is unset or equal to a value
+func matches(filter *string, s *string) bool {
+	return filter == nil || value(filter) == value(s)
+}
+
+func (backend *Backend) Endpoint() string {
+	return Endpoint
+}
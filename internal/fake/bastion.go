@@ -0,0 +1,211 @@
+package fake
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/oracle/oci-go-sdk/v65/bastion"
+	"github.com/oracle/oci-go-sdk/v65/common"
+)
+
+func (backend *Backend) ListBastions(ctx context.Context, request bastion.ListBastionsRequest) (bastion.ListBastionsResponse, error) {
+	unlock, err := backend.call("ListBastions", request)
+	defer unlock()
+	if err != nil {
+		return bastion.ListBastionsResponse{}, err
+	}
+
+	var bastions []bastion.BastionSummary
+	for _, item := range backend.Bastions {
+		if !matches(request.CompartmentId, item.CompartmentId) || !matches(request.BastionId, item.Id) || !matches(request.Name, item.Name) {
+			continue
+		}
+
+		// Allowed CIDRs and max session TTL are only returned by GetBastion, like OCI
+		bastions = append(bastions, bastion.BastionSummary{
+			BastionType:    item.BastionType,
+			Id:             item.Id,
+			Name:           item.Name,
+			CompartmentId:  item.CompartmentId,
+			TargetVcnId:    item.TargetVcnId,
+			TargetSubnetId: item.TargetSubnetId,
+			TimeCreated:    item.TimeCreated,
+			LifecycleState: item.LifecycleState,
+			DnsProxyStatus: item.DnsProxyStatus,
+		})
+	}
+
+	items, nextPage, err := paginate(backend, bastions, request.Page, request.Limit)
+	return bastion.ListBastionsResponse{Items: items, OpcNextPage: nextPage}, err
+}
+
+func (backend *Backend) GetBastion(ctx context.Context, request bastion.GetBastionRequest) (bastion.GetBastionResponse, error) {
+	unlock, err := backend.call("GetBastion", request)
+	defer unlock()
+	if err != nil {
+		return bastion.GetBastionResponse{}, err
+	}
+
+	for _, item := range backend.Bastions {
+		if value(item.Id) == value(request.BastionId) {
+			return bastion.GetBastionResponse{Bastion: item}, nil
+		}
+	}
+
+	return bastion.GetBastionResponse{}, notFound("bastion", request.BastionId)
+}
+
+func (backend *Backend) ListSessions(ctx context.Context, request bastion.ListSessionsRequest) (bastion.ListSessionsResponse, error) {
+	unlock, err := backend.call("ListSessions", request)
+	defer unlock()
+	if err != nil {
+		return bastion.ListSessionsResponse{}, err
+	}
+
+	var sessions []bastion.SessionSummary
+	for _, session := range backend.Sessions {
+		if !matches(request.BastionId, session.BastionId) || !matches(request.SessionId, session.Id) || !matches(request.DisplayName, session.DisplayName) {
+			continue
+		}
+		if request.SessionLifecycleState != "" && string(request.SessionLifecycleState) != string(session.LifecycleState) {
+			continue
+		}
+
+		// Key details are only returned by GetSession, like OCI
+		sessions = append(sessions, bastion.SessionSummary{
+			Id:                    session.Id,
+			BastionName:           session.BastionName,
+			BastionId:             session.BastionId,
+			TargetResourceDetails: session.TargetResourceDetails,
+			TimeCreated:           session.TimeCreated,
+			LifecycleState:        session.LifecycleState,
+			SessionTtlInSeconds:   session.SessionTtlInSeconds,
+			DisplayName:           session.DisplayName,
+		})
+	}
+
+	items, nextPage, err := paginate(backend, sessions, request.Page, request.Limit)
+	return bastion.ListSessionsResponse{Items: items, OpcNextPage: nextPage}, err
+}
+
+func (backend *Backend) GetSession(ctx context.Context, request bastion.GetSessionRequest) (bastion.GetSessionResponse, error) {
+	unlock, err := backend.call("GetSession", request)
+	defer unlock()
+	if err != nil {
+		return bastion.GetSessionResponse{}, err
+	}
+
+	for _, session := range backend.Sessions {
+		if value(session.Id) == value(request.SessionId) {
+			return bastion.GetSessionResponse{Session: session}, nil
+		}
+	}
+
+	return bastion.GetSessionResponse{}, notFound("session", request.SessionId)
+}
+
+// Sessions are created ACTIVE (or SessionState), OCI creates them CREATING and activates them after a while
+func (backend *Backend) CreateSession(ctx context.Context, request bastion.CreateSessionRequest) (bastion.CreateSessionResponse, error) {
+	unlock, err := backend.call("CreateSession", request)
+	defer unlock()
+	if err != nil {
+		return bastion.CreateSessionResponse{}, err
+	}
+
+	details := request.CreateSessionDetails
+
+	var bastionName *string
+	for _, item := range backend.Bastions {
+		if value(item.Id) == value(details.BastionId) {
+			bastionName = item.Name
+		}
+	}
+	if bastionName == nil {
+		return bastion.CreateSessionResponse{}, notFound("bastion", details.BastionId)
+	}
+
+	targetResourceDetails, err := backend.sessionTarget(details.TargetResourceDetails)
+	if err != nil {
+		return bastion.CreateSessionResponse{}, err
+	}
+
+	ttl := details.SessionTtlInSeconds
+	if ttl == nil {
+		ttl = common.Int(10800)
+	}
+
+	sessionId := "ocid1.bastionsession.oc1.iad.fake" + strconv.Itoa(len(backend.Sessions)+1)
+
+	state := backend.SessionState
+	if state == "" {
+		state = bastion.SessionLifecycleStateActive
+	}
+
+	session := bastion.Session{
+		Id:                    &sessionId,
+		BastionId:             details.BastionId,
+		BastionName:           bastionName,
+		TargetResourceDetails: targetResourceDetails,
+		KeyDetails:            details.KeyDetails,
+		TimeCreated:           &common.SDKTime{Time: backend.now()},
+		LifecycleState:        state,
+		SessionTtlInSeconds:   ttl,
+		DisplayName:           details.DisplayName,
+		BastionUserName:       &sessionId,
+	}
+	backend.Sessions = append(backend.Sessions, session)
+
+	return bastion.CreateSessionResponse{Session: session}, nil
+}
+
+// Convert the target of a session request to the target of the session, like OCI
+func (backend *Backend) sessionTarget(target bastion.CreateSessionTargetResourceDetails) (bastion.TargetResourceDetails, error) {
+	switch target := target.(type) {
+	case bastion.CreateManagedSshSessionTargetResourceDetails:
+		details := bastion.ManagedSshSessionTargetResourceDetails{
+			TargetResourceOperatingSystemUserName: target.TargetResourceOperatingSystemUserName,
+			TargetResourceId:                      target.TargetResourceId,
+			TargetResourcePrivateIpAddress:        target.TargetResourcePrivateIpAddress,
+			TargetResourcePort:                    target.TargetResourcePort,
+		}
+		for _, instance := range backend.Instances {
+			if value(instance.Id) == value(target.TargetResourceId) {
+				details.TargetResourceDisplayName = instance.DisplayName
+			}
+		}
+		if details.TargetResourceDisplayName == nil {
+			return nil, notFound("instance", target.TargetResourceId)
+		}
+		return details, nil
+	case bastion.CreatePortForwardingSessionTargetResourceDetails:
+		return bastion.PortForwardingSessionTargetResourceDetails{
+			TargetResourceId:               target.TargetResourceId,
+			TargetResourcePrivateIpAddress: target.TargetResourcePrivateIpAddress,
+			TargetResourceFqdn:             target.TargetResourceFqdn,
+			TargetResourcePort:             target.TargetResourcePort,
+		}, nil
+	case bastion.PortForwardingSessionTargetResourceDetails:
+		return target, nil
+	case bastion.CreateDynamicPortForwardingSessionTargetResourceDetails:
+		return bastion.DynamicPortForwardingSessionTargetResourceDetails{}, nil
+	}
+
+	return nil, ServiceError{400, "InvalidParameter", "unsupported session target resource details"}
+}
+
+func (backend *Backend) DeleteSession(ctx context.Context, request bastion.DeleteSessionRequest) (bastion.DeleteSessionResponse, error) {
+	unlock, err := backend.call("DeleteSession", request)
+	defer unlock()
+	if err != nil {
+		return bastion.DeleteSessionResponse{}, err
+	}
+
+	for i := range backend.Sessions {
+		if value(backend.Sessions[i].Id) == value(request.SessionId) {
+			backend.Sessions[i].LifecycleState = bastion.SessionLifecycleStateDeleted
+			return bastion.DeleteSessionResponse{}, nil
+		}
+	}
+
+	return bastion.DeleteSessionResponse{}, notFound("session", request.SessionId)
+}
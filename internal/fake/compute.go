@@ -0,0 +1,145 @@
+package fake
+
+import (
+	"context"
+
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+func (backend *Backend) ListInstances(ctx context.Context, request core.ListInstancesRequest) (core.ListInstancesResponse, error) {
+	unlock, err := backend.call("ListInstances", request)
+	defer unlock()
+	if err != nil {
+		return core.ListInstancesResponse{}, err
+	}
+
+	instances := filter(backend.Instances, func(instance core.Instance) bool {
+		return matches(request.CompartmentId, instance.CompartmentId) &&
+			(request.LifecycleState == "" || request.LifecycleState == instance.LifecycleState)
+	})
+
+	items, nextPage, err := paginate(backend, instances, request.Page, request.Limit)
+	return core.ListInstancesResponse{Items: items, OpcNextPage: nextPage}, err
+}
+
+func (backend *Backend) ListVnicAttachments(ctx context.Context, request core.ListVnicAttachmentsRequest) (core.ListVnicAttachmentsResponse, error) {
+	unlock, err := backend.call("ListVnicAttachments", request)
+	defer unlock()
+	if err != nil {
+		return core.ListVnicAttachmentsResponse{}, err
+	}
+
+	attachments := filter(backend.VnicAttachments, func(attachment core.VnicAttachment) bool {
+		return matches(request.CompartmentId, attachment.CompartmentId) && matches(request.InstanceId, attachment.InstanceId)
+	})
+
+	items, nextPage, err := paginate(backend, attachments, request.Page, request.Limit)
+	return core.ListVnicAttachmentsResponse{Items: items, OpcNextPage: nextPage}, err
+}
+
+func (backend *Backend) ListImages(ctx context.Context, request core.ListImagesRequest) (core.ListImagesResponse, error) {
+	unlock, err := backend.call("ListImages", request)
+	defer unlock()
+	if err != nil {
+		return core.ListImagesResponse{}, err
+	}
+
+	images := filter(backend.Images, func(image core.Image) bool {
+		return matches(request.CompartmentId, image.CompartmentId)
+	})
+
+	items, nextPage, err := paginate(backend, images, request.Page, request.Limit)
+	return core.ListImagesResponse{Items: items, OpcNextPage: nextPage}, err
+}
+
+func (backend *Backend) GetImage(ctx context.Context, request core.GetImageRequest) (core.GetImageResponse, error) {
+	unlock, err := backend.call("GetImage", request)
+	defer unlock()
+	if err != nil {
+		return core.GetImageResponse{}, err
+	}
+
+	for _, image := range backend.Images {
+		if value(image.Id) == value(request.ImageId) {
+			return core.GetImageResponse{Image: image}, nil
+		}
+	}
+
+	return core.GetImageResponse{}, notFound("image", request.ImageId)
+}
+
+// Instances in a transitional state (E.g. STOPPING) reach the action's target state on the next GetInstance
+func (backend *Backend) GetInstance(ctx context.Context, request core.GetInstanceRequest) (core.GetInstanceResponse, error) {
+	unlock, err := backend.call("GetInstance", request)
+	defer unlock()
+	if err != nil {
+		return core.GetInstanceResponse{}, err
+	}
+
+	for i := range backend.Instances {
+		instance := &backend.Instances[i]
+		if value(instance.Id) == value(request.InstanceId) {
+			if targetState, ok := backend.transitions[*instance.Id]; ok {
+				instance.LifecycleState = targetState
+				delete(backend.transitions, *instance.Id)
+			}
+			return core.GetInstanceResponse{Instance: *instance}, nil
+		}
+	}
+
+	return core.GetInstanceResponse{}, notFound("instance", request.InstanceId)
+}
+
+// Power actions move instances to a transitional state like OCI, actions that don't apply to the instance's state fail with 409 IncorrectState
+// Starting a running instance or stopping a stopped one doesn't change it
+func (backend *Backend) InstanceAction(ctx context.Context, request core.InstanceActionRequest) (core.InstanceActionResponse, error) {
+	unlock, err := backend.call("InstanceAction", request)
+	defer unlock()
+	if err != nil {
+		return core.InstanceActionResponse{}, err
+	}
+
+	for i := range backend.Instances {
+		instance := &backend.Instances[i]
+		if value(instance.Id) != value(request.InstanceId) {
+			continue
+		}
+
+		state := instance.LifecycleState
+		var transitionalState, targetState core.InstanceLifecycleStateEnum
+
+		switch request.Action {
+		case core.InstanceActionActionStart:
+			if state == core.InstanceLifecycleStateRunning || state == core.InstanceLifecycleStateStarting {
+				return core.InstanceActionResponse{Instance: *instance}, nil
+			}
+			if state == core.InstanceLifecycleStateStopped {
+				transitionalState, targetState = core.InstanceLifecycleStateStarting, core.InstanceLifecycleStateRunning
+			}
+		case core.InstanceActionActionStop, core.InstanceActionActionSoftstop:
+			if state == core.InstanceLifecycleStateStopped || state == core.InstanceLifecycleStateStopping {
+				return core.InstanceActionResponse{Instance: *instance}, nil
+			}
+			if state == core.InstanceLifecycleStateRunning {
+				transitionalState, targetState = core.InstanceLifecycleStateStopping, core.InstanceLifecycleStateStopped
+			}
+		case core.InstanceActionActionReset, core.InstanceActionActionSoftreset:
+			if state == core.InstanceLifecycleStateRunning {
+				transitionalState, targetState = core.InstanceLifecycleStateStopping, core.InstanceLifecycleStateRunning
+			}
+		default:
+			return core.InstanceActionResponse{}, ServiceError{400, "InvalidParameter", "unsupported action " + string(request.Action)}
+		}
+
+		if transitionalState == "" {
+			return core.InstanceActionResponse{}, ServiceError{409, "IncorrectState", "unable to " + string(request.Action) + " instance " + *instance.Id + " in state " + string(state)}
+		}
+
+		instance.LifecycleState = transitionalState
+		backend.transitions[*instance.Id] = targetState
+
+		return core.InstanceActionResponse{Instance: *instance}, nil
+	}
+
+	return core.InstanceActionResponse{}, notFound("instance", request.InstanceId)
+}
@@ -0,0 +1,22 @@
+package fake
+
+import (
+	"context"
+
+	"github.com/oracle/oci-go-sdk/v65/database"
+)
+
+func (backend *Backend) ListAutonomousDatabases(ctx context.Context, request database.ListAutonomousDatabasesRequest) (database.ListAutonomousDatabasesResponse, error) {
+	unlock, err := backend.call("ListAutonomousDatabases", request)
+	defer unlock()
+	if err != nil {
+		return database.ListAutonomousDatabasesResponse{}, err
+	}
+
+	databases := filter(backend.AutonomousDatabases, func(db database.AutonomousDatabaseSummary) bool {
+		return matches(request.CompartmentId, db.CompartmentId)
+	})
+
+	items, nextPage, err := paginate(backend, databases, request.Page, request.Limit)
+	return database.ListAutonomousDatabasesResponse{Items: items, OpcNextPage: nextPage}, err
+}
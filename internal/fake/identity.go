@@ -0,0 +1,69 @@
+package fake
+
+import (
+	"context"
+
+	"github.com/oracle/oci-go-sdk/v65/identity"
+)
+
+func (backend *Backend) GetTenancy(ctx context.Context, request identity.GetTenancyRequest) (identity.GetTenancyResponse, error) {
+	unlock, err := backend.call("GetTenancy", request)
+	defer unlock()
+	if err != nil {
+		return identity.GetTenancyResponse{}, err
+	}
+
+	if value(backend.Tenancy.Id) != value(request.TenancyId) {
+		return identity.GetTenancyResponse{}, notFound("tenancy", request.TenancyId)
+	}
+
+	return identity.GetTenancyResponse{Tenancy: backend.Tenancy}, nil
+}
+
+func (backend *Backend) ListRegionSubscriptions(ctx context.Context, request identity.ListRegionSubscriptionsRequest) (identity.ListRegionSubscriptionsResponse, error) {
+	unlock, err := backend.call("ListRegionSubscriptions", request)
+	defer unlock()
+	if err != nil {
+		return identity.ListRegionSubscriptionsResponse{}, err
+	}
+
+	if value(backend.Tenancy.Id) != value(request.TenancyId) {
+		return identity.ListRegionSubscriptionsResponse{}, notFound("tenancy", request.TenancyId)
+	}
+
+	return identity.ListRegionSubscriptionsResponse{Items: backend.RegionSubscriptions}, nil
+}
+
+// All fixture compartments are in the fixture tenancy, CompartmentIdInSubtree lists all of them
+func (backend *Backend) ListCompartments(ctx context.Context, request identity.ListCompartmentsRequest) (identity.ListCompartmentsResponse, error) {
+	unlock, err := backend.call("ListCompartments", request)
+	defer unlock()
+	if err != nil {
+		return identity.ListCompartmentsResponse{}, err
+	}
+
+	subtree := request.CompartmentIdInSubtree != nil && *request.CompartmentIdInSubtree
+
+	compartments := filter(backend.Compartments, func(compartment identity.Compartment) bool {
+		return (subtree || matches(request.CompartmentId, compartment.CompartmentId)) &&
+			(request.LifecycleState == "" || request.LifecycleState == compartment.LifecycleState)
+	})
+
+	items, nextPage, err := paginate(backend, compartments, request.Page, request.Limit)
+	return identity.ListCompartmentsResponse{Items: items, OpcNextPage: nextPage}, err
+}
+
+func (backend *Backend) ListPolicies(ctx context.Context, request identity.ListPoliciesRequest) (identity.ListPoliciesResponse, error) {
+	unlock, err := backend.call("ListPolicies", request)
+	defer unlock()
+	if err != nil {
+		return identity.ListPoliciesResponse{}, err
+	}
+
+	policies := filter(backend.Policies, func(policy identity.Policy) bool {
+		return matches(request.CompartmentId, policy.CompartmentId)
+	})
+
+	items, nextPage, err := paginate(backend, policies, request.Page, request.Limit)
+	return identity.ListPoliciesResponse{Items: items, OpcNextPage: nextPage}, err
+}
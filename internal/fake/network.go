@@ -0,0 +1,85 @@
+package fake
+
+import (
+	"context"
+
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+func (backend *Backend) ListSubnets(ctx context.Context, request core.ListSubnetsRequest) (core.ListSubnetsResponse, error) {
+	unlock, err := backend.call("ListSubnets", request)
+	defer unlock()
+	if err != nil {
+		return core.ListSubnetsResponse{}, err
+	}
+
+	subnets := filter(backend.Subnets, func(subnet core.Subnet) bool {
+		return matches(request.CompartmentId, subnet.CompartmentId) && matches(request.VcnId, subnet.VcnId)
+	})
+
+	items, nextPage, err := paginate(backend, subnets, request.Page, request.Limit)
+	return core.ListSubnetsResponse{Items: items, OpcNextPage: nextPage}, err
+}
+
+func (backend *Backend) GetSubnet(ctx context.Context, request core.GetSubnetRequest) (core.GetSubnetResponse, error) {
+	unlock, err := backend.call("GetSubnet", request)
+	defer unlock()
+	if err != nil {
+		return core.GetSubnetResponse{}, err
+	}
+
+	for _, subnet := range backend.Subnets {
+		if value(subnet.Id) == value(request.SubnetId) {
+			return core.GetSubnetResponse{Subnet: subnet}, nil
+		}
+	}
+
+	return core.GetSubnetResponse{}, notFound("subnet", request.SubnetId)
+}
+
+func (backend *Backend) GetVcn(ctx context.Context, request core.GetVcnRequest) (core.GetVcnResponse, error) {
+	unlock, err := backend.call("GetVcn", request)
+	defer unlock()
+	if err != nil {
+		return core.GetVcnResponse{}, err
+	}
+
+	for _, vcn := range backend.Vcns {
+		if value(vcn.Id) == value(request.VcnId) {
+			return core.GetVcnResponse{Vcn: vcn}, nil
+		}
+	}
+
+	return core.GetVcnResponse{}, notFound("VCN", request.VcnId)
+}
+
+func (backend *Backend) GetVnic(ctx context.Context, request core.GetVnicRequest) (core.GetVnicResponse, error) {
+	unlock, err := backend.call("GetVnic", request)
+	defer unlock()
+	if err != nil {
+		return core.GetVnicResponse{}, err
+	}
+
+	for _, vnic := range backend.Vnics {
+		if value(vnic.Id) == value(request.VnicId) {
+			return core.GetVnicResponse{Vnic: vnic}, nil
+		}
+	}
+
+	return core.GetVnicResponse{}, notFound("VNIC", request.VnicId)
+}
+
+func (backend *Backend) ListPrivateIps(ctx context.Context, request core.ListPrivateIpsRequest) (core.ListPrivateIpsResponse, error) {
+	unlock, err := backend.call("ListPrivateIps", request)
+	defer unlock()
+	if err != nil {
+		return core.ListPrivateIpsResponse{}, err
+	}
+
+	privateIps := filter(backend.PrivateIps, func(privateIp core.PrivateIp) bool {
+		return matches(request.SubnetId, privateIp.SubnetId) && matches(request.VnicId, privateIp.VnicId) && matches(request.IpAddress, privateIp.IpAddress)
+	})
+
+	items, nextPage, err := paginate(backend, privateIps, request.Page, request.Limit)
+	return core.ListPrivateIpsResponse{Items: items, OpcNextPage: nextPage}, err
+}
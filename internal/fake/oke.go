@@ -0,0 +1,22 @@
+package fake
+
+import (
+	"context"
+
+	"github.com/oracle/oci-go-sdk/v65/containerengine"
+)
+
+func (backend *Backend) ListClusters(ctx context.Context, request containerengine.ListClustersRequest) (containerengine.ListClustersResponse, error) {
+	unlock, err := backend.call("ListClusters", request)
+	defer unlock()
+	if err != nil {
+		return containerengine.ListClustersResponse{}, err
+	}
+
+	clusters := filter(backend.Clusters, func(cluster containerengine.ClusterSummary) bool {
+		return matches(request.CompartmentId, cluster.CompartmentId)
+	})
+
+	items, nextPage, err := paginate(backend, clusters, request.Page, request.Limit)
+	return containerengine.ListClustersResponse{Items: items, OpcNextPage: nextPage}, err
+}
@@ -2,16 +2,21 @@ package resources
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/url"
+	"net"
+	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cnopslabs/oshiv/internal/utils"
 	"github.com/fatih/color"
 	"github.com/oracle/oci-go-sdk/v65/bastion"
 	"github.com/oracle/oci-go-sdk/v65/common"
-	"github.com/rodaine/table"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"golang.org/x/crypto/ssh"
 )
 
 type Session struct {
@@ -21,181 +26,648 @@ type Session struct {
 	port  int
 }
 
+type Bastion struct {
+	Name           string                            `json:"name" yaml:"name"`
+	Id             string                            `json:"id" yaml:"id"`
+	TargetVcnId    string                            `json:"target_vcn_id" yaml:"target_vcn_id"`
+	TargetSubnetId string                            `json:"target_subnet_id" yaml:"target_subnet_id"`
+	ClientCidrs    []string                          `json:"client_cidrs" yaml:"client_cidrs"`
+	MaxSessionTtl  int                               `json:"max_session_ttl" yaml:"max_session_ttl"`
+	DnsProxy       bool                              `json:"dns_proxy" yaml:"dns_proxy"`
+	State          bastion.BastionLifecycleStateEnum `json:"state" yaml:"state"`
+}
+
+// Bastion session as listed by oshiv bastion session
+type BastionSession struct {
+	Name        string    `json:"name" yaml:"name"`
+	Id          string    `json:"id" yaml:"id"`
+	State       string    `json:"state" yaml:"state"`
+	Type        string    `json:"type" yaml:"type"`
+	InstanceId  string    `json:"instance_id,omitempty" yaml:"instance_id,omitempty"`
+	TargetIp    string    `json:"target_ip,omitempty" yaml:"target_ip,omitempty"`
+	TargetPort  int       `json:"target_port,omitempty" yaml:"target_port,omitempty"`
+	TimeCreated time.Time `json:"time_created" yaml:"time_created"`
+}
+
+// Bastion session deleted (or to be deleted) by prune, and why
+type PrunedSession struct {
+	Name        string    `json:"name" yaml:"name"`
+	Id          string    `json:"id" yaml:"id"`
+	State       string    `json:"state" yaml:"state"`
+	TimeCreated time.Time `json:"time_created" yaml:"time_created"`
+	Reason      string    `json:"reason" yaml:"reason"`
+}
+
 // Fetch all bastions via OCI API call
-func FetchBastions(compartmentId string, client bastion.BastionClient) map[string]string {
-	response, err := client.ListBastions(context.Background(), bastion.ListBastionsRequest{CompartmentId: &compartmentId})
-	utils.CheckError(err)
+// Allowed CIDRs and max session TTL are only returned by GetBastion, look them up with FetchBastionDetails
+func FetchBastions(compartmentId string, client BastionClient) ([]Bastion, error) {
+	var bastions []Bastion
+
+	request := bastion.ListBastionsRequest{CompartmentId: &compartmentId}
+	for {
+		response, err := client.ListBastions(context.Background(), request)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list bastions: %w", err)
+		}
 
-	bastions := make(map[string]string)
+		for _, item := range response.Items {
+			if item.LifecycleState == bastion.BastionLifecycleStateDeleted {
+				continue
+			}
 
-	for _, item := range response.Items {
-		bastions[*item.Name] = *item.Id
+			b := Bastion{
+				Name:     *item.Name,
+				Id:       *item.Id,
+				DnsProxy: item.DnsProxyStatus == bastion.BastionDnsProxyStatusEnabled,
+				State:    item.LifecycleState,
+			}
+			if item.TargetVcnId != nil {
+				b.TargetVcnId = *item.TargetVcnId
+			}
+			if item.TargetSubnetId != nil {
+				b.TargetSubnetId = *item.TargetSubnetId
+			}
+			bastions = append(bastions, b)
+		}
+
+		if response.OpcNextPage == nil {
+			break
+		}
+		request.Page = response.OpcNextPage
 	}
 
-	return bastions
+	sort.Slice(bastions, func(i, j int) bool { return bastions[i].Name < bastions[j].Name })
+
+	return bastions, nil
+}
+
+// Lookup the allowed CIDRs and max session TTL of a bastion via OCI API call
+func FetchBastionDetails(client BastionClient, b Bastion) (Bastion, error) {
+	response, err := client.GetBastion(context.Background(), bastion.GetBastionRequest{BastionId: &b.Id})
+	if err != nil {
+		return b, fmt.Errorf("unable to get bastion %s: %w", b.Name, err)
+	}
+
+	b.ClientCidrs = response.ClientCidrBlockAllowList
+	if response.MaxSessionTtlInSeconds != nil {
+		b.MaxSessionTtl = *response.MaxSessionTtlInSeconds
+	}
+	b.DnsProxy = response.DnsProxyStatus == bastion.BastionDnsProxyStatusEnabled
+
+	return b, nil
+}
+
+// Lookup bastion by name or OCID
+func LookupBastion(bastions []Bastion, nameOrId string) (Bastion, bool) {
+	for _, b := range bastions {
+		if b.Name == nameOrId || b.Id == nameOrId {
+			return b, true
+		}
+	}
+
+	return Bastion{}, false
+}
+
+// Find the bastions able to reach a target
+// Bastions targeting the same subnet are preferred, then bastions whose target VCN contains the target subnet or IP
+func SelectBastionsForTarget(vnetClient VirtualNetworkClient, bastions []Bastion, targetIp string, targetSubnetId string) ([]Bastion, error) {
+	var subnetMatches []Bastion
+	var vcnMatches []Bastion
+
+	var targetVcnId string
+	if targetSubnetId != "" {
+		response, err := vnetClient.GetSubnet(context.Background(), core.GetSubnetRequest{SubnetId: &targetSubnetId})
+		if err != nil {
+			return nil, fmt.Errorf("unable to get subnet %s: %w", targetSubnetId, err)
+		}
+		targetVcnId = *response.Subnet.VcnId
+	}
+
+	ip := net.ParseIP(targetIp)
+
+	for _, b := range bastions {
+		if targetSubnetId != "" && b.TargetSubnetId == targetSubnetId {
+			subnetMatches = append(subnetMatches, b)
+			continue
+		}
+
+		if targetVcnId != "" {
+			if b.TargetVcnId == targetVcnId {
+				vcnMatches = append(vcnMatches, b)
+			}
+			continue
+		}
+
+		// No subnet to compare (E.g. IP only or OKE endpoint), check the IP against the VCN CIDR blocks
+		if ip != nil {
+			response, err := vnetClient.GetVcn(context.Background(), core.GetVcnRequest{VcnId: &b.TargetVcnId})
+			if err != nil {
+				return nil, fmt.Errorf("unable to get VCN of bastion %s: %w", b.Name, err)
+			}
+
+			for _, cidr := range response.Vcn.CidrBlocks {
+				_, network, err := net.ParseCIDR(cidr)
+				if err == nil && network.Contains(ip) {
+					vcnMatches = append(vcnMatches, b)
+					break
+				}
+			}
+		}
+	}
+
+	if len(subnetMatches) > 0 {
+		return subnetMatches, nil
+	}
+
+	return vcnMatches, nil
 }
 
 // Check status of bastion session
-func FetchSession(bastionClient bastion.BastionClient, sessionId *string, flagType string) Session {
+func FetchSession(bastionClient BastionClient, sessionId *string) (Session, error) {
 	response, err := bastionClient.GetSession(context.Background(), bastion.GetSessionRequest{SessionId: sessionId})
-	utils.CheckError(err)
+	if err != nil {
+		return Session{}, fmt.Errorf("unable to get bastion session: %w", err)
+	}
 
-	var ipAddress *string
-	var sshUser *string
-	var sshPort *int
+	session := Session{State: response.Session.LifecycleState}
 
-	if flagType == "port-forward" {
-		// Required info for port forward SSH connections
-		sshSessionTargetResourceDetails := response.Session.TargetResourceDetails.(bastion.PortForwardingSessionTargetResourceDetails)
-		ipAddress = sshSessionTargetResourceDetails.TargetResourcePrivateIpAddress
-		sshPort = sshSessionTargetResourceDetails.TargetResourcePort
-	} else {
+	switch details := response.Session.TargetResourceDetails.(type) {
+	case bastion.PortForwardingSessionTargetResourceDetails:
+		// Required info for port forward SSH connections (FQDN targets have no IP)
+		if details.TargetResourcePrivateIpAddress != nil {
+			session.ip = *details.TargetResourcePrivateIpAddress
+		}
+		session.port = *details.TargetResourcePort
+	case bastion.ManagedSshSessionTargetResourceDetails:
 		// Required info for managed SSH connections
-		sshSessionTargetResourceDetails := response.Session.TargetResourceDetails.(bastion.ManagedSshSessionTargetResourceDetails)
-		ipAddress = sshSessionTargetResourceDetails.TargetResourcePrivateIpAddress
-		sshUser = sshSessionTargetResourceDetails.TargetResourceOperatingSystemUserName
-		sshPort = sshSessionTargetResourceDetails.TargetResourcePort
+		session.ip = *details.TargetResourcePrivateIpAddress
+		session.user = *details.TargetResourceOperatingSystemUserName
+		session.port = *details.TargetResourcePort
 	}
 
-	var session Session
-	if flagType == "port-forward" {
-		session = Session{response.Session.LifecycleState, *ipAddress, "", *sshPort}
-	} else {
-		session = Session{response.Session.LifecycleState, *ipAddress, *sshUser, *sshPort}
+	return session, nil
+}
+
+// Poll the bastion session until it is ACTIVE, return an error if it is deleted before becoming active or ctx is cancelled
+func WaitForActiveSession(ctx context.Context, bastionClient BastionClient, sessionId *string) error {
+	session, err := FetchSession(bastionClient, sessionId)
+	if err != nil {
+		return err
+	}
+
+	for session.State != "ACTIVE" {
+		if session.State == "DELETED" {
+			fmt.Fprintln(os.Stderr, "\nSession Info")
+			fmt.Fprintln(os.Stderr, session)
+			return errors.New("session " + *sessionId + " has been deleted before becoming active")
+		}
+
+		fmt.Fprintln(os.Stderr, "Session not yet active, waiting... (State: "+session.State+")")
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Second):
+		}
+
+		session, err = FetchSession(bastionClient, sessionId)
+		if err != nil {
+			return err
+		}
 	}
 
-	return session
+	return nil
 }
 
-// List and print bastions (OCI API call)
-func ListBastions(bastions map[string]string, tenancyName string, compartmentName string) {
-	tbl := table.New("Bastion Name", "OCID")
-	tbl.WithHeaderFormatter(utils.HeaderFmt).WithFirstColumnFormatter(utils.ColumnFmt)
+// Lookup bastion details and print bastions (OCI API call)
+func ListBastions(client BastionClient, bastions []Bastion, tenancyName string, compartmentName string) error {
+	err := utils.ForEach(len(bastions), func(i int) error {
+		var err error
+		bastions[i], err = FetchBastionDetails(client, bastions[i])
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	columns := []utils.Column{{Header: "Bastion Name"}, {Header: "OCID"}, {Header: "Max TTL"}, {Header: "Allowed CIDRs"}, {Header: "DNS Proxy", Wide: true}, {Header: "Target Subnet OCID", Wide: true}}
+
+	var rows [][]string
+	for _, b := range bastions {
+		rows = append(rows, []string{b.Name, b.Id, strconv.Itoa(b.MaxSessionTtl), strings.Join(b.ClientCidrs, ","), strconv.FormatBool(b.DnsProxy), b.TargetSubnetId})
+	}
 
-	for bastionName := range bastions {
-		tbl.AddRow(bastionName, bastions[bastionName])
+	if utils.StructuredOutput() {
+		return utils.PrintOutput(bastions, columns, rows)
 	}
 
 	utils.FaintMagenta.Println("Tenancy(Compartment): " + tenancyName + "(" + compartmentName + ")")
-	tbl.Print()
+	err = utils.PrintOutput(bastions, columns, rows)
+	if err != nil {
+		return err
+	}
 
 	fmt.Print("\nTo specify bastion, pass flag: ")
 	utils.Yellow.Println("-b BASTION_NAME")
-}
 
-// Determine bastion name and then lookup ID
-func CheckForUniqueBastion(bastions map[string]string) (string, string) {
-	var bastionId string
-	var bastionName string
+	return nil
+}
 
-	// If there is only one bastion, no need to require bastion name input
+// If there is only one bastion, no need to require bastion name input
+func CheckForUniqueBastion(bastions []Bastion) (Bastion, bool) {
 	if len(bastions) == 1 {
-		for name, id := range bastions {
-			bastionName = name
-			bastionId = id
+		utils.Logger.Debug("Only one bastion found, using " + bastions[0].Name + " (" + bastions[0].Id + ")")
+		return bastions[0], true
+	}
+
+	utils.Logger.Debug("Multiple bastions found")
+	return Bastion{}, false
+}
+
+// List and print bastion sessions, only active sessions unless listOnlyActiveSessions is false
+func ListBastionSessions(bastionClient BastionClient, bastionId string, tenancyName string, compartmentName string, listOnlyActiveSessions bool) error {
+	var state bastion.ListSessionsSessionLifecycleStateEnum
+	if listOnlyActiveSessions {
+		state = bastion.ListSessionsSessionLifecycleStateActive
+	}
+
+	sessionSummaries, err := fetchSessions(bastionClient, bastionId, state)
+	if err != nil {
+		return err
+	}
+
+	var sessions []BastionSession
+
+	for _, session := range sessionSummaries {
+		bastionSession := BastionSession{
+			Name:        sessionName(session),
+			Id:          *session.Id,
+			State:       string(session.LifecycleState),
+			TimeCreated: sessionCreated(session),
 		}
 
-		utils.Logger.Debug("Only one bastion found, using " + bastionName + " (" + bastionId + ")")
-		return bastionName, bastionId
+		switch details := session.TargetResourceDetails.(type) {
+		case bastion.PortForwardingSessionTargetResourceDetails:
+			bastionSession.Type = "PortForward"
+			if details.TargetResourcePrivateIpAddress != nil {
+				bastionSession.TargetIp = *details.TargetResourcePrivateIpAddress
+			} else if details.TargetResourceFqdn != nil {
+				bastionSession.TargetIp = *details.TargetResourceFqdn
+			}
+			bastionSession.TargetPort = *details.TargetResourcePort
+		case bastion.ManagedSshSessionTargetResourceDetails:
+			bastionSession.Type = "SSH"
+			bastionSession.InstanceId = *details.TargetResourceId
+			bastionSession.TargetIp = *details.TargetResourcePrivateIpAddress
+			bastionSession.TargetPort = *details.TargetResourcePort
+		case bastion.DynamicPortForwardingSessionTargetResourceDetails:
+			bastionSession.Type = "DynamicPortForward"
+		}
 
-	} else {
-		utils.Logger.Debug("Multiple bastions found")
-		return "", ""
+		sessions = append(sessions, bastionSession)
 	}
+
+	return PrintBastionSessions(sessions, tenancyName, compartmentName)
 }
 
-// List and print all active bastion sessions
-func ListBastionSessions(bastionClient bastion.BastionClient, bastionId string, tenancyName string, compartmentName string, listOnlyActiveSessions bool) {
-	response, err := bastionClient.ListSessions(context.Background(), bastion.ListSessionsRequest{BastionId: &bastionId})
-	utils.CheckError(err)
+// Print bastion sessions, detailed text by default or in the format set by --output
+func PrintBastionSessions(sessions []BastionSession, tenancyName string, compartmentName string) error {
+	if !utils.StructuredOutput() {
+		utils.FaintMagenta.Println("Tenancy(Compartment): " + tenancyName + "(" + compartmentName + ")")
+	}
 
-	utils.FaintMagenta.Println("Tenancy(Compartment): " + tenancyName + "(" + compartmentName + ")")
+	if utils.OutputFormat() != "" {
+		columns := []utils.Column{{Header: "Name"}, {Header: "State"}, {Header: "Type"}, {Header: "Target"}, {Header: "Created"}, {Header: "Instance OCID", Wide: true}, {Header: "OCID", Wide: true}}
 
-	// TODO: Fix inefficient code for bastion session object
-	// put sessions into []Session and then handle active vs all
-	// or maybe get rid of, listing non-active session may only be useful for troubleshooting
-	for _, session := range response.Items {
-		if listOnlyActiveSessions {
-			if session.LifecycleState == "ACTIVE" {
-				fmt.Print("Name: ")
-				utils.Blue.Println(*session.DisplayName)
-				fmt.Print("ID: ")
-				utils.Yellow.Println(*session.Id)
-
-				fmt.Print("Created: ")
-				utils.Yellow.Println(*session.TimeCreated)
-
-				// TODO: Consolidate port-fw and ssh session details into a map and print all at once
-				portFwTargetResourceDetails, ok := session.TargetResourceDetails.(bastion.PortForwardingSessionTargetResourceDetails)
-				if ok {
-					fmt.Print("Type: ")
-					utils.Yellow.Println("PortForward")
-					fmt.Print("IP:Port: ")
-					utils.Yellow.Print(*portFwTargetResourceDetails.TargetResourcePrivateIpAddress)
-					utils.Yellow.Print(":")
-					utils.Yellow.Println(*portFwTargetResourceDetails.TargetResourcePort)
-				}
+		var rows [][]string
+		for _, session := range sessions {
+			target := session.TargetIp
+			if session.TargetPort != 0 {
+				target = net.JoinHostPort(session.TargetIp, strconv.Itoa(session.TargetPort))
+			}
 
-				sshTargetResourceDetails, ok := session.TargetResourceDetails.(bastion.ManagedSshSessionTargetResourceDetails)
-				if ok {
-					fmt.Print("Type: ")
-					utils.Yellow.Println("SSH")
+			rows = append(rows, []string{session.Name, session.State, session.Type, target, formatSessionTime(session.TimeCreated), session.InstanceId, session.Id})
+		}
 
-					fmt.Print("Instance ID: ")
-					utils.Yellow.Println(*sshTargetResourceDetails.TargetResourceId)
+		return utils.PrintOutput(sessions, columns, rows)
+	}
 
-					fmt.Print("IP:Port: ")
-					utils.Yellow.Print(*sshTargetResourceDetails.TargetResourcePrivateIpAddress)
-					utils.Yellow.Print(":")
-					utils.Yellow.Println(*sshTargetResourceDetails.TargetResourcePort)
-				}
+	for _, session := range sessions {
+		fmt.Print("Name: ")
+		utils.Blue.Println(session.Name)
 
-				fmt.Println("")
-			}
-		} else {
-			fmt.Print("Name: ")
-			utils.Blue.Println(*session.DisplayName)
+		if session.State != string(bastion.SessionLifecycleStateActive) {
 			fmt.Print("State: ")
-			utils.Blue.Println(session.LifecycleState)
-			fmt.Print("ID: ")
-			utils.Yellow.Println(*session.Id)
+			utils.Blue.Println(session.State)
+		}
 
+		fmt.Print("ID: ")
+		utils.Yellow.Println(session.Id)
+
+		if !session.TimeCreated.IsZero() {
 			fmt.Print("Created: ")
-			utils.Yellow.Println(*session.TimeCreated)
-
-			// TODO: Consolidate port-fw and ssh session details into a map and print all at once
-			portFwTargetResourceDetails, ok := session.TargetResourceDetails.(bastion.PortForwardingSessionTargetResourceDetails)
-			if ok {
-				fmt.Print("Type: ")
-				utils.Yellow.Println("PortForward")
-				fmt.Print("IP:Port: ")
-				utils.Yellow.Print(*portFwTargetResourceDetails.TargetResourcePrivateIpAddress)
-				utils.Yellow.Print(":")
-				utils.Yellow.Println(*portFwTargetResourceDetails.TargetResourcePort)
+			utils.Yellow.Println(session.TimeCreated)
+		}
+
+		fmt.Print("Type: ")
+		utils.Yellow.Println(session.Type)
+
+		if session.InstanceId != "" {
+			fmt.Print("Instance ID: ")
+			utils.Yellow.Println(session.InstanceId)
+		}
+
+		if session.TargetIp != "" {
+			fmt.Print("IP:Port: ")
+			utils.Yellow.Println(session.TargetIp + ":" + strconv.Itoa(session.TargetPort))
+		}
+
+		fmt.Println("")
+	}
+
+	return nil
+}
+
+// Fingerprint (SHA256) of an authorized_keys formatted public key, empty if it can't be parsed
+func publicKeyFingerprint(publicKeyContent string) string {
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKeyContent))
+	if err != nil {
+		return ""
+	}
+
+	return ssh.FingerprintSHA256(publicKey)
+}
+
+// Find an ACTIVE oshiv session on the bastion with the same target, port, user and public key
+// Only sessions with at least minTtl seconds remaining are considered, returns nil if there is none
+func FindReusableSession(bastionClient BastionClient, bastionId string, sessionType string, publicKeyContent string, targetIp string, sshPort int, hostFwPort int, sshUser string, minTtl int) (*string, error) {
+	fingerprint := publicKeyFingerprint(publicKeyContent)
+	if fingerprint == "" {
+		return nil, nil
+	}
+
+	sessions, err := fetchSessions(bastionClient, bastionId, bastion.ListSessionsSessionLifecycleStateActive)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		if session.DisplayName == nil || !strings.HasPrefix(*session.DisplayName, "oshiv-") {
+			continue
+		}
+
+		expires, ok := sessionExpiry(session)
+		if !ok || time.Until(expires) < time.Duration(minTtl)*time.Second {
+			continue
+		}
+
+		var targetMatches bool
+		switch details := session.TargetResourceDetails.(type) {
+		case bastion.PortForwardingSessionTargetResourceDetails:
+			targetMatches = sessionType == "port-forward" &&
+				details.TargetResourcePrivateIpAddress != nil && *details.TargetResourcePrivateIpAddress == targetIp &&
+				details.TargetResourcePort != nil && *details.TargetResourcePort == hostFwPort
+		case bastion.ManagedSshSessionTargetResourceDetails:
+			targetMatches = sessionType == "managed" &&
+				details.TargetResourcePrivateIpAddress != nil && *details.TargetResourcePrivateIpAddress == targetIp &&
+				details.TargetResourcePort != nil && *details.TargetResourcePort == sshPort &&
+				details.TargetResourceOperatingSystemUserName != nil && *details.TargetResourceOperatingSystemUserName == sshUser
+		}
+
+		if !targetMatches {
+			continue
+		}
+
+		sessionFingerprint, err := sessionKeyFingerprint(bastionClient, session.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		if sessionFingerprint == fingerprint {
+			utils.Blue.Fprintln(os.Stderr, "\nReusing session "+*session.DisplayName+" (expires "+expires.Local().Format(time.Kitchen)+")")
+			fmt.Fprintln(os.Stderr, *session.Id)
+
+			return session.Id, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// Return when a session expires, false if its creation time or TTL isn't set (E.g. sessions being created or deleted)
+func sessionExpiry(session bastion.SessionSummary) (time.Time, bool) {
+	if session.TimeCreated == nil || session.SessionTtlInSeconds == nil {
+		return time.Time{}, false
+	}
+
+	return session.TimeCreated.Add(time.Duration(*session.SessionTtlInSeconds) * time.Second), true
+}
+
+// Return when a session was created, the zero time if it isn't set (E.g. sessions being created)
+func sessionCreated(session bastion.SessionSummary) time.Time {
+	if session.TimeCreated == nil {
+		return time.Time{}
+	}
+
+	return session.TimeCreated.Time
+}
+
+// Format a session time for table and csv output, empty if it isn't set
+func formatSessionTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+// Return a session's display name, empty if it isn't set
+func sessionName(session bastion.SessionSummary) string {
+	if session.DisplayName == nil {
+		return ""
+	}
+
+	return *session.DisplayName
+}
+
+// Fetch all sessions on a bastion via OCI API call, optionally filtered by lifecycle state
+func fetchSessions(bastionClient BastionClient, bastionId string, state bastion.ListSessionsSessionLifecycleStateEnum) ([]bastion.SessionSummary, error) {
+	var sessions []bastion.SessionSummary
+
+	var page *string
+	for {
+		response, err := bastionClient.ListSessions(context.Background(), bastion.ListSessionsRequest{
+			BastionId:             &bastionId,
+			SessionLifecycleState: state,
+			Page:                  page,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list bastion sessions: %w", err)
+		}
+
+		sessions = append(sessions, response.Items...)
+
+		if response.OpcNextPage == nil {
+			break
+		}
+		page = response.OpcNextPage
+	}
+
+	return sessions, nil
+}
+
+// Fingerprint of the public key a session was created with (OCI API call, the key is only returned by GetSession)
+func sessionKeyFingerprint(bastionClient BastionClient, sessionId *string) (string, error) {
+	response, err := bastionClient.GetSession(context.Background(), bastion.GetSessionRequest{SessionId: sessionId})
+	if err != nil {
+		return "", fmt.Errorf("unable to get bastion session: %w", err)
+	}
+
+	if response.KeyDetails == nil || response.KeyDetails.PublicKeyContent == nil {
+		return "", nil
+	}
+
+	return publicKeyFingerprint(*response.KeyDetails.PublicKeyContent), nil
+}
+
+// Delete a bastion session by ID or display name (OCI API call)
+func DeleteBastionSession(bastionClient BastionClient, bastionId string, sessionIdOrName string) error {
+	sessionId := sessionIdOrName
+
+	if !strings.HasPrefix(sessionIdOrName, "ocid1.bastionsession.") {
+		sessions, err := fetchSessions(bastionClient, bastionId, "")
+		if err != nil {
+			return err
+		}
+
+		var matches []bastion.SessionSummary
+
+		for _, session := range sessions {
+			if session.LifecycleState == bastion.SessionLifecycleStateDeleted || session.LifecycleState == bastion.SessionLifecycleStateDeleting {
+				continue
 			}
 
-			sshTargetResourceDetails, ok := session.TargetResourceDetails.(bastion.ManagedSshSessionTargetResourceDetails)
-			if ok {
-				fmt.Print("Type: ")
-				utils.Yellow.Println("SSH")
+			if session.DisplayName != nil && *session.DisplayName == sessionIdOrName {
+				matches = append(matches, session)
+			}
+		}
 
-				fmt.Print("Instance ID: ")
-				utils.Yellow.Println(*sshTargetResourceDetails.TargetResourceId)
+		if len(matches) == 0 {
+			return errors.New("no session found named " + sessionIdOrName)
+		} else if len(matches) > 1 {
+			fmt.Println("Multiple sessions named " + sessionIdOrName + ":")
 
-				fmt.Print("IP:Port: ")
-				utils.Yellow.Print(*sshTargetResourceDetails.TargetResourcePrivateIpAddress)
-				utils.Yellow.Print(":")
-				utils.Yellow.Println(*sshTargetResourceDetails.TargetResourcePort)
+			for _, session := range matches {
+				fmt.Println(" - " + *session.Id + " (" + string(session.LifecycleState) + ")")
 			}
 
-			fmt.Println("")
+			return utils.UsageError("multiple sessions named " + sessionIdOrName + ", pass a session ID instead")
 		}
 
+		sessionId = *matches[0].Id
+	}
+
+	_, err := bastionClient.DeleteSession(context.Background(), bastion.DeleteSessionRequest{SessionId: &sessionId})
+	if err != nil {
+		return fmt.Errorf("unable to delete session %s: %w", sessionId, err)
 	}
+
+	fmt.Print("Deleted session: ")
+	utils.Yellow.Println(sessionId)
+
+	return nil
+}
+
+// Delete oshiv created sessions that use the given public key or are older than olderThan, either filter is disabled by its zero value
+// A session matching either filter is deleted, returns the deleted sessions (the sessions that would be deleted with dryRun)
+func PruneBastionSessions(bastionClient BastionClient, bastionId string, publicKeyContent string, olderThan time.Duration, dryRun bool) ([]PrunedSession, error) {
+	fingerprint := publicKeyFingerprint(publicKeyContent)
+
+	sessions, err := fetchSessions(bastionClient, bastionId, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []PrunedSession
+
+	for _, session := range sessions {
+		if session.LifecycleState != bastion.SessionLifecycleStateActive && session.LifecycleState != bastion.SessionLifecycleStateCreating {
+			continue
+		}
+
+		if !strings.HasPrefix(sessionName(session), "oshiv-") {
+			continue
+		}
+
+		// Sessions without a creation time (E.g. being created) are never older than olderThan
+		created := sessionCreated(session)
+
+		var reason string
+		if olderThan > 0 && !created.IsZero() && time.Since(created) > olderThan {
+			reason = "older than " + olderThan.String()
+		} else if fingerprint != "" {
+			sessionFingerprint, err := sessionKeyFingerprint(bastionClient, session.Id)
+			if err != nil {
+				return pruned, err
+			}
+
+			if sessionFingerprint != fingerprint {
+				continue
+			}
+			reason = "your key"
+		} else {
+			continue
+		}
+
+		if !dryRun {
+			_, err := bastionClient.DeleteSession(context.Background(), bastion.DeleteSessionRequest{SessionId: session.Id})
+			if err != nil {
+				return pruned, fmt.Errorf("unable to delete session %s: %w", sessionName(session), err)
+			}
+		}
+
+		pruned = append(pruned, PrunedSession{
+			Name:        sessionName(session),
+			Id:          *session.Id,
+			State:       string(session.LifecycleState),
+			TimeCreated: created,
+			Reason:      reason,
+		})
+	}
+
+	return pruned, nil
+}
+
+// Print pruned sessions as a table, or in the format set by --output
+func PrintPrunedSessions(sessions []PrunedSession, dryRun bool) error {
+	if len(sessions) == 0 && !utils.StructuredOutput() {
+		fmt.Println("No sessions to prune")
+		return nil
+	}
+
+	columns := []utils.Column{{Header: "Session Name"}, {Header: "State"}, {Header: "Created"}, {Header: "Reason"}, {Header: "OCID", Wide: true}}
+
+	var rows [][]string
+	for _, session := range sessions {
+		rows = append(rows, []string{session.Name, session.State, formatSessionTime(session.TimeCreated), session.Reason, session.Id})
+	}
+
+	err := utils.PrintOutput(sessions, columns, rows)
+	if err != nil || utils.StructuredOutput() {
+		return err
+	}
+
+	if dryRun {
+		utils.Faint.Println("\n" + strconv.Itoa(len(sessions)) + " session(s) would be deleted (dry run)")
+	} else {
+		utils.Faint.Println("\n" + strconv.Itoa(len(sessions)) + " session(s) deleted")
+	}
+
+	return nil
 }
 
 // Create a port forward SSH bastion session
-func CreateBastionSession(bastionClient bastion.BastionClient, bastionId string, sessionType string, publicKeyContent string, targetIp string, sshPort int, hostFwPort int, sessionTtl int, targetInstanceId string, sshUser string) *string {
+func CreateBastionSession(ctx context.Context, bastionClient BastionClient, bastionId string, sessionType string, publicKeyContent string, targetIp string, sshPort int, hostFwPort int, sessionTtl int, targetInstanceId string, sshUser string) (*string, error) {
 	var req bastion.CreateSessionRequest
 
 	id := utils.GenerateID(4) // 4 bytes = ~6 chars
@@ -203,23 +675,45 @@ func CreateBastionSession(bastionClient bastion.BastionClient, bastionId string,
 
 	switch sessionType {
 	case "port-forward":
-		fmt.Println("Creating port forwarding SSH session...")
+		fmt.Fprintln(os.Stderr, "Creating port forwarding SSH session...")
+
+		targetResourceDetails := bastion.PortForwardingSessionTargetResourceDetails{
+			TargetResourcePort: &hostFwPort, // In the case of a port fw session, port represents the host-port to forward (as in ssh -L port:host:host-port)
+		}
+
+		// A host name passed as the target IP is sent as an FQDN target, OCI resolves it with the bastion's DNS proxy
+		// The SOCKS proxy only creates port forwarding sessions to IPs, host names need its dynamic port forwarding session
+		if net.ParseIP(targetIp) != nil {
+			targetResourceDetails.TargetResourcePrivateIpAddress = &targetIp
+		} else {
+			targetResourceDetails.TargetResourceFqdn = &targetIp
+		}
 
 		req = bastion.CreateSessionRequest{
 			CreateSessionDetails: bastion.CreateSessionDetails{
-				BastionId:           &bastionId,
-				DisplayName:         common.String("oshiv-" + "pt-fw-" + targetIpSafe + "-" + strconv.Itoa(hostFwPort) + id),
-				KeyDetails:          &bastion.PublicKeyDetails{PublicKeyContent: &publicKeyContent},
-				SessionTtlInSeconds: common.Int(sessionTtl),
-				TargetResourceDetails: bastion.PortForwardingSessionTargetResourceDetails{
-					TargetResourcePort:             &hostFwPort, // In the case of a port fw session, port represents the host-port to forward (as in ssh -L port:host:host-port)
-					TargetResourcePrivateIpAddress: &targetIp,
-				},
+				BastionId:             &bastionId,
+				DisplayName:           common.String("oshiv-" + "pt-fw-" + targetIpSafe + "-" + strconv.Itoa(hostFwPort) + id),
+				KeyDetails:            &bastion.PublicKeyDetails{PublicKeyContent: &publicKeyContent},
+				SessionTtlInSeconds:   common.Int(sessionTtl),
+				TargetResourceDetails: targetResourceDetails,
+			},
+		}
+
+	case "dynamic-port-forward":
+		fmt.Fprintln(os.Stderr, "Creating dynamic port forwarding (SOCKS5) SSH session...")
+
+		req = bastion.CreateSessionRequest{
+			CreateSessionDetails: bastion.CreateSessionDetails{
+				BastionId:             &bastionId,
+				DisplayName:           common.String("oshiv-" + "dyn-fw" + id),
+				KeyDetails:            &bastion.PublicKeyDetails{PublicKeyContent: &publicKeyContent},
+				SessionTtlInSeconds:   common.Int(sessionTtl),
+				TargetResourceDetails: bastion.CreateDynamicPortForwardingSessionTargetResourceDetails{},
 			},
 		}
 
 	case "managed":
-		fmt.Println("Creating managed SSH session...")
+		fmt.Fprintln(os.Stderr, "Creating managed SSH session...")
 
 		utils.Logger.Debug("targetInstanceId: " + targetInstanceId)
 		utils.Logger.Debug("sshUser: " + sshUser)
@@ -242,27 +736,29 @@ func CreateBastionSession(bastionClient bastion.BastionClient, bastionId string,
 		}
 	}
 
-	response, err := bastionClient.CreateSession(context.Background(), req)
-	utils.CheckError(err)
+	response, err := bastionClient.CreateSession(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create bastion session: %w", err)
+	}
 
 	sessionId := response.Session.Id
-	utils.Blue.Println("\nSession ID")
-	fmt.Println(*sessionId)
-	fmt.Println("")
+	utils.Blue.Fprintln(os.Stderr, "\nSession ID")
+	fmt.Fprintln(os.Stderr, *sessionId)
+	fmt.Fprintln(os.Stderr, "")
 
-	return sessionId
+	return sessionId, nil
 }
 
 // Print port forward SSH commands to connect via bastion
-func PrintPortFwSshCommands(bastionClient bastion.BastionClient, sessionId *string, targetIp string, sshPort int, sshPrivateKey string, localFwPort int, hostFwPort int, flagOkeId string) {
-	bastionEndpointUrl, err := url.Parse(bastionClient.Endpoint())
-	utils.CheckError(err)
-
-	bastionHost := *sessionId + "@host." + bastionEndpointUrl.Host
+func PrintPortFwSshCommands(bastionClient BastionClient, sessionId *string, targetIp string, sshPort int, sshPrivateKey string, localFwPort int, hostFwPort int, flagOkeId string) error {
+	sshHost, err := bastionSshHost(bastionClient)
+	if err != nil {
+		return err
+	}
+	bastionHost := *sessionId + "@" + sshHost
 
 	if flagOkeId != "" {
-		utils.Yellow.Println("\nUpdate kube config (One time operation)")
-		fmt.Println("oci ce cluster create-kubeconfig --cluster-id " + flagOkeId + " --token-version 2.0.0 --kube-endpoint PRIVATE_ENDPOINT --auth security_token")
+		PrintOkeKubeconfigCommand(flagOkeId)
 	}
 
 	utils.Yellow.Println("\nPort Forwarding command")
@@ -280,17 +776,31 @@ func PrintPortFwSshCommands(bastionClient bastion.BastionClient, sessionId *stri
 		utils.Yellow.Println("\nSQLPlus command")
 		fmt.Println("sqlplus '" + color.RedString("USERNAME") + "/" + color.RedString("PASSWORD") + "@(description= (retry_count=20)(retry_delay=3)(address=(protocol=tcps)(port=1522)(host=localhost))(connect_data=(service_name=" + color.RedString("SERVICE_NAME") + "))(security=(ssl_server_cert_dn=\"CN=" + color.RedString("COMMON_NAME") + ",O=Oracle Corporation,L=Redwood City,ST=California,C=US\")))'")
 	}
+
+	return nil
+}
+
+// Print the OCI CLI command to add an OKE cluster to the kube config
+// Uses the authentication method oshiv was given, session token auth (the most common for humans) otherwise
+func PrintOkeKubeconfigCommand(okeId string) {
+	authMethod := utils.OciAuth()
+	if authMethod == "" {
+		authMethod = "security_token"
+	}
+
+	utils.Yellow.Println("\nUpdate kube config (One time operation)")
+	fmt.Println("oci ce cluster create-kubeconfig --cluster-id " + okeId + " --token-version 2.0.0 --kube-endpoint PRIVATE_ENDPOINT --auth " + authMethod)
 }
 
 // Print SSH commands to connect via bastion
-func PrintManagedSshCommands(bastionClient bastion.BastionClient, sessionId *string, instanceIp string, sshUser string, sshPort int, sshIdentityFile string, localFwPort int, hostFwPort int) {
-	bastionEndpointUrl, err := url.Parse(bastionClient.Endpoint())
-	utils.CheckError(err)
-
-	sessionIdStr := *sessionId
-	bastionHost := sessionIdStr + "@host." + bastionEndpointUrl.Host
+func PrintManagedSshCommands(bastionClient BastionClient, sessionId *string, instanceIp string, sshUser string, sshPort int, sshIdentityFile string, localFwPort int, hostFwPort int) error {
+	sshHost, err := bastionSshHost(bastionClient)
+	if err != nil {
+		return err
+	}
+	bastionHost := *sessionId + "@" + sshHost
 
-	// TODO: Consider proxy jump flag for commands where applicable - https://www.ateam-oracle.com/post/openssh-proxyjump-with-oci-bastion-service
+	// For ssh_config Host entries (ProxyCommand) see: oshiv bastion ssh-config
 	if hostFwPort == 0 {
 		utils.Yellow.Println("\nTunnel command")
 		fmt.Println("sudo ssh -i \"" + sshIdentityFile + "\" \\")
@@ -327,4 +837,6 @@ func PrintManagedSshCommands(bastionClient bastion.BastionClient, sessionId *str
 	fmt.Println("ssh -i " + sshIdentityFile + " -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null \\")
 	fmt.Println("-o ProxyCommand='ssh -i " + sshIdentityFile + " -W %h:%p " + bastionHost + "' \\")
 	fmt.Println(sshUser + "@" + instanceIp)
+
+	return nil
 }
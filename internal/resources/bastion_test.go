@@ -0,0 +1,254 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cnopslabs/oshiv/internal/fake"
+	"github.com/oracle/oci-go-sdk/v65/bastion"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/spf13/viper"
+)
+
+const testPublicKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIOshivFakeTestKeyOnlyUsedInTests oshiv-test"
+
+func TestFetchBastions(t *testing.T) {
+	backend := newBackend(t, 1)
+
+	bastions, err := FetchBastions(fake.CompartmentId, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleted bastions are skipped, details are only looked up by FetchBastionDetails
+	want := []Bastion{{
+		"prod-bastion",
+		fake.BastionId,
+		"ocid1.vcn.oc1.iad.prod",
+		"ocid1.subnet.oc1.iad.app",
+		nil,
+		0,
+		true,
+		bastion.BastionLifecycleStateActive,
+	}}
+	if !reflect.DeepEqual(bastions, want) {
+		t.Errorf("bastions = %+v, want %+v", bastions, want)
+	}
+
+	if calls := backend.Calls("ListBastions"); calls != 2 {
+		t.Errorf("ListBastions calls = %d, want 2", calls)
+	}
+
+	if calls := backend.Calls("GetBastion"); calls != 0 {
+		t.Errorf("GetBastion calls = %d, want 0", calls)
+	}
+}
+
+func TestFetchBastionDetails(t *testing.T) {
+	backend := newBackend(t, 0)
+
+	bastions, err := FetchBastions(fake.CompartmentId, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	details, err := FetchBastionDetails(backend, bastions[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(details.ClientCidrs, []string{"0.0.0.0/0"}) || details.MaxSessionTtl != 10800 || !details.DnsProxy {
+		t.Errorf("bastion details = %+v", details)
+	}
+
+	// A bastion without a max session TTL (E.g. not returned by the API) is not dereferenced
+	backend.Bastions[0].MaxSessionTtlInSeconds = nil
+
+	details, err = FetchBastionDetails(backend, bastions[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if details.MaxSessionTtl != 0 {
+		t.Errorf("max session TTL = %d, want 0", details.MaxSessionTtl)
+	}
+}
+
+func TestCreateBastionSession(t *testing.T) {
+	tests := []struct {
+		sessionType string
+		targetIp    string
+		want        Session
+		namePrefix  string
+	}{
+		{"managed", "10.0.1.10", Session{bastion.SessionLifecycleStateActive, "10.0.1.10", "opc", 22}, "oshiv-mng-ssh-10-0-1-10"},
+		{"port-forward", "10.0.1.10", Session{bastion.SessionLifecycleStateActive, "10.0.1.10", "", 8080}, "oshiv-pt-fw-10-0-1-10-8080"},
+		{"port-forward", "db.internal.example.com", Session{bastion.SessionLifecycleStateActive, "", "", 8080}, "oshiv-pt-fw-db-internal-example-com-8080"},
+		{"dynamic-port-forward", "", Session{bastion.SessionLifecycleStateActive, "", "", 0}, "oshiv-dyn-fw"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.sessionType+" "+test.targetIp, func(t *testing.T) {
+			backend := newBackend(t, 0)
+
+			sessionId, err := CreateBastionSession(context.Background(), backend, fake.BastionId, test.sessionType, testPublicKey, test.targetIp, 22, 8080, 3600, "ocid1.instance.oc1.iad.web1", "opc")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			session, err := FetchSession(backend, sessionId)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(session, test.want) {
+				t.Errorf("session = %+v, want %+v", session, test.want)
+			}
+
+			created := backend.Sessions[len(backend.Sessions)-1]
+			if !strings.HasPrefix(*created.DisplayName, test.namePrefix) {
+				t.Errorf("session name = %q, want prefix %q", *created.DisplayName, test.namePrefix)
+			}
+			if *created.SessionTtlInSeconds != 3600 || *created.KeyDetails.PublicKeyContent != testPublicKey {
+				t.Errorf("session TTL = %d, key = %q", *created.SessionTtlInSeconds, *created.KeyDetails.PublicKeyContent)
+			}
+
+			if test.sessionType == "managed" {
+				details := created.TargetResourceDetails.(bastion.ManagedSshSessionTargetResourceDetails)
+				if *details.TargetResourceId != "ocid1.instance.oc1.iad.web1" {
+					t.Errorf("session target = %s, want web-1", *details.TargetResourceId)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateBastionSessionError(t *testing.T) {
+	backend := newBackend(t, 0)
+
+	_, err := CreateBastionSession(context.Background(), backend, "ocid1.bastion.oc1.iad.missing", "port-forward", testPublicKey, "10.0.1.10", 22, 8080, 3600, "", "opc")
+	if err == nil || !strings.Contains(err.Error(), "unable to create bastion session") {
+		t.Errorf("error = %v, want unable to create bastion session", err)
+	}
+}
+
+func TestWaitForActiveSessionCancelled(t *testing.T) {
+	backend := newBackend(t, 0)
+	backend.Sessions[0].LifecycleState = bastion.SessionLifecycleStateCreating
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := WaitForActiveSession(ctx, backend, backend.Sessions[0].Id)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want context deadline exceeded", err)
+	}
+
+	// Returns without waiting for the next poll
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %s, want it to return once cancelled", elapsed)
+	}
+}
+
+func TestFindReusableSession(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(session *bastion.Session)
+		want   bool
+	}{
+		{"active", func(session *bastion.Session) {}, true},
+		{"expiring", func(session *bastion.Session) { session.SessionTtlInSeconds = common.Int(600) }, false},
+		// Not returned by OCI, E.g. while the session is created or deleted
+		{"no TTL", func(session *bastion.Session) { session.SessionTtlInSeconds = nil }, false},
+		{"no creation time", func(session *bastion.Session) { session.TimeCreated = nil }, false},
+	}
+
+	for _, test := range tests {
+		backend := newBackend(t, 0)
+
+		// oshiv-web-1, a managed SSH session to web-1 created just now
+		session := &backend.Sessions[0]
+		session.TimeCreated = &common.SDKTime{Time: time.Now()}
+		test.modify(session)
+
+		sessionId, err := FindReusableSession(backend, fake.BastionId, "managed", *session.KeyDetails.PublicKeyContent, "10.0.1.10", 22, 0, "opc", 1800)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := sessionId != nil; got != test.want {
+			t.Errorf("%s: session reused = %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPruneBastionSessionsCreating(t *testing.T) {
+	tests := []struct {
+		name     string
+		matchKey bool
+		want     bool
+	}{
+		// Without a creation time the session isn't older than --older-than
+		{"older than", false, false},
+		{"key", true, true},
+	}
+
+	for _, test := range tests {
+		backend := newBackend(t, 0)
+
+		// A session being created, OCI doesn't return its creation time yet
+		session := backend.Sessions[0]
+		session.Id = common.String("ocid1.bastionsession.oc1.iad.creating")
+		session.DisplayName = common.String("oshiv-creating")
+		session.LifecycleState = bastion.SessionLifecycleStateCreating
+		session.TimeCreated = nil
+		backend.Sessions = append(backend.Sessions, session)
+
+		var publicKey string
+		if test.matchKey {
+			publicKey = *session.KeyDetails.PublicKeyContent
+		}
+
+		pruned, err := PruneBastionSessions(backend, fake.BastionId, publicKey, time.Hour, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var found bool
+		for _, prunedSession := range pruned {
+			if prunedSession.Id == *session.Id {
+				found = true
+				if !prunedSession.TimeCreated.IsZero() {
+					t.Errorf("%s: created = %s, want zero time", test.name, prunedSession.TimeCreated)
+				}
+			}
+		}
+
+		if found != test.want {
+			t.Errorf("%s: session pruned = %t, want %t", test.name, found, test.want)
+		}
+	}
+}
+
+func TestListBastionSessionsMissingFields(t *testing.T) {
+	t.Cleanup(func() { viper.Set("output", "") })
+
+	for _, output := range []string{"", "table", "json"} {
+		backend := newBackend(t, 0)
+
+		// Not returned by OCI, E.g. while the session is created
+		backend.Sessions[0].DisplayName = nil
+		backend.Sessions[0].TimeCreated = nil
+
+		viper.Set("output", output)
+		err := ListBastionSessions(backend, fake.BastionId, "tenancy", "prod", false)
+		if err != nil {
+			t.Errorf("output %q: %v", output, err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package resources
+
+import (
+	"context"
+
+	"github.com/oracle/oci-go-sdk/v65/bastion"
+	"github.com/oracle/oci-go-sdk/v65/containerengine"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/database"
+	"github.com/oracle/oci-go-sdk/v65/identity"
+)
+
+// OCI client methods used by resources, implemented by the OCI SDK clients (pointers, E.g. *core.ComputeClient)
+// and by the fake OCI backend (internal/fake) used in tests
+// Endpoint identifies the client's region, it is part of cache keys (see utils.Cached)
+
+type ComputeClient interface {
+	Endpoint() string
+	ListInstances(ctx context.Context, request core.ListInstancesRequest) (core.ListInstancesResponse, error)
+	GetInstance(ctx context.Context, request core.GetInstanceRequest) (core.GetInstanceResponse, error)
+	InstanceAction(ctx context.Context, request core.InstanceActionRequest) (core.InstanceActionResponse, error)
+	ListVnicAttachments(ctx context.Context, request core.ListVnicAttachmentsRequest) (core.ListVnicAttachmentsResponse, error)
+	ListImages(ctx context.Context, request core.ListImagesRequest) (core.ListImagesResponse, error)
+	GetImage(ctx context.Context, request core.GetImageRequest) (core.GetImageResponse, error)
+}
+
+type VirtualNetworkClient interface {
+	Endpoint() string
+	ListSubnets(ctx context.Context, request core.ListSubnetsRequest) (core.ListSubnetsResponse, error)
+	GetSubnet(ctx context.Context, request core.GetSubnetRequest) (core.GetSubnetResponse, error)
+	GetVcn(ctx context.Context, request core.GetVcnRequest) (core.GetVcnResponse, error)
+	GetVnic(ctx context.Context, request core.GetVnicRequest) (core.GetVnicResponse, error)
+	ListPrivateIps(ctx context.Context, request core.ListPrivateIpsRequest) (core.ListPrivateIpsResponse, error)
+}
+
+type IdentityClient interface {
+	Endpoint() string
+	ListCompartments(ctx context.Context, request identity.ListCompartmentsRequest) (identity.ListCompartmentsResponse, error)
+	ListPolicies(ctx context.Context, request identity.ListPoliciesRequest) (identity.ListPoliciesResponse, error)
+}
+
+type ContainerEngineClient interface {
+	Endpoint() string
+	ListClusters(ctx context.Context, request containerengine.ListClustersRequest) (containerengine.ListClustersResponse, error)
+}
+
+type DatabaseClient interface {
+	Endpoint() string
+	ListAutonomousDatabases(ctx context.Context, request database.ListAutonomousDatabasesRequest) (database.ListAutonomousDatabasesResponse, error)
+}
+
+type BastionClient interface {
+	Endpoint() string
+	ListBastions(ctx context.Context, request bastion.ListBastionsRequest) (bastion.ListBastionsResponse, error)
+	GetBastion(ctx context.Context, request bastion.GetBastionRequest) (bastion.GetBastionResponse, error)
+	ListSessions(ctx context.Context, request bastion.ListSessionsRequest) (bastion.ListSessionsResponse, error)
+	GetSession(ctx context.Context, request bastion.GetSessionRequest) (bastion.GetSessionResponse, error)
+	CreateSession(ctx context.Context, request bastion.CreateSessionRequest) (bastion.CreateSessionResponse, error)
+	DeleteSession(ctx context.Context, request bastion.DeleteSessionRequest) (bastion.DeleteSessionResponse, error)
+}
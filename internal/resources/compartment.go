@@ -6,110 +6,278 @@ import (
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/cnopslabs/oshiv/internal/utils"
+	"github.com/oracle/oci-go-sdk/v65/common"
 	"github.com/oracle/oci-go-sdk/v65/identity"
-	"github.com/rodaine/table"
-	"github.com/spf13/viper"
 )
 
-// Fetch compartments (names/IDs) from OCI
-func FetchCompartments(tenancyId string, identityClient identity.IdentityClient) map[string]string {
-	response, err := identityClient.ListCompartments(context.Background(), identity.ListCompartmentsRequest{CompartmentId: &tenancyId})
-	utils.CheckError(err)
+type Compartment struct {
+	Name     string `json:"name" yaml:"name"`
+	Id       string `json:"id" yaml:"id"`
+	Path     string `json:"path" yaml:"path"` // Names from the root compartment down, E.g. prod/network (the tenancy name for the root compartment)
+	ParentId string `json:"parent_id,omitempty" yaml:"parent_id,omitempty"`
+}
+
+// Fetch all active compartments of the tenancy, including nested compartments, sorted by path (OCI API call, cached see utils.Cached)
+func FetchCompartments(tenancyId string, identityClient IdentityClient) ([]Compartment, error) {
+	return utils.Cached(identityClient.Endpoint(), tenancyId, "compartments", false, func() ([]Compartment, error) {
+		var items []identity.Compartment
+		var page *string
+
+		for {
+			response, err := identityClient.ListCompartments(context.Background(), identity.ListCompartmentsRequest{
+				CompartmentId:          &tenancyId,
+				CompartmentIdInSubtree: common.Bool(true),
+				AccessLevel:            identity.ListCompartmentsAccessLevelAny,
+				LifecycleState:         identity.CompartmentLifecycleStateActive,
+				Page:                   page,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("unable to list compartments: %w", err)
+			}
+
+			items = append(items, response.Items...)
+
+			if response.OpcNextPage == nil {
+				break
+			}
+			page = response.OpcNextPage
+		}
+
+		parents := make(map[string]identity.Compartment)
+		for _, item := range items {
+			parents[*item.Id] = item
+		}
+
+		var compartments []Compartment
+		for _, item := range items {
+			compartments = append(compartments, Compartment{*item.Name, *item.Id, compartmentPath(parents, tenancyId, item), *item.CompartmentId})
+		}
+
+		sort.Slice(compartments, func(i, j int) bool { return compartments[i].Path < compartments[j].Path })
 
-	compartments := make(map[string]string)
+		return compartments, nil
+	})
+}
 
-	for _, item := range response.Items {
-		compartments[*item.Name] = *item.Id
+// Build the path of a compartment from the names of its parents, the root compartment is not included
+func compartmentPath(parents map[string]identity.Compartment, tenancyId string, compartment identity.Compartment) string {
+	path := *compartment.Name
+
+	for parentId := *compartment.CompartmentId; parentId != tenancyId; {
+		parent, found := parents[parentId]
+		if !found {
+			break
+		}
+
+		path = *parent.Name + "/" + path
+		parentId = *parent.CompartmentId
 	}
 
-	return compartments
+	return path
 }
 
-// Sort, list, and print compartments
-func ListCompartments(compartments map[string]string, tenancyId string, tenancyName string) {
-	tbl := table.New("Compartment Name", "OCID")
-	tbl.WithHeaderFormatter(utils.HeaderFmt).WithFirstColumnFormatter(utils.ColumnFmt)
+// Return the compartments nested under a compartment (at any depth), sorted by path
+func CompartmentSubtree(compartments []Compartment, tenancyId string, compartmentId string) []Compartment {
+	if compartmentId == tenancyId {
+		return compartments
+	}
+
+	inSubtree := map[string]bool{compartmentId: true}
+	var subtree []Compartment
 
-	compartmentNames := make([]string, 0, len(compartments))
-	for compartmentName := range compartments {
-		compartmentNames = append(compartmentNames, compartmentName)
+	// Compartments are sorted by path, so parents are always seen before their children
+	for _, compartment := range compartments {
+		if inSubtree[compartment.ParentId] {
+			inSubtree[compartment.Id] = true
+			subtree = append(subtree, compartment)
+		}
+	}
+
+	return subtree
+}
+
+// Return the path of a compartment, the tenancy name for the root compartment
+func LookupCompartmentPath(compartments []Compartment, tenancyId string, tenancyName string, compartmentId string) string {
+	if compartmentId == tenancyId {
+		return tenancyName
 	}
-	sort.Strings(compartmentNames)
 
+	for _, compartment := range compartments {
+		if compartment.Id == compartmentId {
+			return compartment.Path
+		}
+	}
+
+	return ""
+}
+
+// Sort, list, and print compartments
+func ListCompartments(compartments []Compartment, tenancyId string, tenancyName string) error {
 	// List the root compartment first
-	tbl.AddRow(tenancyName, tenancyId)
+	compartmentList := append([]Compartment{{tenancyName, tenancyId, tenancyName, ""}}, compartments...)
 
-	for _, compartmentName := range compartmentNames {
-		tbl.AddRow(compartmentName, compartments[compartmentName])
+	if utils.StructuredOutput() {
+		return printCompartments(compartmentList)
 	}
 
 	utils.FaintMagenta.Println("Tenancy: " + tenancyName)
-	tbl.Print()
+	err := printCompartments(compartmentList)
+	if err != nil {
+		return err
+	}
 
-	fmt.Println("\nTo set Compartment, export the OCI_COMPARTMENT environment variable")
+	fmt.Println("\nTo set Compartment, run 'oshiv context set -c COMPARTMENT_NAME' or export the OCI_COMPARTMENT environment variable")
 	fmt.Println("\nIf using oshell, run:")
 	fmt.Print("oci_set_tenancy ")
 	utils.Yellow.Println("TENANCY_NAME COMPARTMENT_NAME ")
+
+	return nil
 }
 
-func FindCompartments(tenancyId string, tenancyName string, identityClient identity.IdentityClient, namePattern string) {
-	compartments := FetchCompartments(tenancyId, identityClient)
+func FindCompartments(tenancyId string, tenancyName string, identityClient IdentityClient, namePattern string) error {
+	compartments, err := FetchCompartments(tenancyId, identityClient)
+	if err != nil {
+		return err
+	}
 
-	var matches []string
+	var matches []Compartment
 
 	if namePattern == "*" {
 		namePattern = ".*"
 	}
 
-	for name := range compartments {
-		match, _ := regexp.MatchString(namePattern, name)
+	for _, compartment := range compartments {
+		match, _ := regexp.MatchString(namePattern, compartment.Name)
 		if match {
-			matches = append(matches, name)
+			matches = append(matches, compartment)
 		}
 	}
 
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Name < matches[j].Name })
+
+	if utils.StructuredOutput() {
+		return printCompartments(matches)
+	}
+
 	matchCount := len(matches)
 	utils.Faint.Println(strconv.Itoa(matchCount) + " matches")
 
-	tbl := table.New("Compartment Name", "OCID")
-	tbl.WithHeaderFormatter(utils.HeaderFmt).WithFirstColumnFormatter(utils.ColumnFmt)
+	utils.FaintMagenta.Println("Tenancy: " + tenancyName)
+	err = printCompartments(matches)
+	if err != nil {
+		return err
+	}
 
-	for _, compartmentName := range matches {
-		compartmentId := compartments[compartmentName]
-		tbl.AddRow(compartmentName, compartmentId)
+	fmt.Println("\nTo set compartment, run:")
+	utils.Yellow.Println("   oshiv context set -c COMPARTMENT_NAME")
+
+	return nil
+}
+
+// Print compartments as a table, or in the format set by --output
+func printCompartments(compartments []Compartment) error {
+	columns := []utils.Column{{Header: "Compartment Name"}, {Header: "Path"}, {Header: "OCID"}}
+
+	var rows [][]string
+	for _, compartment := range compartments {
+		rows = append(rows, []string{compartment.Name, compartment.Path, compartment.Id})
 	}
 
-	utils.FaintMagenta.Println("Tenancy: " + tenancyName)
-	tbl.Print()
+	return utils.PrintOutput(compartments, columns, rows)
+}
 
-	fmt.Println("\nTo set compartment, run:")
-	utils.Yellow.Println("   oshiv compartment -s COMPARTMENT_NAME")
+// Render the compartment hierarchy as a tree, or list compartments in the format set by --output
+func PrintCompartmentTree(compartments []Compartment, tenancyId string, tenancyName string) error {
+	if utils.OutputFormat() != "" {
+		// Structured output is the flat list, parent IDs and paths describe the hierarchy
+		return ListCompartments(compartments, tenancyId, tenancyName)
+	}
+
+	children := make(map[string][]Compartment)
+	for _, compartment := range compartments {
+		children[compartment.ParentId] = append(children[compartment.ParentId], compartment)
+	}
+
+	for _, siblings := range children {
+		sort.SliceStable(siblings, func(i, j int) bool { return siblings[i].Name < siblings[j].Name })
+	}
+
+	utils.Blue.Println(tenancyName)
+	printCompartmentBranch(children, tenancyId, "")
+
+	return nil
 }
 
-// Sets compartment name in Viper config
-func SetCompartmentName(compartmentName string) {
-	utils.Logger.Debug("Setting compartment: " + compartmentName)
-	viper.Set("compartment-name", compartmentName)
-	// Note: Compartment is the only attribute we persist to files
-	utils.Logger.Debug("Writing config: " + "compartment-name" + ": " + compartmentName)
-	viper.WriteConfig()
+// Print the children of a compartment, and their children, with box drawing indentation
+func printCompartmentBranch(children map[string][]Compartment, parentId string, indent string) {
+	siblings := children[parentId]
+
+	for i, compartment := range siblings {
+		branch, childIndent := "├── ", "│   "
+		if i == len(siblings)-1 {
+			branch, childIndent = "└── ", "    "
+		}
+
+		utils.Faint.Print(indent + branch)
+		fmt.Println(compartment.Name)
+
+		printCompartmentBranch(children, compartment.Id, indent+childIndent)
+	}
 }
 
-// Determine compartment name or ID, lookup name from ID if ID is given
-func LookupCompartmentId(compartments map[string]string, tenancyId string, tenancyName string, compartmentName string) string {
-	var compartmentId string
+// Check if a compartment name or path (E.g. prod/network/dmz) exists in the tenancy
+func CompartmentExists(compartments []Compartment, compartment string) bool {
+	return len(matchCompartment(compartments, compartment)) > 0
+}
 
+// Return the compartments matching a compartment path, or a compartment name (which may match several nested compartments)
+// A leading or trailing "/" makes a path, E.g. /prod only matches the top level prod compartment
+func matchCompartment(compartments []Compartment, compartment string) []Compartment {
+	var matches []Compartment
+
+	name := strings.Trim(compartment, "/")
+	isPath := name != compartment || strings.Contains(name, "/")
+
+	for _, candidate := range compartments {
+		if (isPath && candidate.Path == name) || (!isPath && candidate.Name == name) {
+			matches = append(matches, candidate)
+		}
+	}
+
+	return matches
+}
+
+// Lookup the ID of a compartment by name or path (E.g. prod/network/dmz), the tenancy name is the root compartment
+// Returns an error if the compartment doesn't exist, or a name is shared by several nested compartments (use the path instead)
+func LookupCompartmentId(compartments []Compartment, tenancyId string, tenancyName string, compartment string) (string, error) {
 	// Handle root compartment
-	if compartmentName == tenancyName {
-		compartmentId = tenancyId
-	} else {
-		// compartmentId = lookupCompartmentId(compartments, compartmentName)
-		compartmentId = compartments[compartmentName]
+	if compartment == tenancyName {
+		utils.Logger.Debug("Compartment: " + compartment + "(" + tenancyId + ")")
+		return tenancyId, nil
+	}
+
+	matches := matchCompartment(compartments, compartment)
+
+	switch len(matches) {
+	case 0:
+		return "", utils.UsageError("compartment " + compartment + " not found in tenancy " + tenancyName)
+	case 1:
+		utils.Logger.Debug("Compartment: " + compartment + "(" + matches[0].Id + ")")
+		return matches[0].Id, nil
 	}
 
-	utils.Logger.Debug("Compartment: " + compartmentName + "(" + compartmentId + ")")
+	var paths []string
+	for _, match := range matches {
+		// A top level path is the same as its name, the leading "/" makes it a path
+		if !strings.Contains(match.Path, "/") {
+			paths = append(paths, "/"+match.Path)
+		} else {
+			paths = append(paths, match.Path)
+		}
+	}
 
-	return compartmentId
+	return "", utils.UsageError("compartment name " + compartment + " is ambiguous, use its path: " + strings.Join(paths, ", "))
 }
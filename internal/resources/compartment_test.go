@@ -0,0 +1,65 @@
+package resources
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cnopslabs/oshiv/internal/utils"
+)
+
+func TestLookupCompartmentId(t *testing.T) {
+	compartments := []Compartment{
+		{"dev", "ocid1.compartment.oc1..dev", "dev", "ocid1.tenancy.oc1..fake"},
+		{"network", "ocid1.compartment.oc1..devnetwork", "dev/network", "ocid1.compartment.oc1..dev"},
+		{"prod", "ocid1.compartment.oc1..devprod", "dev/prod", "ocid1.compartment.oc1..dev"},
+		{"prod", "ocid1.compartment.oc1..prod", "prod", "ocid1.tenancy.oc1..fake"},
+		{"network", "ocid1.compartment.oc1..prodnetwork", "prod/network", "ocid1.compartment.oc1..prod"},
+	}
+
+	tests := []struct {
+		name        string
+		compartment string
+		want        string
+		wantError   string
+	}{
+		{"root", "fake-tenancy", "ocid1.tenancy.oc1..fake", ""},
+		{"name", "dev", "ocid1.compartment.oc1..dev", ""},
+		{"path", "prod/network", "ocid1.compartment.oc1..prodnetwork", ""},
+		{"path with slashes", "/dev/network/", "ocid1.compartment.oc1..devnetwork", ""},
+		{"leading slash", "/prod", "ocid1.compartment.oc1..prod", ""},
+		{"trailing slash", "prod/", "ocid1.compartment.oc1..prod", ""},
+		{"leading slash of a nested name", "/network", "", "compartment /network not found"},
+		{"ambiguous name", "prod", "", "compartment name prod is ambiguous, use its path: dev/prod, /prod"},
+		{"ambiguous nested name", "network", "", "use its path: dev/network, prod/network"},
+		{"not found", "missing", "", "compartment missing not found in tenancy fake-tenancy"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			id, err := LookupCompartmentId(compartments, "ocid1.tenancy.oc1..fake", "fake-tenancy", test.compartment)
+
+			if test.wantError != "" {
+				var exitErr *utils.ExitCodeError
+				if !errors.As(err, &exitErr) || exitErr.Code != utils.ExitUsage {
+					t.Fatalf("error = %v, want usage error", err)
+				}
+				if !strings.Contains(err.Error(), test.wantError) {
+					t.Errorf("error = %q, want %q", err, test.wantError)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != test.want {
+				t.Errorf("id = %s, want %s", id, test.want)
+			}
+
+			if !CompartmentExists(compartments, test.compartment) && test.compartment != "fake-tenancy" {
+				t.Errorf("CompartmentExists(%s) = false, want true", test.compartment)
+			}
+		})
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/cnopslabs/oshiv/internal/utils"
@@ -12,58 +11,83 @@ import (
 )
 
 type Database struct {
-	name              string
-	id                string
-	privateEndpointIp string
-	connectStrings    map[string]string
-	profiles          []database.DatabaseConnectionStringProfile
+	Name              string                      `json:"name" yaml:"name"`
+	Id                string                      `json:"id" yaml:"id"`
+	PrivateEndpointIp string                      `json:"private_endpoint_ip" yaml:"private_endpoint_ip"`
+	State             string                      `json:"state" yaml:"state"`
+	ConnectStrings    map[string]string           `json:"connect_strings" yaml:"connect_strings"`
+	Profiles          []DatabaseConnectionProfile `json:"profiles" yaml:"profiles"`
+	Region            string                      `json:"region,omitempty" yaml:"region,omitempty"`           // Only set with --all-regions
+	Compartment       string                      `json:"compartment,omitempty" yaml:"compartment,omitempty"` // Compartment path, only set with --recursive
 }
 
-// Fetch all databases via OCI API call
-func fetchDatabases(databaseClient database.DatabaseClient, compartmentId string) []Database {
-	var databases []Database
-
-	initialResponse, err := databaseClient.ListAutonomousDatabases(context.Background(), database.ListAutonomousDatabasesRequest{CompartmentId: &compartmentId})
-	utils.CheckError(err)
+type DatabaseConnectionProfile struct {
+	Name  string `json:"name" yaml:"name"`
+	Value string `json:"value" yaml:"value"`
+}
 
-	for _, database := range initialResponse.Items {
-		databaseName := *database.DbName
-		databaseId := *database.Id
-		databaseIp := *database.PrivateEndpointIp
-		databaseConnectStrings := database.ConnectionStrings.AllConnectionStrings
-		databaseProfiles := database.ConnectionStrings.Profiles
+// Convert SDK connection string profiles
+func databaseConnectionProfiles(profiles []database.DatabaseConnectionStringProfile) []DatabaseConnectionProfile {
+	var databaseProfiles []DatabaseConnectionProfile
 
-		database := Database{databaseName, databaseId, databaseIp, databaseConnectStrings, databaseProfiles}
-		databases = append(databases, database)
+	for _, profile := range profiles {
+		databaseProfiles = append(databaseProfiles, DatabaseConnectionProfile{*profile.DisplayName, *profile.Value})
 	}
 
-	if initialResponse.OpcNextPage != nil {
-		nextPage := initialResponse.OpcNextPage
+	return databaseProfiles
+}
+
+// Fetch all databases via OCI API call, cached (see utils.Cached)
+func fetchDatabases(databaseClient DatabaseClient, compartmentId string) ([]Database, error) {
+	return utils.Cached(databaseClient.Endpoint(), compartmentId, "databases", false, func() ([]Database, error) {
+		var databases []Database
 
-		for {
-			response, err := databaseClient.ListAutonomousDatabases(context.Background(), database.ListAutonomousDatabasesRequest{CompartmentId: &compartmentId, Page: nextPage})
-			utils.CheckError(err)
+		initialResponse, err := databaseClient.ListAutonomousDatabases(context.Background(), database.ListAutonomousDatabasesRequest{CompartmentId: &compartmentId})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list autonomous databases: %w", err)
+		}
 
-			for _, database := range response.Items {
-				databaseName := *database.DbName
-				databaseId := *database.Id
-				databaseIp := *database.PrivateEndpoint
-				databaseConnectStrings := database.ConnectionStrings.AllConnectionStrings
-				databaseProfiles := database.ConnectionStrings.Profiles
+		for _, database := range initialResponse.Items {
+			databaseName := *database.DbName
+			databaseId := *database.Id
+			databaseIp := *database.PrivateEndpointIp
+			databaseConnectStrings := database.ConnectionStrings.AllConnectionStrings
+			databaseProfiles := databaseConnectionProfiles(database.ConnectionStrings.Profiles)
 
-				database := Database{databaseName, databaseId, databaseIp, databaseConnectStrings, databaseProfiles}
-				databases = append(databases, database)
-			}
+			database := Database{databaseName, databaseId, databaseIp, string(database.LifecycleState), databaseConnectStrings, databaseProfiles, "", ""}
+			databases = append(databases, database)
+		}
+
+		if initialResponse.OpcNextPage != nil {
+			nextPage := initialResponse.OpcNextPage
 
-			if response.OpcNextPage != nil {
-				nextPage = response.OpcNextPage
-			} else {
-				break
+			for {
+				response, err := databaseClient.ListAutonomousDatabases(context.Background(), database.ListAutonomousDatabasesRequest{CompartmentId: &compartmentId, Page: nextPage})
+				if err != nil {
+					return nil, fmt.Errorf("unable to list autonomous databases: %w", err)
+				}
+
+				for _, database := range response.Items {
+					databaseName := *database.DbName
+					databaseId := *database.Id
+					databaseIp := *database.PrivateEndpointIp
+					databaseConnectStrings := database.ConnectionStrings.AllConnectionStrings
+					databaseProfiles := databaseConnectionProfiles(database.ConnectionStrings.Profiles)
+
+					database := Database{databaseName, databaseId, databaseIp, string(database.LifecycleState), databaseConnectStrings, databaseProfiles, "", ""}
+					databases = append(databases, database)
+				}
+
+				if response.OpcNextPage != nil {
+					nextPage = response.OpcNextPage
+				} else {
+					break
+				}
 			}
 		}
-	}
 
-	return databases
+		return databases, nil
+	})
 }
 
 // Match pattern and return database matches
@@ -76,7 +100,7 @@ func matchDatabases(pattern string, databases []Database) []Database {
 	}
 
 	for _, database := range databases {
-		match, _ := regexp.MatchString("(?i)"+pattern, database.name)
+		match, _ := regexp.MatchString("(?i)"+pattern, database.Name)
 		if match {
 			matches = append(matches, database)
 		}
@@ -85,73 +109,100 @@ func matchDatabases(pattern string, databases []Database) []Database {
 	return matches
 }
 
-// Find databases matching search pattern
-func FindDatabases(databaseClient database.DatabaseClient, compartmentId string, searchString string) []Database {
-	var databaseMatches []Database
-	databases := fetchDatabases(databaseClient, compartmentId)
+// Find databases matching search pattern, all databases if the pattern is empty
+func FindDatabases(databaseClient DatabaseClient, compartmentId string, searchString string) ([]Database, error) {
+	databases, err := fetchDatabases(databaseClient, compartmentId)
+	if err != nil {
+		return nil, err
+	}
 
 	if searchString != "" {
-		// Find matching databases
-		pattern := searchString
-		databaseMatches = matchDatabases(pattern, databases)
-		utils.Faint.Println(strconv.Itoa(len(databaseMatches)) + " matches")
-	} else {
-		// List all databases
-		databaseMatches = databases
-		utils.Faint.Println(strconv.Itoa(len(databaseMatches)) + " databases(s)")
+		return matchDatabases(searchString, databases), nil
 	}
 
-	return databaseMatches
+	return databases, nil
 }
 
-// Print databases
-func PrintDatabases(databases []Database, tenancyName string, compartmentName string) {
+// Determine service name and common name (CN) from the "High" connect string
+func databaseServiceName(connectStrings map[string]string) (string, string) {
+	for serviceType, connectString := range connectStrings {
+		// Use "High" service for admin / troubleshooting
+		if serviceType == "HIGH" {
+			connectStringParts := strings.Split(connectString, "/")
+			serviceName := connectStringParts[1]
+			commonNamePort := connectStringParts[0]
+			commonNamePortParts := strings.Split(commonNamePort, ":")
+			commonName := commonNamePortParts[0]
+
+			return serviceName, commonName
+		}
+	}
+
+	return "", ""
+}
+
+// Print databases, detailed text by default or in the format set by --output
+// The region and compartment are included when databases span regions (--all-regions) or compartments (--recursive)
+func PrintDatabases(databases []Database, tenancyName string, compartmentName string, scope Scope) error {
+	if utils.OutputFormat() != "" {
+		columns := []utils.Column{{Header: "Name"}, {Header: "Private Endpoint"}, {Header: "State"}, {Header: "Service Name", Wide: true}, {Header: "OCID", Wide: true}}
+		columns = scope.columns(columns)
+
+		var rows [][]string
+		for _, database := range databases {
+			serviceName, _ := databaseServiceName(database.ConnectStrings)
+			row := []string{database.Name, database.PrivateEndpointIp, database.State, serviceName, database.Id}
+			row = scope.row(database.Region, database.Compartment, row)
+			rows = append(rows, row)
+		}
+
+		if !utils.StructuredOutput() {
+			utils.FaintMagenta.Println("Tenancy(Compartment): " + tenancyName + "(" + compartmentName + ")")
+		}
+		return utils.PrintOutput(databases, columns, rows)
+	}
+
 	if len(databases) > 0 {
 		utils.FaintMagenta.Println("Tenancy(Compartment): " + tenancyName + "(" + compartmentName + ")")
 
 		for _, database := range databases {
 			fmt.Print("Name: ")
-			utils.Blue.Println(database.name)
+			utils.Blue.Println(database.Name)
 			fmt.Print("Database ID: ")
-			utils.Yellow.Println(database.id)
+			utils.Yellow.Println(database.Id)
+			scope.print(database.Region, database.Compartment)
 			fmt.Print("Private endpoint: ")
-			utils.Yellow.Println(database.privateEndpointIp)
+			utils.Yellow.Println(database.PrivateEndpointIp)
 
-			for serviceType, connectString := range database.connectStrings {
-				connectStringParts := strings.Split(connectString, "/")
-				serviceName := connectStringParts[1]
-				commonNamePort := connectStringParts[0]
-				commonNamePortParts := strings.Split(commonNamePort, ":")
-				commonName := commonNamePortParts[0]
+			serviceName, commonName := databaseServiceName(database.ConnectStrings)
+			if serviceName != "" {
+				fmt.Print("Service name: ")
+				utils.Yellow.Println(serviceName)
 
-				// Use "High" service for admin / troubleshooting
-				if serviceType == "HIGH" {
-					fmt.Print("Service name: ")
-					utils.Yellow.Println(serviceName)
-
-					fmt.Print("Common name (CN): ")
-					utils.Yellow.Println(commonName)
-				}
+				fmt.Print("Common name (CN): ")
+				utils.Yellow.Println(commonName)
 			}
 
 			fmt.Println("")
 			fmt.Println("Connect strings:")
 
-			for _, profile := range database.profiles {
+			for _, profile := range database.Profiles {
 				// Use "High" service for admin / troubleshooting
-				if strings.Contains(*profile.DisplayName, "high") {
-					if strings.Contains(*profile.Value, "1521") {
+				if strings.Contains(profile.Name, "high") {
+					if strings.Contains(profile.Value, "1521") {
 						utils.Italic.Println("Standard")
-						utils.Yellow.Println(*profile.Value)
+						utils.Yellow.Println(profile.Value)
 					}
 
-					if strings.Contains(*profile.Value, "1522") {
+					if strings.Contains(profile.Value, "1522") {
 						fmt.Println("")
 						utils.Italic.Println("MTLS")
-						utils.Yellow.Println(*profile.Value)
+						utils.Yellow.Println(profile.Value)
 					}
 				}
 			}
 		}
 	}
+
+	return nil
 }
@@ -0,0 +1,33 @@
+package resources
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cnopslabs/oshiv/internal/fake"
+)
+
+func TestFetchDatabasesPagination(t *testing.T) {
+	backend := newBackend(t, 2)
+
+	databases, err := fetchDatabases(backend, fake.CompartmentId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Databases on every page have their private endpoint IP
+	var ips []string
+	for _, database := range databases {
+		ips = append(ips, database.PrivateEndpointIp)
+	}
+
+	want := []string{"10.0.2.50", "10.0.2.51", "10.0.2.52"}
+	if !reflect.DeepEqual(ips, want) {
+		t.Errorf("private endpoint IPs = %v, want %v", ips, want)
+	}
+
+	serviceName, _ := databaseServiceName(databases[2].ConnectStrings)
+	if serviceName != "abc_reports_high.adb.oraclecloud.com" {
+		t.Errorf("service name = %q", serviceName)
+	}
+}
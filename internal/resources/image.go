@@ -4,126 +4,162 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/cnopslabs/oshiv/internal/utils"
-	"github.com/oracle/oci-go-sdk/v65/common"
 	"github.com/oracle/oci-go-sdk/v65/core"
 )
 
 type Image struct {
-	name        string
-	id          string
-	cDate       common.SDKTime
-	freeTags    map[string]string
-	definedTags map[string]map[string]interface{}
-	launchMode  core.ImageLaunchModeEnum
+	Name         string                            `json:"name" yaml:"name"`
+	Id           string                            `json:"id" yaml:"id"`
+	TimeCreated  time.Time                         `json:"time_created" yaml:"time_created"`
+	FreeformTags map[string]string                 `json:"freeform_tags" yaml:"freeform_tags"`
+	DefinedTags  map[string]map[string]interface{} `json:"defined_tags" yaml:"defined_tags"`
+	LaunchMode   core.ImageLaunchModeEnum          `json:"launch_mode" yaml:"launch_mode"`
+	Region       string                            `json:"region,omitempty" yaml:"region,omitempty"`           // Only set with --all-regions
+	Compartment  string                            `json:"compartment,omitempty" yaml:"compartment,omitempty"` // Compartment path, only set with --recursive
 }
 
 // Fetch image object by ID via OCI API call
-func fetchImage(computeClient core.ComputeClient, imageId string) Image {
+func fetchImage(computeClient ComputeClient, imageId string) (Image, error) {
 	var image Image
 
 	response, err := computeClient.GetImage(context.Background(), core.GetImageRequest{ImageId: &imageId})
-	utils.CheckError(err)
+	if err != nil {
+		return image, fmt.Errorf("unable to get image %s: %w", imageId, err)
+	}
 
 	image = Image{
 		*response.DisplayName,
 		*response.Id,
-		*response.TimeCreated,
+		response.TimeCreated.Time,
 		response.FreeformTags,
 		response.DefinedTags,
 		response.LaunchMode,
+		"",
+		"",
 	}
 
-	return image
+	return image, nil
 }
 
-// Fetch all images via OCI API call
-func fetchImages(computeClient core.ComputeClient, compartmentId string) []Image {
-	var images []Image
-	var pageCount int
-	pageCount = 0
-
-	initialResponse, err := computeClient.ListImages(context.Background(), core.ListImagesRequest{CompartmentId: &compartmentId})
-	utils.CheckError(err)
-
-	for _, item := range initialResponse.Items {
-		pageCount += 1
-		// if item.LaunchMode == core.ImageLaunchModeCustom {
-		image := Image{
-			*item.DisplayName,
-			*item.Id,
-			*item.TimeCreated,
-			item.FreeformTags,
-			item.DefinedTags,
-			item.LaunchMode,
+// Fetch all images via OCI API call, cached (see utils.Cached)
+func FetchImages(computeClient ComputeClient, compartmentId string) ([]Image, error) {
+	return utils.Cached(computeClient.Endpoint(), compartmentId, "images", false, func() ([]Image, error) {
+		var images []Image
+		var pageCount int
+		pageCount = 0
+
+		initialResponse, err := computeClient.ListImages(context.Background(), core.ListImagesRequest{CompartmentId: &compartmentId})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list images: %w", err)
 		}
 
-		images = append(images, image)
-		// }
-	}
+		for _, item := range initialResponse.Items {
+			pageCount += 1
+			// if item.LaunchMode == core.ImageLaunchModeCustom {
+			image := Image{
+				*item.DisplayName,
+				*item.Id,
+				item.TimeCreated.Time,
+				item.FreeformTags,
+				item.DefinedTags,
+				item.LaunchMode,
+				"",
+				"",
+			}
 
-	if initialResponse.OpcNextPage != nil {
-		pageCount += 1
-		nextPage := initialResponse.OpcNextPage
-
-		for {
-			response, err := computeClient.ListImages(context.Background(), core.ListImagesRequest{CompartmentId: &compartmentId, Page: nextPage})
-			utils.CheckError(err)
-
-			for _, item := range response.Items {
-				// if item.LaunchMode == core.ImageLaunchModeCustom {
-				image := Image{
-					*item.DisplayName,
-					*item.Id,
-					*item.TimeCreated,
-					item.FreeformTags,
-					item.DefinedTags,
-					item.LaunchMode,
+			images = append(images, image)
+			// }
+		}
+
+		if initialResponse.OpcNextPage != nil {
+			pageCount += 1
+			nextPage := initialResponse.OpcNextPage
+
+			for {
+				response, err := computeClient.ListImages(context.Background(), core.ListImagesRequest{CompartmentId: &compartmentId, Page: nextPage})
+				if err != nil {
+					return nil, fmt.Errorf("unable to list images: %w", err)
 				}
 
-				images = append(images, image)
-				// }
-			}
+				for _, item := range response.Items {
+					// if item.LaunchMode == core.ImageLaunchModeCustom {
+					image := Image{
+						*item.DisplayName,
+						*item.Id,
+						item.TimeCreated.Time,
+						item.FreeformTags,
+						item.DefinedTags,
+						item.LaunchMode,
+						"",
+						"",
+					}
+
+					images = append(images, image)
+					// }
+				}
 
-			if response.OpcNextPage != nil {
-				nextPage = response.OpcNextPage
-			} else {
-				break
+				if response.OpcNextPage != nil {
+					nextPage = response.OpcNextPage
+				} else {
+					break
+				}
 			}
 		}
-	}
 
-	return images
+		return images, nil
+	})
 }
 
-// List and print images (OCI API call)
-func ListImages(computeClient core.ComputeClient, compartmentId string, compartment string, tenancyName string) {
-	images := fetchImages(computeClient, compartmentId)
+// Print images, detailed text by default or in the format set by --output
+// The region and compartment are included when images span regions (--all-regions) or compartments (--recursive)
+func PrintImages(images []Image, tenancyName string, compartment string, scope Scope) error {
+	if utils.OutputFormat() != "" {
+		columns := []utils.Column{{Header: "Name"}, {Header: "Created"}, {Header: "Launch Mode"}, {Header: "OCID", Wide: true}}
+		columns = scope.columns(columns)
+
+		var rows [][]string
+		for _, image := range images {
+			row := []string{image.Name, image.TimeCreated.Format(time.RFC3339), string(image.LaunchMode), image.Id}
+			row = scope.row(image.Region, image.Compartment, row)
+			rows = append(rows, row)
+		}
+
+		if !utils.StructuredOutput() {
+			utils.FaintMagenta.Println("Tenancy(Compartment): " + tenancyName + "(" + compartment + ")")
+		}
+		return utils.PrintOutput(images, columns, rows)
+	}
 
 	utils.FaintMagenta.Println("Tenancy(Compartment): " + tenancyName + "(" + compartment + ")")
 
 	for _, image := range images {
 		fmt.Print("Name: ")
-		utils.Blue.Println(image.name)
+		utils.Blue.Println(image.Name)
 
 		fmt.Print("ID: ")
-		utils.Yellow.Println(image.id)
+		utils.Yellow.Println(image.Id)
+
+		scope.print(image.Region, image.Compartment)
 
 		fmt.Print("Create date: ")
-		utils.Yellow.Println(image.cDate)
+		utils.Yellow.Println(image.TimeCreated)
 
 		fmt.Println("Tags: ")
 
-		for k, v := range image.freeTags {
+		for k, v := range image.FreeformTags {
 			utils.Yellow.Println(k + ": " + v)
 		}
 
 		fmt.Print("Launch mode: ")
-		utils.Yellow.Println(image.launchMode)
+		utils.Yellow.Println(image.LaunchMode)
 
 		fmt.Println("")
 	}
 
 	fmt.Println(strconv.Itoa(len(images)) + " images found")
+
+	return nil
 }
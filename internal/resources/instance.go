@@ -2,8 +2,11 @@ package resources
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"regexp"
+	"net/http"
+	"os"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -16,573 +19,710 @@ import (
 
 // TODO: Add operating system from image
 type Instance struct {
-	name     string
-	id       string
-	ip       string
-	ad       string
-	shape    string
-	cDate    common.SDKTime
-	imageId  string
-	fd       string
-	vCPUs    int
-	mem      float32
-	region   string
-	state    core.InstanceLifecycleStateEnum
-	subnetId string
-	hostname string
+	Name         string                            `json:"name" yaml:"name"`
+	Id           string                            `json:"id" yaml:"id"`
+	Ip           string                            `json:"private_ip" yaml:"private_ip"`
+	Ad           string                            `json:"availability_domain" yaml:"availability_domain"`
+	Shape        string                            `json:"shape" yaml:"shape"`
+	TimeCreated  time.Time                         `json:"time_created" yaml:"time_created"`
+	ImageId      string                            `json:"image_id" yaml:"image_id"`
+	Fd           string                            `json:"fault_domain" yaml:"fault_domain"`
+	VCPUs        int                               `json:"vcpus" yaml:"vcpus"`
+	Mem          float32                           `json:"memory_gbs" yaml:"memory_gbs"`
+	Region       string                            `json:"region" yaml:"region"`
+	State        core.InstanceLifecycleStateEnum   `json:"state" yaml:"state"`
+	SubnetId     string                            `json:"subnet_id" yaml:"subnet_id"`
+	Hostname     string                            `json:"hostname" yaml:"hostname"`
+	FreeformTags map[string]string                 `json:"freeform_tags,omitempty" yaml:"freeform_tags,omitempty"`
+	DefinedTags  map[string]map[string]interface{} `json:"defined_tags,omitempty" yaml:"defined_tags,omitempty"`
+	Image        *Image                            `json:"image,omitempty" yaml:"image,omitempty"`             // Only looked up with --image-details
+	Compartment  string                            `json:"compartment,omitempty" yaml:"compartment,omitempty"` // Compartment path, only set with --recursive
 }
 
+// Private IP and hostname of a VNIC
 type vnicInfo struct {
-	ip       string
-	hostname string
+	Ip       string `json:"ip"`
+	Hostname string `json:"hostname"`
+}
+
+// VNIC and subnet IDs of instances by instance ID
+type vnicAttachments struct {
+	Vnics   map[string]string `json:"vnics"`
+	Subnets map[string]string `json:"subnets"`
 }
 
 // Sort instances by name
 type instancesByName []Instance
 
 func (instances instancesByName) Len() int           { return len(instances) }
-func (instances instancesByName) Less(i, j int) bool { return instances[i].name < instances[j].name }
+func (instances instancesByName) Less(i, j int) bool { return instances[i].Name < instances[j].Name }
 func (instances instancesByName) Swap(i, j int) {
 	instances[i], instances[j] = instances[j], instances[i]
 }
 
-// Fetch all VNIC attachments via OCI API call
+// Fetch all VNIC attachments via OCI API call, cached unless refresh (see utils.Cached)
 // This is used to determine instance private IP
-func fetchVnicAttachments(client core.ComputeClient, compartmentId string) (map[string]string, map[string]string) {
-	attachments := make(map[string]string)
-	attachments_subnets := make(map[string]string)
+func fetchVnicAttachments(client ComputeClient, compartmentId string, refresh bool) (map[string]string, map[string]string, error) {
+	result, err := utils.Cached(client.Endpoint(), compartmentId, "vnic-attachments", refresh, func() (vnicAttachments, error) {
+		attachments := make(map[string]string)
+		attachments_subnets := make(map[string]string)
+
+		// Instances keep the attachments of VNICs they no longer use (E.g. terminated instances), attached VNICs take precedence
+		attached := make(map[string]bool)
+		addAttachment := func(attachment core.VnicAttachment) {
+			isAttached := attachment.LifecycleState == core.VnicAttachmentLifecycleStateAttached
+
+			// The VNIC ID isn't set until the VNIC is created (attaching)
+			if attachment.VnicId == nil || (attached[*attachment.InstanceId] && !isAttached) {
+				return
+			}
 
-	initialResponse, err := client.ListVnicAttachments(context.Background(), core.ListVnicAttachmentsRequest{CompartmentId: &compartmentId})
-	utils.CheckError(err)
+			attachments[*attachment.InstanceId] = *attachment.VnicId
+			attachments_subnets[*attachment.InstanceId] = *attachment.SubnetId
+			attached[*attachment.InstanceId] = isAttached
+		}
 
-	for _, attachment := range initialResponse.Items {
-		attachments[*attachment.InstanceId] = *attachment.VnicId
-		attachments_subnets[*attachment.InstanceId] = *attachment.SubnetId
-	}
+		initialResponse, err := client.ListVnicAttachments(context.Background(), core.ListVnicAttachmentsRequest{CompartmentId: &compartmentId})
+		if err != nil {
+			return vnicAttachments{}, fmt.Errorf("unable to list VNIC attachments: %w", err)
+		}
 
-	if initialResponse.OpcNextPage != nil {
-		nextPage := initialResponse.OpcNextPage
-		for {
-			response, err := client.ListVnicAttachments(context.Background(), core.ListVnicAttachmentsRequest{CompartmentId: &compartmentId, Page: nextPage})
-			utils.CheckError(err)
+		for _, attachment := range initialResponse.Items {
+			addAttachment(attachment)
+		}
 
-			for _, attachment := range response.Items {
-				attachments[*attachment.InstanceId] = *attachment.VnicId
-			}
+		if initialResponse.OpcNextPage != nil {
+			nextPage := initialResponse.OpcNextPage
+			for {
+				response, err := client.ListVnicAttachments(context.Background(), core.ListVnicAttachmentsRequest{CompartmentId: &compartmentId, Page: nextPage})
+				if err != nil {
+					return vnicAttachments{}, fmt.Errorf("unable to list VNIC attachments: %w", err)
+				}
 
-			if response.OpcNextPage != nil {
-				nextPage = response.OpcNextPage
-			} else {
-				break
+				for _, attachment := range response.Items {
+					addAttachment(attachment)
+				}
+
+				if response.OpcNextPage != nil {
+					nextPage = response.OpcNextPage
+				} else {
+					break
+				}
 			}
 		}
-	}
 
-	return attachments, attachments_subnets
+		return vnicAttachments{attachments, attachments_subnets}, nil
+	})
+
+	return result.Vnics, result.Subnets, err
 }
 
 // Fetch private IP and hostname from VNIC (OCI API call)
-func fetchPrivateIp(client core.VirtualNetworkClient, vnicId string) (string, string) {
+func fetchPrivateIp(client VirtualNetworkClient, vnicId string) (string, string, error) {
 	response, err := client.GetVnic(context.Background(), core.GetVnicRequest{VnicId: &vnicId})
-	utils.CheckError(err)
-
-	hostname := ""
-
-	privateIP := *response.Vnic.PrivateIp
-	hostname = *response.Vnic.HostnameLabel
-
-	// Optional: debug print
-	if hostname != "" {
-		utils.Logger.Debug("DEBUG (single): " + hostname)
-	} else {
-		utils.Logger.Debug("DEBUG (single): NO_HOSTNAME")
-		hostname = "Lookup failed"
+	if err != nil {
+		return "", "", fmt.Errorf("unable to get VNIC %s: %w", vnicId, err)
 	}
 
-	return privateIP, hostname
-}
-
-// Fetch all subnet IDs via OCI API call
-func fetchSubnetIds(client core.VirtualNetworkClient, compartmentId string) []string {
-	response, err := client.ListSubnets(context.Background(), core.ListSubnetsRequest{CompartmentId: &compartmentId})
-	utils.CheckError(err)
-
-	var subnetIds []string
+	// VNICs without a hostname label (E.g. created with skip DNS) have no hostname
+	privateIP := ""
+	if response.Vnic.PrivateIp != nil {
+		privateIP = *response.Vnic.PrivateIp
+	}
 
-	for _, subnet := range response.Items {
-		subnetIds = append(subnetIds, *subnet.Id)
+	hostname := "Lookup failed"
+	if response.Vnic.HostnameLabel != nil && *response.Vnic.HostnameLabel != "" {
+		hostname = *response.Vnic.HostnameLabel
 	}
 
-	return subnetIds
+	return privateIP, hostname, nil
 }
 
-// Fetch all private IPs and hostnames via OCI API call
-func fetchPrivateIps(client core.VirtualNetworkClient, compartmentId string) map[string]vnicInfo {
-	ctx := context.Background()
-	vnicIdToInfo := make(map[string]vnicInfo)
-	subnetIds := fetchSubnetIds(client, compartmentId)
-
-	for _, subnetId := range subnetIds {
+// Fetch the private IPs and hostnames of all VNICs in a subnet via OCI API call, cached unless refresh (see utils.Cached)
+func fetchSubnetPrivateIps(client VirtualNetworkClient, subnetId string, refresh bool) (map[string]vnicInfo, error) {
+	return utils.Cached(client.Endpoint(), subnetId, "private-ips", refresh, func() (map[string]vnicInfo, error) {
+		vnicIdToInfo := make(map[string]vnicInfo)
 		var page *string
 
 		for {
-			resp, err := client.ListPrivateIps(ctx, core.ListPrivateIpsRequest{
+			response, err := client.ListPrivateIps(context.Background(), core.ListPrivateIpsRequest{
 				SubnetId: &subnetId,
 				Page:     page,
 				Limit:    common.Int(1000),
 			})
-
-			// simple retry on 429 TooManyRequests
-			if svcErr, ok := common.IsServiceError(err); ok && svcErr.GetHTTPStatusCode() == 429 {
-				fmt.Println("Rate limited. Waiting 5 seconds before retry...")
-				time.Sleep(5 * time.Second)
-				continue
+			if err != nil {
+				return nil, fmt.Errorf("unable to list private IPs: %w", err)
 			}
-			utils.CheckError(err)
 
-			for _, item := range resp.Items {
-				hostname := ""
+			for _, item := range response.Items {
+				// Skip secondary private IPs, the instance IP is the VNIC's primary private IP
+				if item.VnicId == nil || (item.IsPrimary != nil && !*item.IsPrimary) {
+					continue
+				}
+
+				hostname := "Lookup failed"
 				if item.HostnameLabel != nil && *item.HostnameLabel != "" {
 					hostname = *item.HostnameLabel
-				} else {
-					hostname = "Lookup failed"
 				}
 
-				vnicIdToInfo[*item.VnicId] = vnicInfo{
-					ip:       *item.IpAddress,
-					hostname: hostname,
-				}
+				vnicIdToInfo[*item.VnicId] = vnicInfo{*item.IpAddress, hostname}
 			}
 
-			if resp.OpcNextPage == nil {
+			if response.OpcNextPage == nil {
 				break
 			}
-			page = resp.OpcNextPage
+			page = response.OpcNextPage
 		}
 
-		// small pause between subnets to be kind to the API
-		time.Sleep(200 * time.Millisecond)
+		return vnicIdToInfo, nil
+	})
+}
+
+// Lookup the private IP and hostname of VNICs, vnicSubnets maps VNIC ID to subnet ID (OCI API calls)
+// Subnets with more than one VNIC are listed at once (one call per 1000 IPs), single VNICs are looked up directly
+// Subnets are looked up concurrently
+func lookupVnics(client VirtualNetworkClient, vnicSubnets map[string]string, refresh bool) (map[string]vnicInfo, error) {
+	subnetVnics := make(map[string][]string)
+	for vnicId, subnetId := range vnicSubnets {
+		subnetVnics[subnetId] = append(subnetVnics[subnetId], vnicId)
 	}
 
-	return vnicIdToInfo
-}
+	var subnetIds []string
+	for subnetId := range subnetVnics {
+		subnetIds = append(subnetIds, subnetId)
+	}
+	sort.Strings(subnetIds)
+
+	results := make([]map[string]vnicInfo, len(subnetIds))
+	err := utils.ForEach(len(subnetIds), func(i int) error {
+		vnicIds := subnetVnics[subnetIds[i]]
+
+		subnetInfo := make(map[string]vnicInfo)
+		if len(vnicIds) > 1 {
+			var err error
+			subnetInfo, err = fetchSubnetPrivateIps(client, subnetIds[i], refresh)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Single VNICs, and VNICs created after the subnet's private IPs were cached
+		for _, vnicId := range vnicIds {
+			if _, found := subnetInfo[vnicId]; found {
+				continue
+			}
+
+			privateIp, hostname, err := fetchPrivateIp(client, vnicId)
 
-// Fetch all instances via OCI API call
-func fetchInstances(computeClient core.ComputeClient, compartmentId string) []Instance {
-	utils.Logger.Debug("Compartment ID: " + compartmentId)
-	utils.Logger.Debug("Compartment ID: " + computeClient.Endpoint())
+			// Detached VNICs are deleted with their instance, the private IP is unknown
+			var serviceErr common.ServiceError
+			if errors.As(err, &serviceErr) && serviceErr.GetHTTPStatusCode() == http.StatusNotFound {
+				utils.Logger.Debug("VNIC " + vnicId + " not found")
+				continue
+			}
 
-	var instances []Instance
+			if err != nil {
+				return err
+			}
+			subnetInfo[vnicId] = vnicInfo{privateIp, hostname}
+		}
 
-	initialResponse, err := computeClient.ListInstances(context.Background(), core.ListInstancesRequest{
-		CompartmentId:  &compartmentId,
-		LifecycleState: core.InstanceLifecycleStateRunning,
+		results[i] = subnetInfo
+		return nil
 	})
-	utils.CheckError(err)
-
-	for _, instance := range initialResponse.Items {
-		utils.Logger.Debug("Instance Name: " + *instance.DisplayName)
-		utils.Logger.Debug("Instance ID: " + *instance.Id)
-		utils.Logger.Debug("Instance IP: " + "Need to look up")
-		utils.Logger.Debug("Instance AvailabilityDomain: " + *instance.AvailabilityDomain)
-		utils.Logger.Debug("Instance Shape: " + *instance.Shape)
-		utils.Logger.Debug("Instance ImageId: " + *instance.ImageId)
-		utils.Logger.Debug("Instance FaultDomain: " + *instance.FaultDomain)
-		utils.Logger.Debug("Instance Vcpus: " + strconv.Itoa(*instance.ShapeConfig.Vcpus))
-		utils.Logger.Debug("Instance Memory: " + fmt.Sprintf("%f", *instance.ShapeConfig.MemoryInGBs))
-		utils.Logger.Debug("Instance Region: " + *instance.Region)
-
-		instance := Instance{
-			*instance.DisplayName,
-			*instance.Id,
-			"0", // We have to lookup the private IP address separately
-			*instance.AvailabilityDomain,
-			*instance.Shape,
-			*instance.TimeCreated,
-			*instance.ImageId,
-			*instance.FaultDomain,
-			*instance.ShapeConfig.Vcpus,
-			*instance.ShapeConfig.MemoryInGBs,
-			*instance.Region,
-			instance.LifecycleState,
-			"0",           // We have to lookup the subnet separately
-			"placeholder", // We have to lookup the hostname separately
+	if err != nil {
+		return nil, err
+	}
+
+	vnicIdToInfo := make(map[string]vnicInfo)
+	for _, subnetInfo := range results {
+		for vnicId, info := range subnetInfo {
+			vnicIdToInfo[vnicId] = info
 		}
-		instances = append(instances, instance)
 	}
 
-	if initialResponse.OpcNextPage != nil {
-		nextPage := initialResponse.OpcNextPage
+	return vnicIdToInfo, nil
+}
+
+// Instance states accepted by --state, all disables the filter
+func InstanceStates() []string {
+	states := []string{"all"}
+	for _, state := range core.GetInstanceLifecycleStateEnumStringValues() {
+		states = append(states, strings.ToLower(state))
+	}
+
+	return states
+}
+
+// Parse an instance state (E.g. running, case insensitive), empty for all states
+func ParseInstanceState(state string) (core.InstanceLifecycleStateEnum, error) {
+	if strings.EqualFold(state, "all") {
+		return "", nil
+	}
+
+	lifecycleState, ok := core.GetMappingInstanceLifecycleStateEnum(state)
+	if !ok {
+		return "", utils.UsageError("invalid instance state " + state + ", must be one of: " + strings.Join(InstanceStates(), ", "))
+	}
+
+	return lifecycleState, nil
+}
+
+// Fetch all instances in a lifecycle state (empty for all states) via OCI API call, cached unless refresh (see utils.Cached)
+func fetchInstances(computeClient ComputeClient, compartmentId string, state core.InstanceLifecycleStateEnum, refresh bool) ([]Instance, error) {
+	resourceType := "instances-all"
+	if state != "" {
+		resourceType = "instances-" + strings.ToLower(string(state))
+	}
+
+	return utils.Cached(computeClient.Endpoint(), compartmentId, resourceType, refresh, func() ([]Instance, error) {
+		utils.Logger.Debug("Compartment ID: " + compartmentId)
+
+		var instances []Instance
+		var page *string
+
 		for {
 			response, err := computeClient.ListInstances(context.Background(), core.ListInstancesRequest{
 				CompartmentId:  &compartmentId,
-				LifecycleState: core.InstanceLifecycleStateRunning,
-				Page:           nextPage,
+				LifecycleState: state,
+				Page:           page,
 			})
-			utils.CheckError(err)
-
-			for _, instance := range response.Items {
-				instance := Instance{
-					*instance.DisplayName,
-					*instance.Id,
-					"",
-					*instance.AvailabilityDomain,
-					*instance.Shape,
-					*instance.TimeCreated,
-					*instance.ImageId,
-					*instance.FaultDomain,
-					*instance.ShapeConfig.Vcpus,
-					*instance.ShapeConfig.MemoryInGBs,
-					*instance.Region,
-					instance.LifecycleState,
-					"0", // We have to lookup the subnet separately
-					"placeholder",
-				}
+			if err != nil {
+				return nil, fmt.Errorf("unable to list instances: %w", err)
+			}
+
+			for _, item := range response.Items {
+				instance := newInstance(item)
+				utils.Logger.Debug(fmt.Sprintf("Instance: %+v", instance))
 				instances = append(instances, instance)
 			}
 
-			if response.OpcNextPage != nil {
-				nextPage = response.OpcNextPage
-			} else {
+			if response.OpcNextPage == nil {
 				break
 			}
+			page = response.OpcNextPage
 		}
-	}
 
-	return instances
+		return instances, nil
+	})
 }
 
-// List and print instances (OCI API call)
-func ListInstances(computeClient core.ComputeClient, compartmentId string, vnetClient core.VirtualNetworkClient, retrieveImageInfo bool, compartment string, tenancyName string) {
-	// When more than ~25 private IPs need to be looked up, its faster to batch them all together
-	ipFetchAllThreshold := 25
+// Return the value a pointer points to, the zero value if it's nil
+// Optional fields of OCI responses are nil when they aren't set (E.g. the image of a terminated instance)
+func deref[T any](value *T) T {
+	if value == nil {
+		var zero T
+		return zero
+	}
+
+	return *value
+}
 
-	instances := fetchInstances(computeClient, compartmentId)
-	// returns []Instance
+// Convert an OCI instance, its private IP, hostname, and subnet are looked up separately (see lookupInstanceIps)
+// Instances that aren't running may lack optional fields (E.g. shape config, image), these are left empty
+func newInstance(instance core.Instance) Instance {
+	var timeCreated time.Time
+	if instance.TimeCreated != nil {
+		timeCreated = instance.TimeCreated.Time
+	}
 
-	var batchFetchAllIps bool
-	count := len(instances)
-	utils.Faint.Println(strconv.Itoa(count) + " instances")
+	var vcpus int
+	var memory float32
+	if instance.ShapeConfig != nil {
+		vcpus = deref(instance.ShapeConfig.Vcpus)
+		memory = deref(instance.ShapeConfig.MemoryInGBs)
+	}
 
-	if count > ipFetchAllThreshold {
-		batchFetchAllIps = true
-	} else {
-		batchFetchAllIps = false
+	return Instance{
+		deref(instance.DisplayName),
+		deref(instance.Id),
+		"",
+		deref(instance.AvailabilityDomain),
+		deref(instance.Shape),
+		timeCreated,
+		deref(instance.ImageId),
+		deref(instance.FaultDomain),
+		vcpus,
+		memory,
+		deref(instance.Region),
+		instance.LifecycleState,
+		"",
+		"",
+		instance.FreeformTags,
+		instance.DefinedTags,
+		nil,
+		"",
 	}
+}
 
+// Lookup private IP, hostname, and subnet of instances, VNICs are fetched instead of read from the cache with refresh
+// Running instances without a VNIC attachment are skipped
+func lookupInstanceIps(computeClient ComputeClient, vnetClient VirtualNetworkClient, compartmentId string, instances []Instance, refresh bool) ([]Instance, error) {
 	// Get ALL VNIC attachments
 	// Once again, doing this because the request does not support filtering in the request
-	attachments, attachments_subnets := fetchVnicAttachments(computeClient, compartmentId)
-	// returns map of instanceId: vnicId
-
-	vnicIdToInfo := make(map[string]vnicInfo)
-	if batchFetchAllIps {
-		vnicIdToInfo = fetchPrivateIps(vnetClient, compartmentId) // This is inefficient when instance search results are small, resort to fetchPrivateIp
-		// returns map of vnicId:vnicInfo
+	attachments, attachments_subnets, err := fetchVnicAttachments(computeClient, compartmentId, refresh)
+	if err != nil {
+		return nil, err
 	}
+	// returns map of instanceId: vnicId
 
 	var instancesWithIP []Instance
-	var privateIp string
-	var hostname string
+	vnicSubnets := make(map[string]string)
 
 	for _, instance := range instances {
-		vnicId, ok := attachments[instance.id]
-		if ok {
-			if batchFetchAllIps {
-				privateIp = vnicIdToInfo[vnicId].ip
-				hostname = vnicIdToInfo[vnicId].hostname
-			} else {
-				privateIp, hostname = fetchPrivateIp(vnetClient, vnicId)
+		vnicId, ok := attachments[instance.Id]
+		if !ok {
+			// Instances that aren't running may not have a VNIC yet (E.g. provisioning), these are kept without an IP
+			if instance.State == core.InstanceLifecycleStateRunning {
+				fmt.Fprintln(os.Stderr, "Unable to lookup VNIC for "+instance.Id)
+				continue
 			}
 
-			instance.ip = privateIp
-			instance.hostname = hostname
+			instance.SubnetId = ""
+			instancesWithIP = append(instancesWithIP, instance)
+			continue
+		}
+
+		instance.SubnetId = attachments_subnets[instance.Id]
+		vnicSubnets[vnicId] = instance.SubnetId
+		instancesWithIP = append(instancesWithIP, instance)
+	}
 
-			subnetId, ok := attachments_subnets[instance.id]
-			if ok {
-				instance.subnetId = subnetId
-				instancesWithIP = append(instancesWithIP, instance) // TODO: Im sure theres a better way to do this using a single slice
-			}
+	vnicIdToInfo, err := lookupVnics(vnetClient, vnicSubnets, refresh)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range instancesWithIP {
+		info := vnicIdToInfo[attachments[instancesWithIP[i].Id]]
+		instancesWithIP[i].Ip = info.Ip
+		instancesWithIP[i].Hostname = info.Hostname
+	}
+
+	sort.Sort(instancesByName(instancesWithIP))
+
+	return instancesWithIP, nil
+}
+
+// Lookup the image of instances, each image once, concurrently (OCI API calls)
+func lookupInstanceImages(computeClient ComputeClient, instances []Instance) error {
+	var imageIds []string
+	for _, instance := range instances {
+		// E.g. terminated instances
+		if instance.ImageId == "" {
+			continue
+		}
 
-		} else {
-			fmt.Println("Unable to lookup VNIC for " + instance.id)
+		if !slices.Contains(imageIds, instance.ImageId) {
+			imageIds = append(imageIds, instance.ImageId)
 		}
 	}
 
-	utils.FaintMagenta.Println("Tenancy(Compartment): " + tenancyName + "(" + compartment + ")")
+	images := make([]Image, len(imageIds))
+	err := utils.ForEach(len(imageIds), func(i int) error {
+		var err error
+		images[i], err = fetchImage(computeClient, imageIds[i])
+		return err
+	})
+	if err != nil {
+		return err
+	}
 
-	if len(instancesWithIP) > 0 {
-		sort.Sort(instancesByName(instancesWithIP))
+	for i := range instances {
+		if instances[i].ImageId == "" {
+			continue
+		}
 
-		for _, instance := range instancesWithIP {
-			fd := instance.fd
-			fd_short := strings.Replace(fd, "FAULT-DOMAIN", "FD", -1)
+		image := images[slices.Index(imageIds, instances[i].ImageId)]
+		instances[i].Image = &image
+	}
 
-			fmt.Print("Name: ")
-			utils.Blue.Println(instance.name)
+	return nil
+}
 
-			fmt.Print("ID: ")
-			utils.Yellow.Println(instance.id)
+// Print instances, detailed text by default or in the format set by --output
+// The region and compartment are included when instances span regions (--all-regions) or compartments (--recursive)
+func PrintInstances(instances []Instance, tenancyName string, compartment string, scope Scope) error {
+	if utils.OutputFormat() != "" {
+		columns := []utils.Column{
+			{Header: "Name"},
+			{Header: "Private IP"},
+			{Header: "State"},
+			{Header: "Shape"},
+			{Header: "Hostname", Wide: true},
+			{Header: "AD", Wide: true},
+			{Header: "FD", Wide: true},
+			{Header: "vCPUs", Wide: true},
+			{Header: "Mem", Wide: true},
+			{Header: "Created", Wide: true},
+			{Header: "OCID", Wide: true},
+			{Header: "Subnet OCID", Wide: true},
+		}
+		columns = scope.columns(columns)
+
+		var rows [][]string
+		for _, instance := range instances {
+			row := []string{
+				instance.Name,
+				instance.Ip,
+				string(instance.State),
+				instance.Shape,
+				instance.Hostname,
+				instance.Ad,
+				instance.Fd,
+				strconv.Itoa(instance.VCPUs),
+				strconv.FormatFloat(float64(instance.Mem), 'f', -1, 32),
+				instance.TimeCreated.Format(time.RFC3339),
+				instance.Id,
+				instance.SubnetId,
+			}
+			row = scope.row(instance.Region, instance.Compartment, row)
+			rows = append(rows, row)
+		}
 
-			fmt.Print("Private IP: ")
-			utils.Yellow.Print(instance.ip)
+		if !utils.StructuredOutput() {
+			utils.FaintMagenta.Println("Tenancy(Compartment): " + tenancyName + "(" + compartment + ")")
+		}
+		return utils.PrintOutput(instances, columns, rows)
+	}
 
-			fmt.Print(" FD: ")
-			utils.Yellow.Print(fd_short)
+	utils.FaintMagenta.Println("Tenancy(Compartment): " + tenancyName + "(" + compartment + ")")
 
-			fmt.Print(" AD: ")
-			utils.Yellow.Println(instance.ad)
+	for _, instance := range instances {
+		fd := instance.Fd
+		fd_short := strings.Replace(fd, "FAULT-DOMAIN", "FD", -1)
 
-			fmt.Print("Shape: ")
-			utils.Yellow.Print(instance.shape)
+		fmt.Print("Name: ")
+		utils.Blue.Println(instance.Name)
 
-			fmt.Print(" Mem: ")
-			utils.Yellow.Print(instance.mem)
+		fmt.Print("ID: ")
+		utils.Yellow.Println(instance.Id)
 
-			fmt.Print(" vCPUs: ")
-			utils.Yellow.Println(instance.vCPUs)
+		scope.print(instance.Region, instance.Compartment)
 
-			fmt.Print("State: ")
-			utils.Yellow.Println(instance.state)
+		// Instances that aren't running may not have a VNIC (E.g. provisioning or terminated)
+		ip := instance.Ip
+		if ip == "" {
+			ip = "none"
+		}
 
-			fmt.Print("Created: ")
-			utils.Yellow.Println(instance.cDate)
+		fmt.Print("Private IP: ")
+		utils.Yellow.Print(ip)
 
-			fmt.Print("Subnet ID: ")
-			utils.Yellow.Println(instance.subnetId)
+		fmt.Print(" FD: ")
+		utils.Yellow.Print(fd_short)
 
-			fmt.Print("Hostname: ")
-			utils.Yellow.Println(instance.hostname)
+		fmt.Print(" AD: ")
+		utils.Yellow.Println(instance.Ad)
 
-			if retrieveImageInfo {
-				image := fetchImage(computeClient, instance.imageId) // TODO: Performance hit: this adds ~100 ms per image lookup
+		fmt.Print("Shape: ")
+		utils.Yellow.Print(instance.Shape)
 
-				fmt.Print("Image Name: ")
-				utils.Yellow.Println(image.name)
+		fmt.Print(" Mem: ")
+		utils.Yellow.Print(instance.Mem)
 
-				fmt.Print("Image ID: ")
-				utils.Yellow.Println(instance.imageId)
+		fmt.Print(" vCPUs: ")
+		utils.Yellow.Println(instance.VCPUs)
 
-				fmt.Print("Image Created: ")
-				utils.Yellow.Println(image.cDate)
+		fmt.Print("State: ")
+		utils.Yellow.Println(instance.State)
 
-				fmt.Println("Image Tags (Free form): ")
+		fmt.Print("Created: ")
+		utils.Yellow.Println(instance.TimeCreated)
 
-				freeformTagKeys := make([]string, 0, len(image.freeTags))
-				for key := range image.freeTags {
-					freeformTagKeys = append(freeformTagKeys, key)
-				}
-				sort.Strings(freeformTagKeys)
+		fmt.Print("Subnet ID: ")
+		utils.Yellow.Println(instance.SubnetId)
 
-				utils.Faint.Print("| ")
-				for _, key := range freeformTagKeys {
-					utils.Faint.Print(key + ": " + image.freeTags[key] + " | ")
-				}
+		fmt.Print("Hostname: ")
+		utils.Yellow.Println(instance.Hostname)
 
-				fmt.Println("")
+		if instance.Image != nil {
+			image := instance.Image
 
-				fmt.Println("Image Tags (Defined): ")
-				for tagNs, tags := range image.definedTags {
-					utils.Italic.Println(tagNs)
+			fmt.Print("Image Name: ")
+			utils.Yellow.Println(image.Name)
 
-					definedTagKeys := make([]string, 0, len(tags))
-					for key := range tags {
-						definedTagKeys = append(definedTagKeys, key)
-					}
-					sort.Strings(definedTagKeys)
+			fmt.Print("Image ID: ")
+			utils.Yellow.Println(instance.ImageId)
 
-					utils.Faint.Print("| ")
-					for _, key := range definedTagKeys {
-						utils.Faint.Print(key + ": " + tags[key].(string) + " | ")
-					}
+			fmt.Print("Image Created: ")
+			utils.Yellow.Println(image.TimeCreated)
 
-					fmt.Println("")
+			fmt.Println("Image Tags (Free form): ")
 
-				}
+			freeformTagKeys := make([]string, 0, len(image.FreeformTags))
+			for key := range image.FreeformTags {
+				freeformTagKeys = append(freeformTagKeys, key)
+			}
+			sort.Strings(freeformTagKeys)
+
+			utils.Faint.Print("| ")
+			for _, key := range freeformTagKeys {
+				utils.Faint.Print(key + ": " + image.FreeformTags[key] + " | ")
 			}
 
 			fmt.Println("")
-		}
-	}
-}
 
-// Match pattern and return instance matches
-func matchInstances(pattern string, instances []Instance) []Instance {
-	// TODO: Maybe move this back to findInstances for consistency
-	var matches []Instance
+			fmt.Println("Image Tags (Defined): ")
+			for tagNs, tags := range image.DefinedTags {
+				utils.Italic.Println(tagNs)
 
-	// Handle simple wildcard
-	if pattern == "*" {
-		pattern = ".*"
-	}
+				definedTagKeys := make([]string, 0, len(tags))
+				for key := range tags {
+					definedTagKeys = append(definedTagKeys, key)
+				}
+				sort.Strings(definedTagKeys)
 
-	for _, instance := range instances {
-		match, _ := regexp.MatchString(pattern, instance.name)
-		if match {
-			matches = append(matches, instance)
+				utils.Faint.Print("| ")
+				for _, key := range definedTagKeys {
+					utils.Faint.Print(key + ": " + tags[key].(string) + " | ")
+				}
+
+				fmt.Println("")
+
+			}
 		}
+
+		fmt.Println("")
 	}
 
-	return matches
+	return nil
 }
 
-// Find and print instances (OCI API call)
-// TODO: Consider consolidating FindInstances and ListInstances similar to OKE
-func FindInstances(computeClient core.ComputeClient, vnetClient core.VirtualNetworkClient, compartmentId string, flagSearchString string, retrieveImageInfo bool, compartment string, tenancyName string) {
-	pattern := flagSearchString
-
-	// When more than ~25 private IPs need to be looked up, its faster to batch them all together
-	ipFetchAllThreshold := 25
+// Find instances in a lifecycle state (empty for all states) matching a search query (see instanceQuery), all instances if the query is empty (OCI API call)
+// With refresh, instances and their VNICs are fetched instead of read from the cache (E.g. to act on their current states)
+func FindInstances(computeClient ComputeClient, vnetClient VirtualNetworkClient, compartmentId string, state core.InstanceLifecycleStateEnum, searchString string, retrieveImageInfo bool, refresh bool) ([]Instance, error) {
+	query, err := parseInstanceQuery(searchString)
+	if err != nil {
+		return nil, err
+	}
 
 	// Get relevant info for ALL instances
 	// We have to do this because GetInstanceRequest/ListInstancesRequests do not allow filtering by pattern
-	instances := fetchInstances(computeClient, compartmentId)
-	// returns []Instance
-
-	// Search all instances and return instances that match by name
-	instanceMatches := matchInstances(pattern, instances)
-
-	var batchFetchAllIps bool
-	matchCount := len(instanceMatches)
-	utils.Faint.Println(strconv.Itoa(matchCount) + " matches")
-
-	if matchCount > ipFetchAllThreshold {
-		batchFetchAllIps = true
-	} else {
-		batchFetchAllIps = false
+	instances, err := fetchInstances(computeClient, compartmentId, state, refresh)
+	if err != nil {
+		return nil, err
 	}
 
-	// Get ALL VNIC attachments
-	// Once again, doing this because the request does not support filtering in the request
-	attachments, attachments_subnets := fetchVnicAttachments(computeClient, compartmentId)
-	// returns map of instanceId: vnicId
-
-	vnicIdToInfo := make(map[string]vnicInfo)
-	if batchFetchAllIps {
-		vnicIdToInfo = fetchPrivateIps(vnetClient, compartmentId) // This is inefficient when instance search results are small, resort to fetchPrivateIp
-		// returns map of vnicId:vnicInfo
+	// Filter before looking up IPs when the query doesn't need them, this looks up fewer VNICs
+	needsVnics := query.needsVnics()
+	if !needsVnics {
+		instances = query.filter(instances)
 	}
 
-	var instancesWithIP []Instance
-	var privateIp string
-	var hostname string
-
-	for _, instance := range instanceMatches {
-		vnicId, ok := attachments[instance.id]
-		if ok {
-			if batchFetchAllIps {
-				privateIp = vnicIdToInfo[vnicId].ip
-				hostname = vnicIdToInfo[vnicId].hostname
-			} else {
-				privateIp, hostname = fetchPrivateIp(vnetClient, vnicId)
-			}
-
-			instance.ip = privateIp
-			instance.hostname = hostname
+	instances, err = lookupInstanceIps(computeClient, vnetClient, compartmentId, instances, refresh)
+	if err != nil {
+		return nil, err
+	}
 
-			subnetId, ok := attachments_subnets[instance.id]
-			if ok {
-				instance.subnetId = subnetId
-				instancesWithIP = append(instancesWithIP, instance) // TODO: Im sure theres a better way to do this using a single slice
-			}
+	if needsVnics {
+		instances = query.filter(instances)
+	}
 
-		} else {
-			fmt.Println("Unable to lookup VNIC for " + instance.id)
+	if retrieveImageInfo {
+		err = lookupInstanceImages(computeClient, instances)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	utils.FaintMagenta.Println("Tenancy(Compartment): " + tenancyName + "(" + compartment + ")")
-	if len(instancesWithIP) > 0 {
-		sort.Sort(instancesByName(instancesWithIP))
-
-		for _, instance := range instancesWithIP {
-			fd := instance.fd
-			fd_short := strings.Replace(fd, "FAULT-DOMAIN", "FD", -1)
-
-			fmt.Print("Name: ")
-			utils.Blue.Println(instance.name)
-
-			fmt.Print("ID: ")
-			utils.Yellow.Println(instance.id)
-
-			fmt.Print("Private IP: ")
-			utils.Yellow.Print(instance.ip)
-
-			fmt.Print(" FD: ")
-			utils.Yellow.Print(fd_short)
-
-			fmt.Print(" AD: ")
-			utils.Yellow.Println(instance.ad)
-
-			fmt.Print("Shape: ")
-			utils.Yellow.Print(instance.shape)
-
-			fmt.Print(" Mem: ")
-			utils.Yellow.Print(instance.mem)
-
-			fmt.Print(" vCPUs: ")
-			utils.Yellow.Println(instance.vCPUs)
-
-			fmt.Print("State: ")
-			utils.Yellow.Println(instance.state)
-
-			fmt.Print("Created: ")
-			utils.Yellow.Println(instance.cDate)
-
-			fmt.Print("Subnet ID: ")
-			utils.Yellow.Println(instance.subnetId)
+	return instances, nil
+}
 
-			fmt.Print("Hostname: ")
-			utils.Yellow.Println(instance.hostname)
+// Find instances in a lifecycle state by exact display name or OCID (OCI API call)
+// Display names aren't unique, several instances are returned when they share the name
+// With refresh, instances are fetched instead of read from the cache (see FindInstances)
+func FindInstancesByName(computeClient ComputeClient, vnetClient VirtualNetworkClient, compartmentId string, state core.InstanceLifecycleStateEnum, nameOrId string, refresh bool) ([]Instance, error) {
+	instances, err := fetchInstances(computeClient, compartmentId, state, refresh)
+	if err != nil {
+		return nil, err
+	}
 
-			if retrieveImageInfo {
-				image := fetchImage(computeClient, instance.imageId) // TODO: Performance hit: this adds ~100 ms per image lookup
+	var matches []Instance
+	for _, instance := range instances {
+		if instance.Name == nameOrId || instance.Id == nameOrId {
+			matches = append(matches, instance)
+		}
+	}
 
-				fmt.Print("Image Name: ")
-				utils.Yellow.Println(image.name)
+	if len(matches) == 0 {
+		return nil, nil
+	}
 
-				fmt.Print("Image ID: ")
-				utils.Yellow.Println(instance.imageId)
+	return lookupInstanceIps(computeClient, vnetClient, compartmentId, matches, refresh)
+}
 
-				fmt.Print("Image Created: ")
-				utils.Yellow.Println(image.cDate)
+// Instance details required to create a bastion session
+type InstanceTarget struct {
+	Name     string
+	Id       string
+	Ip       string
+	Hostname string
+	SubnetId string
+}
 
-				fmt.Println("Image Tags (Free form): ")
+// Resolve a single instance identifier (display name, OCID, private IP, or hostname label) to candidate instances
+// More than one candidate is returned when the identifier is ambiguous (E.g. duplicate display names)
+// Instances and VNICs are always fetched, a session to a cached IP could reach a recreated instance's old address
+func ResolveInstanceTarget(computeClient ComputeClient, vnetClient VirtualNetworkClient, compartmentId string, target string) ([]InstanceTarget, error) {
+	// Bastion sessions can only connect to running instances
+	instances, err := fetchInstances(computeClient, compartmentId, core.InstanceLifecycleStateRunning, true)
+	if err != nil {
+		return nil, err
+	}
 
-				freeformTagKeys := make([]string, 0, len(image.freeTags))
-				for key := range image.freeTags {
-					freeformTagKeys = append(freeformTagKeys, key)
-				}
-				sort.Strings(freeformTagKeys)
+	attachments, attachmentsSubnets, err := fetchVnicAttachments(computeClient, compartmentId, true)
+	if err != nil {
+		return nil, err
+	}
 
-				utils.Faint.Print("| ")
-				for _, key := range freeformTagKeys {
-					utils.Faint.Print(key + ": " + image.freeTags[key] + " | ")
-				}
+	var candidates []InstanceTarget
 
-				fmt.Println("")
+	// Match on OCID or display name first, these only require a private IP lookup for the matches
+	for _, instance := range instances {
+		if instance.Id == target || instance.Name == target {
+			vnicId, ok := attachments[instance.Id]
+			if !ok {
+				fmt.Fprintln(os.Stderr, "Unable to lookup VNIC for "+instance.Id)
+				continue
+			}
 
-				fmt.Println("Image Tags (Defined): ")
-				for tagNs, tags := range image.definedTags {
-					utils.Italic.Println(tagNs)
+			privateIp, hostname, err := fetchPrivateIp(vnetClient, vnicId)
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, InstanceTarget{instance.Name, instance.Id, privateIp, hostname, attachmentsSubnets[instance.Id]})
+		}
+	}
 
-					definedTagKeys := make([]string, 0, len(tags))
-					for key := range tags {
-						definedTagKeys = append(definedTagKeys, key)
-					}
-					sort.Strings(definedTagKeys)
+	if len(candidates) > 0 || strings.HasPrefix(target, "ocid1.") {
+		return candidates, nil
+	}
 
-					utils.Faint.Print("| ")
-					for _, key := range definedTagKeys {
-						utils.Faint.Print(key + ": " + tags[key].(string) + " | ")
-					}
+	// Match on private IP or hostname label, this requires the IP of every instance
+	vnicSubnets := make(map[string]string)
+	for _, instance := range instances {
+		if vnicId, ok := attachments[instance.Id]; ok {
+			vnicSubnets[vnicId] = attachmentsSubnets[instance.Id]
+		}
+	}
 
-					fmt.Println("")
+	vnicIdToInfo, err := lookupVnics(vnetClient, vnicSubnets, true)
+	if err != nil {
+		return nil, err
+	}
 
-				}
-			}
+	for _, instance := range instances {
+		vnicId, ok := attachments[instance.Id]
+		if !ok {
+			continue
+		}
 
-			fmt.Println("")
+		info := vnicIdToInfo[vnicId]
+		if info.Ip == target || strings.EqualFold(info.Hostname, target) {
+			candidates = append(candidates, InstanceTarget{instance.Name, instance.Id, info.Ip, info.Hostname, attachmentsSubnets[instance.Id]})
 		}
 	}
+
+	return candidates, nil
 }
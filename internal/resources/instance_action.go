@@ -0,0 +1,136 @@
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cnopslabs/oshiv/internal/utils"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/rodaine/table"
+)
+
+// Longest time between instance state polls, polls start at one second and back off to this
+const maxInstancePollInterval = 10 * time.Second
+
+// Instance power action (E.g. oshiv inst stop), the lifecycle state of instances it applies to and the state it ends in
+type InstanceAction struct {
+	Name        string
+	Action      core.InstanceActionActionEnum
+	State       core.InstanceLifecycleStateEnum
+	TargetState core.InstanceLifecycleStateEnum
+	Description string
+}
+
+// Instance power actions, soft actions wait up to 15 minutes for the OS to shut down before powering off
+var InstanceActions = []InstanceAction{
+	{"start", core.InstanceActionActionStart, core.InstanceLifecycleStateStopped, core.InstanceLifecycleStateRunning, "Start stopped instances"},
+	{"stop", core.InstanceActionActionStop, core.InstanceLifecycleStateRunning, core.InstanceLifecycleStateStopped, "Power off running instances"},
+	{"softstop", core.InstanceActionActionSoftstop, core.InstanceLifecycleStateRunning, core.InstanceLifecycleStateStopped, "Shut down the OS of running instances, then power them off"},
+	{"reset", core.InstanceActionActionReset, core.InstanceLifecycleStateRunning, core.InstanceLifecycleStateRunning, "Power off running instances and power them back on"},
+	{"softreset", core.InstanceActionActionSoftreset, core.InstanceLifecycleStateRunning, core.InstanceLifecycleStateRunning, "Reboot the OS of running instances, then power them off and back on"},
+}
+
+// List the instances an action will run on and ask for confirmation
+func ConfirmInstanceAction(instances []Instance, action InstanceAction) bool {
+	tbl := table.New("Name", "Private IP", "State", "Shape", "OCID")
+	tbl.WithHeaderFormatter(utils.HeaderFmt).WithFirstColumnFormatter(utils.ColumnFmt)
+
+	for _, instance := range instances {
+		tbl.AddRow(instance.Name, instance.Ip, instance.State, instance.Shape, instance.Id)
+	}
+
+	tbl.Print()
+	fmt.Println("")
+
+	return utils.Confirm(strings.ToUpper(action.Name[:1]) + action.Name[1:] + " " + strconv.Itoa(len(instances)) + " instance(s)?")
+}
+
+// Run a power action on instances concurrently, printing every instance's lifecycle state changes (OCI API call)
+// With wait, wait until every instance is in the action's target state, up to timeout
+// Cached instances of the compartment are invalidated since their states change
+func RunInstanceAction(computeClient ComputeClient, compartmentId string, instances []Instance, action InstanceAction, wait bool, timeout time.Duration) error {
+	defer utils.InvalidateCache(computeClient.Endpoint(), compartmentId, "instances-*")
+
+	// Progress is reported by instance name, instances sharing a name are told apart by OCID
+	names := make(map[string]int)
+	for _, instance := range instances {
+		names[instance.Name]++
+	}
+
+	labels := make([]string, len(instances))
+	for i, instance := range instances {
+		labels[i] = instance.Name
+		if names[instance.Name] > 1 {
+			labels[i] += " (" + instance.Id + ")"
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	err := utils.ForEach(len(instances), func(i int) error {
+		return runInstanceAction(computeClient, instances[i], labels[i], action, wait, deadline)
+	})
+	if err != nil {
+		return err
+	}
+
+	if wait {
+		utils.Faint.Println("\n" + strconv.Itoa(len(instances)) + " instance(s) " + string(action.TargetState))
+	} else {
+		utils.Faint.Println("\n" + string(action.Action) + " sent to " + strconv.Itoa(len(instances)) + " instance(s)")
+	}
+
+	return nil
+}
+
+// Run a power action on an instance and wait until it is in the action's target state, unless wait is false
+// Progress lines start with the instance's label
+func runInstanceAction(computeClient ComputeClient, instance Instance, label string, action InstanceAction, wait bool, deadline time.Time) error {
+	response, err := computeClient.InstanceAction(context.Background(), core.InstanceActionRequest{
+		InstanceId: &instance.Id,
+		Action:     action.Action,
+	})
+	if err != nil {
+		fmt.Println(label + ": " + string(action.Action) + " failed")
+		return fmt.Errorf("unable to %s instance %s: %w", action.Name, instance.Name, err)
+	}
+
+	state := response.LifecycleState
+	fmt.Println(label + ": " + string(action.Action) + " sent (" + string(state) + ")")
+
+	if !wait {
+		return nil
+	}
+
+	// Resets start and end in RUNNING, and InstanceAction returns no work request to follow
+	// A poll after the action was accepted that reports RUNNING means the reset is done, a fast reset may never be seen in another state
+	polled := false
+	interval := time.Second
+
+	for {
+		if state == action.TargetState && (polled || state != instance.State) {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for instance %s to be %s (state: %s)", instance.Name, action.TargetState, state)
+		}
+
+		time.Sleep(interval)
+		interval = min(interval*2, maxInstancePollInterval)
+
+		getResponse, err := computeClient.GetInstance(context.Background(), core.GetInstanceRequest{InstanceId: &instance.Id})
+		if err != nil {
+			return fmt.Errorf("unable to get instance %s: %w", instance.Name, err)
+		}
+		polled = true
+
+		if getResponse.LifecycleState != state {
+			state = getResponse.LifecycleState
+			fmt.Println(label + ": " + string(state))
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cnopslabs/oshiv/internal/fake"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+// Return an instance power action by name
+func instanceAction(t *testing.T, name string) InstanceAction {
+	t.Helper()
+
+	for _, action := range InstanceActions {
+		if action.Name == name {
+			return action
+		}
+	}
+
+	t.Fatalf("no instance action %s", name)
+	return InstanceAction{}
+}
+
+// Return the fixture instances an action applies to matching a search query
+func instanceActionTargets(t *testing.T, backend *fake.Backend, action InstanceAction, searchString string) []Instance {
+	t.Helper()
+
+	instances, err := FindInstances(backend, backend, fake.CompartmentId, action.State, searchString, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(instances) == 0 {
+		t.Fatalf("no %s instances matching %s", action.State, searchString)
+	}
+
+	return instances
+}
+
+func TestRunInstanceAction(t *testing.T) {
+	tests := []struct {
+		action       string
+		searchString string
+		want         core.InstanceLifecycleStateEnum
+	}{
+		{"start", "etl-1", core.InstanceLifecycleStateRunning},
+		{"stop", "^web", core.InstanceLifecycleStateStopped},
+		{"softstop", "db-1", core.InstanceLifecycleStateStopped},
+		{"reset", "^api", core.InstanceLifecycleStateRunning},
+		{"softreset", "web-2", core.InstanceLifecycleStateRunning},
+	}
+
+	for _, test := range tests {
+		t.Run(test.action, func(t *testing.T) {
+			t.Parallel()
+
+			backend := newBackend(t, 0)
+			action := instanceAction(t, test.action)
+			instances := instanceActionTargets(t, backend, action, test.searchString)
+
+			err := RunInstanceAction(backend, fake.CompartmentId, instances, action, true, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, request := range backend.Requests() {
+				if request, ok := request.(core.InstanceActionRequest); ok && request.Action != action.Action {
+					t.Errorf("InstanceAction action = %s, want %s", request.Action, action.Action)
+				}
+			}
+
+			if calls := backend.Calls("InstanceAction"); calls != len(instances) {
+				t.Errorf("InstanceAction calls = %d, want %d", calls, len(instances))
+			}
+
+			// Every instance is polled until it reached the target state
+			for _, instance := range instances {
+				for _, item := range backend.Instances {
+					if *item.Id == instance.Id && item.LifecycleState != test.want {
+						t.Errorf("%s state = %s, want %s", instance.Name, item.LifecycleState, test.want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRunInstanceActionExactName(t *testing.T) {
+	backend := newBackend(t, 0)
+	prefixedId := addInstance(backend, "web-10")
+	action := instanceAction(t, "stop")
+
+	// web-1 is a prefix of web-10, only web-1 is stopped
+	instances, err := FindInstancesByName(backend, backend, fake.CompartmentId, action.State, "web-1", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = RunInstanceAction(backend, fake.CompartmentId, instances, action, true, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, request := range backend.Requests() {
+		if request, ok := request.(core.InstanceActionRequest); ok && *request.InstanceId != "ocid1.instance.oc1.iad.web1" {
+			t.Errorf("InstanceAction instance = %s, want web-1 only", *request.InstanceId)
+		}
+	}
+
+	for _, item := range backend.Instances {
+		if *item.Id == prefixedId && item.LifecycleState != core.InstanceLifecycleStateRunning {
+			t.Errorf("web-10 state = %s, want RUNNING", item.LifecycleState)
+		}
+	}
+}
+
+func TestRunInstanceActionNoWait(t *testing.T) {
+	backend := newBackend(t, 0)
+	action := instanceAction(t, "stop")
+	instances := instanceActionTargets(t, backend, action, "web-1")
+
+	err := RunInstanceAction(backend, fake.CompartmentId, instances, action, false, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := backend.Calls("GetInstance"); calls != 0 {
+		t.Errorf("GetInstance calls = %d, want 0", calls)
+	}
+}
+
+// Compute client whose instance actions complete before InstanceAction returns, like a reset faster than the first poll
+type completedActionClient struct {
+	*fake.Backend
+}
+
+func (client completedActionClient) InstanceAction(ctx context.Context, request core.InstanceActionRequest) (core.InstanceActionResponse, error) {
+	response, err := client.Backend.InstanceAction(ctx, request)
+	if err != nil {
+		return response, err
+	}
+
+	getResponse, err := client.Backend.GetInstance(ctx, core.GetInstanceRequest{InstanceId: request.InstanceId})
+	return core.InstanceActionResponse{Instance: getResponse.Instance}, err
+}
+
+func TestRunInstanceActionFastReset(t *testing.T) {
+	backend := newBackend(t, 0)
+	action := instanceAction(t, "reset")
+	instances := instanceActionTargets(t, backend, action, "^api")
+
+	// The reset is never seen in another state than RUNNING, the first poll after it was accepted finishes the wait
+	err := RunInstanceAction(completedActionClient{backend}, fake.CompartmentId, instances, action, true, 30*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := backend.Calls("GetInstance"); calls != 2*len(instances) {
+		t.Errorf("GetInstance calls = %d, want %d", calls, 2*len(instances))
+	}
+}
+
+func TestRunInstanceActionTimeout(t *testing.T) {
+	backend := newBackend(t, 0)
+	action := instanceAction(t, "stop")
+	instances := instanceActionTargets(t, backend, action, "web-1")
+
+	err := RunInstanceAction(backend, fake.CompartmentId, instances, action, true, 0)
+	if err == nil || !strings.Contains(err.Error(), "timed out waiting for instance web-1 to be STOPPED (state: STOPPING)") {
+		t.Errorf("error = %v, want timeout", err)
+	}
+}
+
+func TestRunInstanceActionError(t *testing.T) {
+	backend := newBackend(t, 0)
+
+	// Instances are matched in the state the action applies to, a reset of a stopped instance fails like OCI
+	instances := instanceActionTargets(t, backend, instanceAction(t, "start"), "etl-1")
+
+	err := RunInstanceAction(backend, fake.CompartmentId, instances, instanceAction(t, "reset"), true, time.Minute)
+
+	var serviceErr common.ServiceError
+	if !errors.As(err, &serviceErr) || serviceErr.GetHTTPStatusCode() != 409 {
+		t.Fatalf("error = %v, want a 409 service error", err)
+	}
+
+	if !strings.Contains(err.Error(), "unable to reset instance etl-1") {
+		t.Errorf("error = %v, want the instance name", err)
+	}
+}
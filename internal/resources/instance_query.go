@@ -0,0 +1,302 @@
+package resources
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/cnopslabs/oshiv/internal/utils"
+)
+
+// Instance search fields (field:value), terms without a field match the instance name
+// Values are case insensitive globs (*), except name (regex) and ip (glob or CIDR)
+var instanceQueryFields = []string{"name", "id", "ip", "host", "shape", "ad", "fd", "tag"}
+
+// Instance search query, terms are combined with AND (or whitespace before a field:value term) and OR, AND takes precedence
+// E.g. "ip:10.0.3.14", "host:api-* OR tag:team=payments", "^web shape:VM.Standard.E4.Flex ad:AD-2"
+// Words without a field continue a name term, a query without fields is one name regex (E.g. "web server")
+// After other fields they start a name term unless the value is quoted (E.g. "host:api-* web", tag:team="data platform")
+// Stored as OR of AND groups, an empty query matches every instance
+type instanceQuery [][]instanceTerm
+
+// Instance search term, a field and the value to match
+type instanceTerm struct {
+	field   string
+	pattern *regexp.Regexp // Value (name regex or glob), tag value for tag terms
+	tagKey  string         // Tag key (E.g. team) or namespace and key of a defined tag (E.g. Operations.team)
+	network *net.IPNet     // CIDR of ip terms (E.g. ip:10.0.3.0/24)
+}
+
+var queryWords = regexp.MustCompile(`\S+`)
+
+// Parse an instance search query
+func parseInstanceQuery(query string) (instanceQuery, error) {
+	var parsed instanceQuery
+	var group []instanceTerm
+
+	// Start and end of the term being read, a term ends at AND, OR, a field:value word, or the end of the query
+	// Words without a field continue name terms and quoted values (E.g. tag:team="data platform"), otherwise they start a name term
+	termStart, termEnd := -1, -1
+	continues, quoted := false, false
+	endTerm := func() error {
+		if termStart < 0 {
+			return nil
+		}
+
+		term, err := parseInstanceTerm(query[termStart:termEnd])
+		if err != nil {
+			return err
+		}
+		group = append(group, term)
+		termStart = -1
+
+		return nil
+	}
+
+	words := queryWords.FindAllStringIndex(query, -1)
+	for i, bounds := range words {
+		word := query[bounds[0]:bounds[1]]
+
+		// Quoted values end at the closing quote, AND, OR, and field:value words are part of the value
+		if quoted {
+			termEnd = bounds[1]
+			quoted = strings.Count(word, `"`)%2 == 0
+			continue
+		}
+
+		switch strings.ToUpper(word) {
+		case "AND", "OR":
+			err := endTerm()
+			if err != nil {
+				return nil, err
+			}
+
+			if len(group) == 0 || i == len(words)-1 {
+				return nil, utils.UsageError("invalid search query " + query + ": " + word + " must be between two terms")
+			}
+
+			if strings.EqualFold(word, "OR") {
+				parsed = append(parsed, group)
+				group = nil
+			}
+			continue
+		}
+
+		field, value, found := strings.Cut(word, ":")
+		isField := found && isInstanceQueryField(field)
+
+		if isField || !continues {
+			err := endTerm()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if termStart < 0 {
+			termStart = bounds[0]
+			continues = !isField || strings.EqualFold(field, "name")
+			quoted = isField && strings.Count(value, `"`)%2 == 1
+		}
+		termEnd = bounds[1]
+	}
+
+	if quoted {
+		return nil, utils.UsageError("invalid search query " + query + ": missing closing quote")
+	}
+
+	err := endTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(group) > 0 {
+		parsed = append(parsed, group)
+	}
+
+	return parsed, nil
+}
+
+// Parse an instance search term, field:value or a name pattern
+func parseInstanceTerm(term string) (instanceTerm, error) {
+	field, value, found := strings.Cut(term, ":")
+	if !found || !isInstanceQueryField(field) {
+		// Name patterns may contain colons (E.g. a regex), only known fields are split off
+		field, value = "name", term
+	} else {
+		// Quotes only group the words of a value (E.g. host:"api 1")
+		value = strings.ReplaceAll(value, `"`, "")
+	}
+	field = strings.ToLower(field)
+
+	if value == "" {
+		return instanceTerm{}, utils.UsageError("invalid search term " + term + ": missing value")
+	}
+
+	parsed := instanceTerm{field: field}
+
+	switch field {
+	case "name":
+		// Handle simple wildcard
+		if value == "*" {
+			value = ".*"
+		}
+
+		pattern, err := regexp.Compile("(?i)" + value)
+		if err != nil {
+			return instanceTerm{}, utils.UsageError("invalid search pattern " + value + ": " + err.Error())
+		}
+		parsed.pattern = pattern
+
+		return parsed, nil
+	case "ip":
+		if strings.Contains(value, "/") {
+			_, network, err := net.ParseCIDR(value)
+			if err != nil {
+				return instanceTerm{}, utils.UsageError("invalid search term " + term + ": " + err.Error())
+			}
+			parsed.network = network
+
+			return parsed, nil
+		}
+	case "tag":
+		// tag:KEY matches instances with the tag, tag:KEY=VALUE instances with the tag set to the value
+		key, tagValue, hasValue := strings.Cut(value, "=")
+		if !hasValue {
+			tagValue = "*"
+		}
+		parsed.tagKey = key
+		value = tagValue
+	}
+
+	parsed.pattern = globPattern(value)
+
+	return parsed, nil
+}
+
+// Return true for an instance search field, case insensitive
+func isInstanceQueryField(field string) bool {
+	for _, queryField := range instanceQueryFields {
+		if strings.EqualFold(field, queryField) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Compile a case insensitive glob, * matches any characters
+func globPattern(glob string) *regexp.Regexp {
+	parts := strings.Split(glob, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+
+	return regexp.MustCompile("(?i)^" + strings.Join(parts, ".*") + "$")
+}
+
+// Return true if the query matches fields only known after the VNIC lookup (IP and hostname)
+func (query instanceQuery) needsVnics() bool {
+	for _, group := range query {
+		for _, term := range group {
+			if term.field == "ip" || term.field == "host" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Return instances matching the query, in order
+func (query instanceQuery) filter(instances []Instance) []Instance {
+	if len(query) == 0 {
+		return instances
+	}
+
+	var matches []Instance
+	for _, instance := range instances {
+		if query.match(instance) {
+			matches = append(matches, instance)
+		}
+	}
+
+	return matches
+}
+
+// Return true if all terms of any group match the instance
+func (query instanceQuery) match(instance Instance) bool {
+	for _, group := range query {
+		groupMatch := true
+		for _, term := range group {
+			if !term.match(instance) {
+				groupMatch = false
+				break
+			}
+		}
+
+		if groupMatch {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return true if the term matches the instance
+func (term instanceTerm) match(instance Instance) bool {
+	switch term.field {
+	case "name":
+		return term.pattern.MatchString(instance.Name)
+	case "id":
+		return term.pattern.MatchString(instance.Id)
+	case "ip":
+		if term.network != nil {
+			ip := net.ParseIP(instance.Ip)
+			return ip != nil && term.network.Contains(ip)
+		}
+		return term.pattern.MatchString(instance.Ip)
+	case "host":
+		return term.pattern.MatchString(instance.Hostname)
+	case "shape":
+		return term.pattern.MatchString(instance.Shape)
+	case "ad":
+		return matchDomain(term.pattern, instance.Ad)
+	case "fd":
+		return matchDomain(term.pattern, instance.Fd)
+	case "tag":
+		return term.matchTags(instance)
+	}
+
+	return false
+}
+
+// Match an availability or fault domain by its full name or a suffix (E.g. ad:AD-2 matches Uocm:US-ASHBURN-AD-2)
+func matchDomain(pattern *regexp.Regexp, domain string) bool {
+	for i := 0; i < len(domain); i++ {
+		if (i == 0 || domain[i-1] == ':' || domain[i-1] == '-') && pattern.MatchString(domain[i:]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Match the instance's free form tags by key, and defined tags by key (any namespace) or namespace.key
+func (term instanceTerm) matchTags(instance Instance) bool {
+	for key, value := range instance.FreeformTags {
+		if strings.EqualFold(key, term.tagKey) && term.pattern.MatchString(value) {
+			return true
+		}
+	}
+
+	for namespace, tags := range instance.DefinedTags {
+		for key, value := range tags {
+			if (strings.EqualFold(key, term.tagKey) || strings.EqualFold(namespace+"."+key, term.tagKey)) && term.pattern.MatchString(fmt.Sprint(value)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
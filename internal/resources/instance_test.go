@@ -0,0 +1,562 @@
+package resources
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/cnopslabs/oshiv/internal/fake"
+	"github.com/cnopslabs/oshiv/internal/utils"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/spf13/viper"
+)
+
+func TestFetchInstancesPagination(t *testing.T) {
+	backend := newBackend(t, 2)
+
+	instances, err := fetchInstances(backend, fake.CompartmentId, core.InstanceLifecycleStateRunning, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, instance := range instances {
+		names = append(names, instance.Name)
+	}
+
+	// Only running instances, in the order listed by OCI
+	want := []string{"web-1", "web-2", "api", "api", "db-1", "orphan-1"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("instances = %v, want %v", names, want)
+	}
+
+	if calls := backend.Calls("ListInstances"); calls != 3 {
+		t.Errorf("ListInstances calls = %d, want 3", calls)
+	}
+
+	for _, request := range backend.Requests() {
+		if request, ok := request.(core.ListInstancesRequest); ok && request.LifecycleState != core.InstanceLifecycleStateRunning {
+			t.Errorf("ListInstances lifecycle state = %q, want RUNNING", request.LifecycleState)
+		}
+	}
+
+	web1 := instances[0]
+	if web1.Id != "ocid1.instance.oc1.iad.web1" || web1.Shape != "VM.Standard.E4.Flex" || web1.VCPUs != 2 || web1.Mem != 16 || web1.Region != "us-ashburn-1" {
+		t.Errorf("web-1 = %+v", web1)
+	}
+}
+
+func TestFetchInstancesAllStates(t *testing.T) {
+	backend := newBackend(t, 0)
+
+	instances, err := fetchInstances(backend, fake.CompartmentId, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var states []string
+	for _, instance := range instances {
+		states = append(states, instance.Name+" "+string(instance.State))
+	}
+
+	want := []string{"web-1 RUNNING", "web-2 RUNNING", "api RUNNING", "api RUNNING", "db-1 RUNNING", "batch-1 STOPPED", "orphan-1 RUNNING", "etl-1 STOPPED", "build-1 PROVISIONING", "old-1 TERMINATED"}
+	if !reflect.DeepEqual(states, want) {
+		t.Errorf("instances = %v, want %v", states, want)
+	}
+
+	request := backend.Requests()[0].(core.ListInstancesRequest)
+	if request.LifecycleState != "" {
+		t.Errorf("ListInstances lifecycle state = %q, want none", request.LifecycleState)
+	}
+}
+
+func TestFetchInstancesOptionalFields(t *testing.T) {
+	// Instances are split over pages, all placeholders must be the same on every page
+	backend := newBackend(t, 3)
+
+	instances, err := fetchInstances(backend, fake.CompartmentId, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, instance := range instances {
+		if instance.Ip != "" || instance.Hostname != "" || instance.SubnetId != "" {
+			t.Errorf("%s IP, hostname, subnet = %q, %q, %q, want them looked up separately", instance.Name, instance.Ip, instance.Hostname, instance.SubnetId)
+		}
+	}
+
+	// old-1 is terminated, without shape config, image, and fault domain
+	old1 := instances[len(instances)-1]
+	want := Instance{Name: "old-1", Id: "ocid1.instance.oc1.iad.old1", Ad: "Uocm:US-ASHBURN-AD-1", Shape: "VM.Standard.E4.Flex", TimeCreated: old1.TimeCreated, Region: "us-ashburn-1", State: core.InstanceLifecycleStateTerminated}
+	if !reflect.DeepEqual(old1, want) {
+		t.Errorf("old-1 = %+v, want %+v", old1, want)
+	}
+}
+
+func TestFetchInstancesError(t *testing.T) {
+	backend := newBackend(t, 0)
+	backend.Errors["ListInstances"] = fake.ServiceError{StatusCode: 500, Code: "InternalError", Message: "internal error"}
+
+	_, err := fetchInstances(backend, fake.CompartmentId, core.InstanceLifecycleStateRunning, false)
+
+	var serviceErr common.ServiceError
+	if !errors.As(err, &serviceErr) || serviceErr.GetHTTPStatusCode() != 500 {
+		t.Errorf("error = %v, want wrapped 500 service error", err)
+	}
+}
+
+func TestFindInstances(t *testing.T) {
+	backend := newBackend(t, 2)
+
+	instances, err := FindInstances(backend, backend, fake.CompartmentId, core.InstanceLifecycleStateRunning, "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type ipJoin struct {
+		Name, Ip, Hostname, SubnetId string
+	}
+
+	var got []ipJoin
+	for _, instance := range instances {
+		got = append(got, ipJoin{instance.Name, instance.Ip, instance.Hostname, instance.SubnetId})
+	}
+
+	// Sorted by name, the instance without a VNIC attachment (orphan-1) is skipped
+	// The secondary private IP of web-1 (10.0.1.100) is not its instance IP
+	want := []ipJoin{
+		{"api", "10.0.1.20", "api1", "ocid1.subnet.oc1.iad.app"},
+		{"api", "10.0.1.21", "api2", "ocid1.subnet.oc1.iad.app"},
+		{"db-1", "10.0.2.10", "db1", "ocid1.subnet.oc1.iad.data"},
+		{"web-1", "10.0.1.10", "web1", "ocid1.subnet.oc1.iad.app"},
+		{"web-2", "10.0.1.11", "web2", "ocid1.subnet.oc1.iad.app"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("instances = %v, want %v", got, want)
+	}
+
+	// The app subnet (4 VNICs) is listed at once, the single VNIC in the data subnet is looked up directly
+	var listedSubnets []string
+	for _, request := range backend.Requests() {
+		if request, ok := request.(core.ListPrivateIpsRequest); ok && request.Page == nil {
+			listedSubnets = append(listedSubnets, *request.SubnetId)
+		}
+	}
+	if !reflect.DeepEqual(listedSubnets, []string{"ocid1.subnet.oc1.iad.app"}) {
+		t.Errorf("private IPs listed for subnets %v, want app subnet only", listedSubnets)
+	}
+
+	if calls := backend.Calls("GetVnic"); calls != 1 {
+		t.Errorf("GetVnic calls = %d, want 1", calls)
+	}
+
+	if calls := backend.Calls("GetImage"); calls != 0 {
+		t.Errorf("GetImage calls = %d, want 0 without image details", calls)
+	}
+}
+
+func TestFindInstancesPattern(t *testing.T) {
+	backend := newBackend(t, 0)
+
+	instances, err := FindInstances(backend, backend, fake.CompartmentId, core.InstanceLifecycleStateRunning, "^web", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(instances) != 2 || instances[0].Name != "web-1" || instances[1].Name != "web-2" {
+		t.Errorf("instances = %+v, want web-1 and web-2", instances)
+	}
+}
+
+// Add a running instance named name, a copy of web-1 without a VNIC
+func addInstance(backend *fake.Backend, name string) string {
+	instance := backend.Instances[0]
+	instance.Id = common.String("ocid1.instance.oc1.iad." + strings.ReplaceAll(name, "-", ""))
+	instance.DisplayName = common.String(name)
+	backend.Instances = append(backend.Instances, instance)
+
+	return *instance.Id
+}
+
+func TestFindInstancesByName(t *testing.T) {
+	backend := newBackend(t, 0)
+	addInstance(backend, "web-10")
+
+	tests := []struct {
+		nameOrId string
+		want     []string // Instance IDs
+	}{
+		// Names match exactly, not as a pattern
+		{"web-1", []string{"ocid1.instance.oc1.iad.web1"}},
+		{"web", nil},
+		{"^web-1$", nil},
+		{"WEB-1", nil},
+		{"ocid1.instance.oc1.iad.web2", []string{"ocid1.instance.oc1.iad.web2"}},
+		// Display names aren't unique
+		{"api", []string{"ocid1.instance.oc1.iad.api1", "ocid1.instance.oc1.iad.api2"}},
+		// Only instances in the state are matched
+		{"etl-1", nil},
+	}
+
+	for _, test := range tests {
+		instances, err := FindInstancesByName(backend, backend, fake.CompartmentId, core.InstanceLifecycleStateRunning, test.nameOrId, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		for _, instance := range instances {
+			got = append(got, instance.Id)
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("FindInstancesByName(%q) = %v, want %v", test.nameOrId, got, test.want)
+		}
+	}
+}
+
+func TestFindInstancesState(t *testing.T) {
+	tests := []struct {
+		state core.InstanceLifecycleStateEnum
+		want  []string
+	}{
+		{core.InstanceLifecycleStateStopped, []string{"batch-1 10.0.1.30", "etl-1 10.0.2.11"}},
+		{core.InstanceLifecycleStateProvisioning, []string{"build-1 "}},
+		{core.InstanceLifecycleStateTerminated, []string{"old-1 "}},
+		{"", []string{"api 10.0.1.20", "api 10.0.1.21", "batch-1 10.0.1.30", "build-1 ", "db-1 10.0.2.10", "etl-1 10.0.2.11", "old-1 ", "web-1 10.0.1.10", "web-2 10.0.1.11"}},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.state), func(t *testing.T) {
+			backend := newBackend(t, 2)
+
+			instances, err := FindInstances(backend, backend, fake.CompartmentId, test.state, "", false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The detached VNIC of etl-1 is looked up, the deleted VNIC of old-1 and the VNIC build-1 doesn't have yet are skipped
+			// The detached VNIC of web-1 doesn't replace the attached one
+			var got []string
+			for _, instance := range instances {
+				got = append(got, instance.Name+" "+instance.Ip)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("instances = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseInstanceState(t *testing.T) {
+	tests := []struct {
+		state string
+		want  core.InstanceLifecycleStateEnum
+		valid bool
+	}{
+		{"running", core.InstanceLifecycleStateRunning, true},
+		{"STOPPED", core.InstanceLifecycleStateStopped, true},
+		{"All", "", true},
+		{"paused", "", false},
+	}
+
+	for _, test := range tests {
+		state, err := ParseInstanceState(test.state)
+		if state != test.want || (err == nil) != test.valid {
+			t.Errorf("ParseInstanceState(%q) = %q, %v, want %q", test.state, state, err, test.want)
+		}
+	}
+}
+
+func TestFindInstancesQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"WEB", []string{"web1", "web2"}},
+		{"*", []string{"api1", "api2", "db1", "web1", "web2"}},
+		{"name:^api", []string{"api1", "api2"}},
+		{"ip:10.0.1.10", []string{"web1"}},
+		{"ip:10.0.1.2*", []string{"api1", "api2"}},
+		{"ip:10.0.2.0/24", []string{"db1"}},
+		{"host:api*", []string{"api1", "api2"}},
+		{"HOST:WEB1", []string{"web1"}},
+		{"id:ocid1.instance.oc1.iad.db1", []string{"db1"}},
+		{"shape:VM.Standard.A1.Flex", []string{"api2"}},
+		{"shape:vm.standard.e4.*", []string{"api1", "db1", "web1", "web2"}},
+		{"ad:AD-2", []string{"web2"}},
+		{"ad:Uocm:US-ASHBURN-AD-1 fd:FAULT-DOMAIN-2", []string{"api2"}},
+		{"tag:team=payments", []string{"api1", "api2", "db1"}},
+		{"tag:Operations.tier=db", []string{"db1"}},
+		{"tag:tier", []string{"db1"}},
+		{"tag:team=payments AND shape:VM.Standard.E4.Flex", []string{"api1", "db1"}},
+		{"ip:10.0.2.10 OR host:web2", []string{"db1", "web2"}},
+		{"tag:team=web ad:AD-1 OR tag:team=payments ip:10.0.1.21", []string{"api2", "web1"}},
+		{"tag:team=finance", nil},
+		// Words without a field are one name regex, not several ANDed terms
+		{"web 1", nil},
+		{"web1|api1 OR ip:10.0.2.10", []string{"db1"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			backend := newBackend(t, 0)
+
+			instances, err := FindInstances(backend, backend, fake.CompartmentId, core.InstanceLifecycleStateRunning, test.query, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, instance := range instances {
+				got = append(got, strings.TrimPrefix(instance.Id, "ocid1.instance.oc1.iad."))
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("instances = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseInstanceQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  [][]string // field:value of the terms of each OR group
+	}{
+		{"web server", [][]string{{"name:web server"}}},
+		{"  web   server  ", [][]string{{"name:web   server"}}},
+		{"^web shape:E4 ad:AD-2", [][]string{{"name:^web", "shape:E4", "ad:AD-2"}}},
+		{"name:web server AND shape:E4", [][]string{{"name:web server", "shape:E4"}}},
+		{"web server OR db", [][]string{{"name:web server"}, {"name:db"}}},
+		{"a:b c", [][]string{{"name:a:b c"}}},
+		{"host:api-* web", [][]string{{"host:api-.*", "name:web"}}},
+		{"shape:E4 web server", [][]string{{"shape:E4", "name:web server"}}},
+		{`host:"api 1" web`, [][]string{{"host:api 1", "name:web"}}},
+		{`tag:team="data OR platform" OR db`, [][]string{{"tag:data OR platform"}, {"name:db"}}},
+		{"", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			query, err := parseInstanceQuery(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got [][]string
+			for _, group := range query {
+				var terms []string
+				for _, term := range group {
+					value := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(term.pattern.String(), "(?i)"), "^"), "$")
+					if term.field == "name" {
+						value = strings.TrimPrefix(term.pattern.String(), "(?i)")
+					}
+					terms = append(terms, term.field+":"+value)
+				}
+				got = append(got, terms)
+			}
+
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("query = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFindInstancesQueryVnicLookup(t *testing.T) {
+	backend := newBackend(t, 0)
+
+	// Queries on instance fields only look up the VNICs of matching instances
+	_, err := FindInstances(backend, backend, fake.CompartmentId, core.InstanceLifecycleStateRunning, "id:ocid1.instance.oc1.iad.db1", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if calls := backend.Calls("ListPrivateIps") + backend.Calls("GetVnic"); calls != 1 {
+		t.Errorf("VNIC lookups = %d, want 1", calls)
+	}
+}
+
+func TestFindInstancesQueryError(t *testing.T) {
+	for _, query := range []string{"OR web", "web AND", "name:(", "ip:10.0.1.0/33", "tag:", `host:"api 1`} {
+		t.Run(query, func(t *testing.T) {
+			backend := newBackend(t, 0)
+
+			_, err := FindInstances(backend, backend, fake.CompartmentId, core.InstanceLifecycleStateRunning, query, false, false)
+
+			var exitErr *utils.ExitCodeError
+			if !errors.As(err, &exitErr) || exitErr.Code != utils.ExitUsage {
+				t.Errorf("error = %v, want usage error", err)
+			}
+		})
+	}
+}
+
+func TestFindInstancesVnicNotListed(t *testing.T) {
+	backend := newBackend(t, 0)
+
+	// A VNIC created after the subnet's private IPs were listed is looked up directly
+	backend.PrivateIps = slices.DeleteFunc(backend.PrivateIps, func(privateIp core.PrivateIp) bool {
+		return *privateIp.VnicId == "ocid1.vnic.oc1.iad.web2"
+	})
+
+	instances, err := FindInstances(backend, backend, fake.CompartmentId, core.InstanceLifecycleStateRunning, "^(web|api)", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, instance := range instances {
+		if instance.Name == "web-2" && instance.Ip != "10.0.1.11" {
+			t.Errorf("web-2 IP = %q, want 10.0.1.11", instance.Ip)
+		}
+	}
+
+	if calls := backend.Calls("GetVnic"); calls != 1 {
+		t.Errorf("GetVnic calls = %d, want 1", calls)
+	}
+}
+
+func TestFindInstancesVnicWithoutHostname(t *testing.T) {
+	backend := newBackend(t, 0)
+
+	// A VNIC looked up directly without a hostname label, E.g. in a subnet without DNS
+	backend.PrivateIps = slices.DeleteFunc(backend.PrivateIps, func(privateIp core.PrivateIp) bool {
+		return *privateIp.VnicId == "ocid1.vnic.oc1.iad.web2"
+	})
+
+	for i, vnic := range backend.Vnics {
+		if *vnic.Id == "ocid1.vnic.oc1.iad.web2" {
+			backend.Vnics[i].HostnameLabel = nil
+		}
+	}
+
+	instances, err := FindInstances(backend, backend, fake.CompartmentId, core.InstanceLifecycleStateRunning, "web-2", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(instances) != 1 || instances[0].Ip != "10.0.1.11" || instances[0].Hostname != "Lookup failed" {
+		t.Errorf("instances = %+v, want web-2 with IP 10.0.1.11 and no hostname", instances)
+	}
+}
+
+func TestFindInstancesImageDetails(t *testing.T) {
+	backend := newBackend(t, 0)
+
+	instances, err := FindInstances(backend, backend, fake.CompartmentId, core.InstanceLifecycleStateRunning, "", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, instance := range instances {
+		if instance.Image == nil || instance.Image.Id != instance.ImageId {
+			t.Errorf("%s image = %+v, want image %s", instance.Name, instance.Image, instance.ImageId)
+		}
+	}
+
+	// Each image is looked up once
+	if calls := backend.Calls("GetImage"); calls != 2 {
+		t.Errorf("GetImage calls = %d, want 2", calls)
+	}
+}
+
+func TestFindInstancesAllStatesImageDetails(t *testing.T) {
+	backend := newBackend(t, 0)
+
+	instances, err := FindInstances(backend, backend, fake.CompartmentId, "", "old-1", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Instances without an image aren't looked up
+	if len(instances) != 1 || instances[0].Image != nil {
+		t.Errorf("instances = %+v, want old-1 without an image", instances)
+	}
+
+	if calls := backend.Calls("GetImage"); calls != 0 {
+		t.Errorf("GetImage calls = %d, want 0", calls)
+	}
+}
+
+func TestResolveInstanceTarget(t *testing.T) {
+	tests := []struct {
+		target string
+		want   []string // Candidate instance IDs
+	}{
+		{"web-1", []string{"ocid1.instance.oc1.iad.web1"}},
+		{"ocid1.instance.oc1.iad.db1", []string{"ocid1.instance.oc1.iad.db1"}},
+		{"api", []string{"ocid1.instance.oc1.iad.api1", "ocid1.instance.oc1.iad.api2"}},
+		{"10.0.1.11", []string{"ocid1.instance.oc1.iad.web2"}},
+		{"WEB2", []string{"ocid1.instance.oc1.iad.web2"}},
+		{"10.0.1.100", nil},
+		{"batch-1", nil},
+		{"orphan-1", nil},
+		{"ocid1.instance.oc1.iad.missing", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.target, func(t *testing.T) {
+			backend := newBackend(t, 2)
+
+			candidates, err := ResolveInstanceTarget(backend, backend, fake.CompartmentId, test.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var ids []string
+			for _, candidate := range candidates {
+				ids = append(ids, candidate.Id)
+
+				if candidate.Ip == "" || candidate.SubnetId == "" {
+					t.Errorf("candidate %+v is missing its IP or subnet", candidate)
+				}
+			}
+
+			if !reflect.DeepEqual(ids, test.want) {
+				t.Errorf("candidates = %v, want %v", ids, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveInstanceTargetSkipsCache(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	viper.Set("no-cache", false)
+	t.Cleanup(func() { viper.Set("no-cache", true) })
+
+	backend := newBackend(t, 0)
+
+	// Cache the instances and their IPs
+	_, err := FindInstances(backend, backend, fake.CompartmentId, core.InstanceLifecycleStateRunning, "", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// web-1 gets a new IP, E.g. it was recreated
+	for i := range backend.PrivateIps {
+		if *backend.PrivateIps[i].IpAddress == "10.0.1.10" {
+			backend.PrivateIps[i].IpAddress = common.String("10.0.1.99")
+		}
+	}
+	for i := range backend.Vnics {
+		if backend.Vnics[i].PrivateIp != nil && *backend.Vnics[i].PrivateIp == "10.0.1.10" {
+			backend.Vnics[i].PrivateIp = common.String("10.0.1.99")
+		}
+	}
+
+	for _, target := range []string{"web-1", "10.0.1.99"} {
+		candidates, err := ResolveInstanceTarget(backend, backend, fake.CompartmentId, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(candidates) != 1 || candidates[0].Ip != "10.0.1.99" {
+			t.Errorf("%s candidates = %+v, want web-1 with IP 10.0.1.99", target, candidates)
+		}
+	}
+}
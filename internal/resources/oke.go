@@ -2,10 +2,9 @@ package resources
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
 	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/cnopslabs/oshiv/internal/utils"
@@ -13,73 +12,91 @@ import (
 )
 
 type Cluster struct {
-	name                string
-	id                  string
-	privateEndpointIp   string
-	privateEndpointPort string
+	Name                string `json:"name" yaml:"name"`
+	Id                  string `json:"id" yaml:"id"`
+	PrivateEndpointIp   string `json:"private_endpoint_ip" yaml:"private_endpoint_ip"`
+	PrivateEndpointPort string `json:"private_endpoint_port" yaml:"private_endpoint_port"`
+	KubernetesVersion   string `json:"kubernetes_version" yaml:"kubernetes_version"`
+	State               string `json:"state" yaml:"state"`
+	Region              string `json:"region,omitempty" yaml:"region,omitempty"`           // Only set with --all-regions
+	Compartment         string `json:"compartment,omitempty" yaml:"compartment,omitempty"` // Compartment path, only set with --recursive
 }
 
-// Fetch all clusters via OCI API call
-func fetchClusters(containerEngineClient containerengine.ContainerEngineClient, compartmentId string) []Cluster {
-	var clusters []Cluster
+// Split a cluster's private endpoint into IP and port, found is false for clusters with only a public endpoint
+func clusterPrivateEndpoint(cluster containerengine.ClusterSummary) (string, string, bool) {
+	if cluster.Endpoints == nil || cluster.Endpoints.PrivateEndpoint == nil {
+		return "", "", false
+	}
 
-	initialResponse, err := containerEngineClient.ListClusters(context.Background(), containerengine.ListClustersRequest{CompartmentId: &compartmentId})
-	utils.CheckError(err)
+	return strings.Cut(*cluster.Endpoints.PrivateEndpoint, ":")
+}
 
-	for _, cluster := range initialResponse.Items {
-		clusterId := *cluster.Id
-		clusterName := *cluster.Name
+// Fetch all clusters via OCI API call, cached (see utils.Cached)
+func fetchClusters(containerEngineClient ContainerEngineClient, compartmentId string) ([]Cluster, error) {
+	return utils.Cached(containerEngineClient.Endpoint(), compartmentId, "clusters", false, func() ([]Cluster, error) {
+		var clusters []Cluster
 
-		clusterPrivateEndpointIp, clusterPrivateEndpointPort, found := strings.Cut(*cluster.Endpoints.PrivateEndpoint, ":")
-		if found {
-			cluster := Cluster{clusterName, clusterId, clusterPrivateEndpointIp, clusterPrivateEndpointPort}
-			clusters = append(clusters, cluster)
+		initialResponse, err := containerEngineClient.ListClusters(context.Background(), containerengine.ListClustersRequest{CompartmentId: &compartmentId})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list OKE clusters: %w", err)
 		}
-	}
 
-	if initialResponse.OpcNextPage != nil {
-		nextPage := initialResponse.OpcNextPage
+		for _, cluster := range initialResponse.Items {
+			clusterId := *cluster.Id
+			clusterName := *cluster.Name
 
-		for {
-			response, err := containerEngineClient.ListClusters(context.Background(), containerengine.ListClustersRequest{CompartmentId: &compartmentId, Page: nextPage})
-			utils.CheckError(err)
+			clusterPrivateEndpointIp, clusterPrivateEndpointPort, found := clusterPrivateEndpoint(cluster)
+			if found {
+				cluster := Cluster{clusterName, clusterId, clusterPrivateEndpointIp, clusterPrivateEndpointPort, *cluster.KubernetesVersion, string(cluster.LifecycleState), "", ""}
+				clusters = append(clusters, cluster)
+			}
+		}
 
-			for _, cluster := range response.Items {
-				clusterId := *cluster.Id
-				clusterName := *cluster.Name
+		if initialResponse.OpcNextPage != nil {
+			nextPage := initialResponse.OpcNextPage
 
-				clusterPrivateEndpointIp, clusterPrivateEndpointPort, found := strings.Cut(*cluster.Endpoints.PrivateEndpoint, ":")
-				if found {
-					cluster := Cluster{clusterName, clusterId, clusterPrivateEndpointIp, clusterPrivateEndpointPort}
-					clusters = append(clusters, cluster)
+			for {
+				response, err := containerEngineClient.ListClusters(context.Background(), containerengine.ListClustersRequest{CompartmentId: &compartmentId, Page: nextPage})
+				if err != nil {
+					return nil, fmt.Errorf("unable to list OKE clusters: %w", err)
 				}
-			}
 
-			if response.OpcNextPage != nil {
-				nextPage = response.OpcNextPage
-			} else {
-				break
+				for _, cluster := range response.Items {
+					clusterId := *cluster.Id
+					clusterName := *cluster.Name
+
+					clusterPrivateEndpointIp, clusterPrivateEndpointPort, found := clusterPrivateEndpoint(cluster)
+					if found {
+						cluster := Cluster{clusterName, clusterId, clusterPrivateEndpointIp, clusterPrivateEndpointPort, *cluster.KubernetesVersion, string(cluster.LifecycleState), "", ""}
+						clusters = append(clusters, cluster)
+					}
+				}
+
+				if response.OpcNextPage != nil {
+					nextPage = response.OpcNextPage
+				} else {
+					break
+				}
 			}
 		}
-	}
 
-	return clusters
+		return clusters, nil
+	})
 }
 
-func FetchClusterId(containerEngineClient containerengine.ContainerEngineClient, compartmentId string, clusterName string) string {
-	clusters := fetchClusters(containerEngineClient, compartmentId)
-	var clusterId string
+func FetchClusterId(containerEngineClient ContainerEngineClient, compartmentId string, clusterName string) (string, error) {
+	clusters, err := fetchClusters(containerEngineClient, compartmentId)
+	if err != nil {
+		return "", err
+	}
 
 	for _, cluster := range clusters {
-		if cluster.name == clusterName {
-			clusterId = cluster.id
-		} else {
-			fmt.Println("Unable to find ID of " + clusterName)
-			os.Exit(1)
+		if cluster.Name == clusterName {
+			return cluster.Id, nil
 		}
 	}
 
-	return clusterId
+	return "", errors.New("unable to find ID of OKE cluster " + clusterName)
 }
 
 // Match pattern and return cluster matches
@@ -92,7 +109,7 @@ func matchClusters(pattern string, clusters []Cluster) []Cluster {
 	}
 
 	for _, cluster := range clusters {
-		match, _ := regexp.MatchString(pattern, cluster.name)
+		match, _ := regexp.MatchString(pattern, cluster.Name)
 		if match {
 			matches = append(matches, cluster)
 		}
@@ -101,38 +118,54 @@ func matchClusters(pattern string, clusters []Cluster) []Cluster {
 	return matches
 }
 
-// Find clusters matching search pattern
-func FindClusters(containerEngineClient containerengine.ContainerEngineClient, compartmentId string, searchString string) []Cluster {
-	var clusterMatches []Cluster
-	clusters := fetchClusters(containerEngineClient, compartmentId)
+// Find clusters matching search pattern, all clusters if the pattern is empty
+func FindClusters(containerEngineClient ContainerEngineClient, compartmentId string, searchString string) ([]Cluster, error) {
+	clusters, err := fetchClusters(containerEngineClient, compartmentId)
+	if err != nil {
+		return nil, err
+	}
 
 	if searchString != "" {
-		// Find matching clusters
-		pattern := searchString
-		clusterMatches = matchClusters(pattern, clusters)
-		utils.Faint.Println(strconv.Itoa(len(clusterMatches)) + " matches")
-	} else {
-		// List all clusters
-		clusterMatches = clusters
-		utils.Faint.Println(strconv.Itoa(len(clusterMatches)) + " cluster(s)")
+		return matchClusters(searchString, clusters), nil
 	}
 
-	return clusterMatches
+	return clusters, nil
 }
 
-// Print clusters
-func PrintClusters(clusters []Cluster, tenancyName string, compartmentName string) {
+// Print clusters, detailed text by default or in the format set by --output
+// The region and compartment are included when clusters span regions (--all-regions) or compartments (--recursive)
+func PrintClusters(clusters []Cluster, tenancyName string, compartmentName string, scope Scope) error {
+	if utils.OutputFormat() != "" {
+		columns := []utils.Column{{Header: "Name"}, {Header: "Private Endpoint"}, {Header: "State"}, {Header: "Version", Wide: true}, {Header: "OCID", Wide: true}}
+		columns = scope.columns(columns)
+
+		var rows [][]string
+		for _, cluster := range clusters {
+			row := []string{cluster.Name, cluster.PrivateEndpointIp + ":" + cluster.PrivateEndpointPort, cluster.State, cluster.KubernetesVersion, cluster.Id}
+			row = scope.row(cluster.Region, cluster.Compartment, row)
+			rows = append(rows, row)
+		}
+
+		if !utils.StructuredOutput() {
+			utils.FaintMagenta.Println("Tenancy(Compartment): " + tenancyName + "(" + compartmentName + ")")
+		}
+		return utils.PrintOutput(clusters, columns, rows)
+	}
+
 	if len(clusters) > 0 {
 		utils.FaintMagenta.Println("Tenancy(Compartment): " + tenancyName + "(" + compartmentName + ")")
 
 		for _, cluster := range clusters {
 			fmt.Print("Name: ")
-			utils.Blue.Println(cluster.name)
+			utils.Blue.Println(cluster.Name)
 			fmt.Print("Cluster ID: ")
-			utils.Yellow.Println(cluster.id)
+			utils.Yellow.Println(cluster.Id)
+			scope.print(cluster.Region, cluster.Compartment)
 			fmt.Print("Private endpoint: ")
-			utils.Yellow.Println(cluster.privateEndpointIp + ":" + cluster.privateEndpointPort)
+			utils.Yellow.Println(cluster.PrivateEndpointIp + ":" + cluster.PrivateEndpointPort)
 			fmt.Println("")
 		}
 	}
+
+	return nil
 }
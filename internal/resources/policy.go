@@ -5,119 +5,106 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/cnopslabs/oshiv/internal/utils"
 	"github.com/oracle/oci-go-sdk/v65/identity"
 )
 
 type Policy struct {
-	name       string
-	id         string
-	statements []string
+	Name        string   `json:"name" yaml:"name"`
+	Id          string   `json:"id" yaml:"id"`
+	Statements  []string `json:"statements" yaml:"statements"`
+	Compartment string   `json:"compartment,omitempty" yaml:"compartment,omitempty"` // Compartment path, only set with --recursive
 }
 
 // Adding this because there's no set object type, may be worth implementing my own
 // Checks if Policy object exists in Policy list by name
 func policyContains(policies []Policy, policy Policy) bool {
 
-	var policyExists bool
-
 	for _, existing_policy := range policies {
-		if policy.name == existing_policy.name {
-			policyExists = true
-		} else {
-			policyExists = false
+		if policy.Id == existing_policy.Id {
+			return true
 		}
 	}
 
-	return policyExists
+	return false
 }
 
-// Fetch all policies via OCI API call
-func fetchPolicies(identityClient identity.IdentityClient, compartmentId string) []Policy {
-	var policies []Policy
-	var pageCount int
-	pageCount = 0
-
-	initialResponse, err := identityClient.ListPolicies(context.Background(), identity.ListPoliciesRequest{CompartmentId: &compartmentId})
-	utils.CheckError(err)
-
-	for _, policy := range initialResponse.Items {
-		pageCount += 1
+// Fetch all policies via OCI API call, cached (see utils.Cached)
+func fetchPolicies(identityClient IdentityClient, compartmentId string) ([]Policy, error) {
+	return utils.Cached(identityClient.Endpoint(), compartmentId, "policies", false, func() ([]Policy, error) {
+		var policies []Policy
+		var pageCount int
+		pageCount = 0
 
-		newPolicy := Policy{
-			*policy.Name,
-			*policy.Id,
-			policy.Statements,
+		initialResponse, err := identityClient.ListPolicies(context.Background(), identity.ListPoliciesRequest{CompartmentId: &compartmentId})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list policies: %w", err)
 		}
 
-		policies = append(policies, newPolicy)
-	}
-
-	if initialResponse.OpcNextPage != nil {
-		pageCount += 1
-		nextPage := initialResponse.OpcNextPage
-
-		for {
-			response, err := identityClient.ListPolicies(context.Background(), identity.ListPoliciesRequest{CompartmentId: &compartmentId, Page: nextPage})
-			utils.CheckError(err)
+		for _, policy := range initialResponse.Items {
+			pageCount += 1
 
-			for _, policy := range response.Items {
-				pageCount += 1
-
-				newPolicy := Policy{
-					*policy.Name,
-					*policy.Id,
-					policy.Statements,
-				}
-
-				policies = append(policies, newPolicy)
+			newPolicy := Policy{
+				*policy.Name,
+				*policy.Id,
+				policy.Statements,
+				"",
 			}
 
-			if response.OpcNextPage != nil {
-				nextPage = response.OpcNextPage
-			} else {
-				break
-			}
+			policies = append(policies, newPolicy)
 		}
-	}
 
-	return policies
-}
-
-// List and print policies (OCI API call)
-func ListPolicies(identityClient identity.IdentityClient, compartmentId string, flagPolicyListNameOnly bool) {
-	policies := fetchPolicies(identityClient, compartmentId)
+		if initialResponse.OpcNextPage != nil {
+			pageCount += 1
+			nextPage := initialResponse.OpcNextPage
 
-	utils.Faint.Println(strconv.Itoa(len(policies)) + " results")
+			for {
+				response, err := identityClient.ListPolicies(context.Background(), identity.ListPoliciesRequest{CompartmentId: &compartmentId, Page: nextPage})
+				if err != nil {
+					return nil, fmt.Errorf("unable to list policies: %w", err)
+				}
 
-	for _, policy := range policies {
-		if flagPolicyListNameOnly {
-			fmt.Println(policy.name)
-		} else {
-			fmt.Print("Name: ")
-			utils.Blue.Println(policy.name)
+				for _, policy := range response.Items {
+					pageCount += 1
 
-			fmt.Print("ID: ")
-			utils.Yellow.Println(policy.id)
+					newPolicy := Policy{
+						*policy.Name,
+						*policy.Id,
+						policy.Statements,
+						"",
+					}
 
-			fmt.Println("Statements: ")
+					policies = append(policies, newPolicy)
+				}
 
-			for _, statement := range policy.statements {
-				utils.Faint.Println(statement)
+				if response.OpcNextPage != nil {
+					nextPage = response.OpcNextPage
+				} else {
+					break
+				}
 			}
-			fmt.Println("")
 		}
-	}
+
+		return policies, nil
+	})
 }
 
-// Find and print policies (OCI API call)
-func FindPolicies(identityClient identity.IdentityClient, compartmentId string, flagPolicyFind string, flagPolicyFindStatement string, flagPolicyListNameOnly bool) {
+// Find policies by name and/or statement search pattern, all policies if both patterns are empty (OCI API call)
+func FindPolicies(identityClient IdentityClient, compartmentId string, flagPolicyFind string, flagPolicyFindStatement string) ([]Policy, error) {
 	// TODO: When matching on policy statement, it would probably make more sense to only return the statements with matches as opposed to returning all statements
 	pattern_name := flagPolicyFind
 	pattern_statement := flagPolicyFindStatement
 
-	policies := fetchPolicies(identityClient, compartmentId)
+	policies, err := fetchPolicies(identityClient, compartmentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if pattern_name == "" && pattern_statement == "" {
+		return policies, nil
+	}
 
 	var matches []Policy
 
@@ -133,7 +120,7 @@ func FindPolicies(identityClient identity.IdentityClient, compartmentId string,
 	if pattern_name != "" && pattern_statement == "" {
 		// Match on name
 		for _, policy := range policies {
-			match, _ := regexp.MatchString("(?i)"+pattern_name, policy.name)
+			match, _ := regexp.MatchString("(?i)"+pattern_name, policy.Name)
 			if match {
 				matches = append(matches, policy)
 			}
@@ -141,7 +128,7 @@ func FindPolicies(identityClient identity.IdentityClient, compartmentId string,
 	} else if pattern_name == "" && pattern_statement != "" {
 		// Match on statement
 		for _, policy := range policies {
-			for _, statement := range policy.statements {
+			for _, statement := range policy.Statements {
 				match, _ := regexp.MatchString("(?i)"+pattern_statement, statement)
 				if match {
 					if !policyContains(matches, policy) {
@@ -155,14 +142,14 @@ func FindPolicies(identityClient identity.IdentityClient, compartmentId string,
 		var name_matches []Policy
 
 		for _, policy := range policies {
-			n_match, _ := regexp.MatchString("(?i)"+pattern_name, policy.name)
+			n_match, _ := regexp.MatchString("(?i)"+pattern_name, policy.Name)
 			if n_match {
 				name_matches = append(name_matches, policy)
 			}
 		}
 
 		for _, policy := range name_matches {
-			for _, statement := range policy.statements {
+			for _, statement := range policy.Statements {
 				s_match, _ := regexp.MatchString("(?i)"+pattern_statement, statement)
 
 				if s_match {
@@ -174,28 +161,49 @@ func FindPolicies(identityClient identity.IdentityClient, compartmentId string,
 		}
 	}
 
-	if len(matches) > 0 {
-		matchCount := len(matches)
-		utils.Faint.Println(strconv.Itoa(matchCount) + " policy matches")
+	return matches, nil
+}
+
+// Print policies, detailed text by default or in the format set by --output
+// Structured output always includes statements, table output only with --output wide
+// The compartment is included when policies span compartments (--recursive), policies are not regional
+func PrintPolicies(policies []Policy, flagPolicyListNameOnly bool, scope Scope) error {
+	if utils.OutputFormat() != "" {
+		columns := scope.columns([]utils.Column{{Header: "Name"}, {Header: "Statement Count"}, {Header: "OCID", Wide: true}, {Header: "Statements", Wide: true}})
+
+		var rows [][]string
+		for _, policy := range policies {
+			rows = append(rows, scope.row("", policy.Compartment, []string{policy.Name, strconv.Itoa(len(policy.Statements)), policy.Id, strings.Join(policy.Statements, "; ")}))
+		}
+
+		return utils.PrintOutput(policies, columns, rows)
+	}
 
-		for _, policy := range matches {
-			if flagPolicyListNameOnly {
-				// fmt.Print("Name: ")
-				utils.Blue.Println(policy.name)
+	for _, policy := range policies {
+		if flagPolicyListNameOnly {
+			if scope.ShowCompartment {
+				utils.Blue.Print(policy.Name)
+				utils.Faint.Println(" (" + policy.Compartment + ")")
 			} else {
-				fmt.Print("Name: ")
-				utils.Blue.Println(policy.name)
+				utils.Blue.Println(policy.Name)
+			}
+		} else {
+			fmt.Print("Name: ")
+			utils.Blue.Println(policy.Name)
 
-				fmt.Print("ID: ")
-				utils.Yellow.Println(policy.id)
+			fmt.Print("ID: ")
+			utils.Yellow.Println(policy.Id)
 
-				fmt.Println("Statements: ")
-				for _, statement := range policy.statements {
-					utils.Faint.Println(statement)
-				}
+			scope.print("", policy.Compartment)
 
-				fmt.Println("")
+			fmt.Println("Statements: ")
+			for _, statement := range policy.Statements {
+				utils.Faint.Println(statement)
 			}
+
+			fmt.Println("")
 		}
 	}
+
+	return nil
 }
@@ -0,0 +1,54 @@
+package resources
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cnopslabs/oshiv/internal/fake"
+)
+
+func TestFindPolicies(t *testing.T) {
+	allPolicies := []string{"admins", "network-admins", "prod-readers", "bastion-users", "Dev-Admins"}
+
+	tests := []struct {
+		name             string
+		namePattern      string
+		statementPattern string
+		want             []string
+	}{
+		{"all", "", "", allPolicies},
+		{"name wildcard", "*", "", allPolicies},
+		{"statement wildcard", "", "*", allPolicies},
+		{"name case insensitive", "ADMINS", "", []string{"admins", "network-admins", "Dev-Admins"}},
+		{"name regex", "^(admins|prod-)", "", []string{"admins", "prod-readers"}},
+		{"statement", "", "bastion", []string{"bastion-users"}},
+		{"statement matching several statements of a policy", "", "compartment prod", []string{"network-admins", "prod-readers", "bastion-users"}},
+		{"name and statement", "admins", "read instances", []string{"network-admins"}},
+		{"name and statement without match", "admins", "bastion", nil},
+		{"no match", "missing", "", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backend := newBackend(t, 2)
+
+			policies, err := FindPolicies(backend, fake.TenancyId, test.namePattern, test.statementPattern)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for _, policy := range policies {
+				names = append(names, policy.Name)
+			}
+
+			if !reflect.DeepEqual(names, test.want) {
+				t.Errorf("policies = %v, want %v", names, test.want)
+			}
+
+			if calls := backend.Calls("ListPolicies"); calls != 3 {
+				t.Errorf("ListPolicies calls = %d, want 3", calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package resources
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cnopslabs/oshiv/internal/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+// SOCKS5 protocol constants (RFC 1928)
+const (
+	socksVersion          = 0x05
+	socksMethodNoAuth     = 0x00
+	socksMethodNoneMatch  = 0xff
+	socksCmdConnect       = 0x01
+	socksAddrIPv4         = 0x01
+	socksAddrDomain       = 0x03
+	socksAddrIPv6         = 0x04
+	socksReplySucceeded   = 0x00
+	socksReplyFailure     = 0x01
+	socksReplyUnreachable = 0x04
+	socksReplyCmdNotSupp  = 0x07
+	socksReplyAddrNotSupp = 0x08
+)
+
+// An SSH connection to the bastion for one bastion session
+// Connections waiting on the same session block on ready until it is active
+type bastionTunnel struct {
+	ready  chan struct{}
+	client *ssh.Client
+	err    error
+}
+
+// Creates (and caches) the bastion sessions and SSH connections used to reach proxy destinations
+// With a dynamic port forwarding session every destination shares one tunnel, otherwise each host:port gets its own port forwarding session
+type bastionTunnels struct {
+	bastionClient BastionClient
+	bastionId     string
+	sshKey        *SshKeyPair
+	sessionTtl    int
+	dynamic       bool
+
+	mu      sync.Mutex
+	tunnels map[string]*bastionTunnel
+}
+
+// Return the SSH connection for a destination, creating the bastion session on first use
+// Returns early with ctx's error if ctx is cancelled while the session is being created
+func (t *bastionTunnels) get(ctx context.Context, host string, port int) (*ssh.Client, error) {
+	key := "dynamic"
+	if !t.dynamic {
+		key = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+
+	t.mu.Lock()
+	tunnel, exists := t.tunnels[key]
+	if !exists {
+		tunnel = &bastionTunnel{ready: make(chan struct{})}
+		t.tunnels[key] = tunnel
+		go t.open(ctx, key, tunnel, host, port)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-tunnel.ready:
+		return tunnel.client, tunnel.err
+	}
+}
+
+// Create (or reuse) a bastion session for the tunnel, wait until it is active, and connect to the bastion
+// ctx is the proxy's lifetime, not the requesting connection's, other connections may be waiting on the same tunnel
+func (t *bastionTunnels) open(ctx context.Context, key string, tunnel *bastionTunnel, host string, port int) {
+	defer close(tunnel.ready)
+
+	sessionId, err := t.activeSession(ctx, host, port)
+	if err == nil {
+		var signer ssh.Signer
+		signer, err = t.sshKey.Signer()
+		if err == nil {
+			tunnel.client, err = dialBastion(t.bastionClient, *sessionId, signer)
+		}
+	}
+
+	// The proxy stopped while connecting, close() may already have run
+	if err == nil && ctx.Err() != nil {
+		tunnel.client.Close()
+		tunnel.client, err = nil, ctx.Err()
+	}
+
+	// Keep one failed destination from stopping the proxy, the next request for it retries
+	if err != nil {
+		tunnel.err = fmt.Errorf("unable to open bastion session for %s: %w", key, err)
+		t.forget(key, tunnel)
+		return
+	}
+
+	utils.Logger.Info("Bastion session ready", "target", key, "session", *sessionId)
+
+	// Drop the cached tunnel when the bastion closes the connection (E.g. session TTL expired), the next request creates a new session
+	go func() {
+		tunnel.client.Wait()
+		utils.Logger.Info("Bastion session closed", "target", key, "session", *sessionId)
+		t.forget(key, tunnel)
+	}()
+}
+
+// Create (or reuse) the bastion session for a destination and wait until it is active
+func (t *bastionTunnels) activeSession(ctx context.Context, host string, port int) (*string, error) {
+	var sessionId *string
+	var err error
+
+	if t.dynamic {
+		sessionId, err = CreateBastionSession(ctx, t.bastionClient, t.bastionId, "dynamic-port-forward", t.sshKey.PublicKey, "", 22, 0, t.sessionTtl, "", "")
+	} else {
+		if !t.sshKey.Ephemeral {
+			sessionId, err = FindReusableSession(t.bastionClient, t.bastionId, "port-forward", t.sshKey.PublicKey, host, 22, port, "", 900)
+		}
+
+		if err == nil && sessionId == nil {
+			sessionId, err = CreateBastionSession(ctx, t.bastionClient, t.bastionId, "port-forward", t.sshKey.PublicKey, host, 22, port, t.sessionTtl, "", "")
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sessionId, WaitForActiveSession(ctx, t.bastionClient, sessionId)
+}
+
+// Remove a tunnel from the cache if it is still the current tunnel for key
+func (t *bastionTunnels) forget(key string, tunnel *bastionTunnel) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.tunnels[key] == tunnel {
+		delete(t.tunnels, key)
+	}
+}
+
+// Close all bastion connections
+func (t *bastionTunnels) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, tunnel := range t.tunnels {
+		select {
+		case <-tunnel.ready:
+			if tunnel.client != nil {
+				tunnel.client.Close()
+			}
+		default:
+		}
+	}
+}
+
+// Run a local SOCKS5 server that tunnels each requested destination through the bastion
+// Uses a single dynamic port forwarding session if dynamic is true, otherwise a port forwarding session per destination
+// Runs until interrupted (Ctrl-C)
+func RunSocksProxy(bastionClient BastionClient, bastionId string, sshKey *SshKeyPair, sessionTtl int, socksPort int, dynamic bool) error {
+	// Load the private key up front, a passphrase prompt can't happen from a connection goroutine
+	_, err := sshKey.Signer()
+	if err != nil {
+		return err
+	}
+
+	tunnels := &bastionTunnels{
+		bastionClient: bastionClient,
+		bastionId:     bastionId,
+		sshKey:        sshKey,
+		sessionTtl:    sessionTtl,
+		dynamic:       dynamic,
+		tunnels:       make(map[string]*bastionTunnel),
+	}
+	defer tunnels.close()
+
+	listenAddress := net.JoinHostPort("localhost", strconv.Itoa(socksPort))
+	listener, err := net.Listen("tcp", listenAddress)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %w", listenAddress, err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Restore the default signal handling once shutdown starts, a second Ctrl-C terminates the process
+	go func() {
+		<-ctx.Done()
+		stop()
+		listener.Close()
+	}()
+
+	// Without the bastion's DNS proxy only IP destinations can be reached
+	mode := "one port forwarding session per destination, IP destinations only"
+	example := "curl --socks5 " + listenAddress + " http://10.0.0.5:3000"
+	if dynamic {
+		mode = "dynamic port forwarding session"
+		example = "curl --socks5-hostname " + listenAddress + " http://10.0.0.5:3000"
+	}
+	utils.Yellow.Println("\nSOCKS5 proxy listening on " + listenAddress + " (" + mode + ", Ctrl-C to stop)")
+	fmt.Println("Example: " + example)
+
+	err = serveConnections(ctx, listener, func(clientConn net.Conn) {
+		handleSocksConnection(ctx, clientConn, tunnels)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to accept connections on %s: %w", listenAddress, err)
+	}
+
+	fmt.Println("\nSOCKS5 proxy stopped")
+
+	return nil
+}
+
+// Serve a single SOCKS5 client: negotiate, read the CONNECT request, then pipe to the destination via the bastion
+func handleSocksConnection(ctx context.Context, clientConn net.Conn, tunnels *bastionTunnels) {
+	defer clientConn.Close()
+
+	clientAddress := clientConn.RemoteAddr().String()
+
+	// Handshakes should be quick, bastion session creation happens after this
+	clientConn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	host, port, err := readSocksRequest(clientConn)
+	if err != nil {
+		utils.Logger.Debug("SOCKS handshake failed: " + err.Error())
+		return
+	}
+
+	clientConn.SetDeadline(time.Time{})
+	targetAddress := net.JoinHostPort(host, strconv.Itoa(port))
+
+	// Port forwarding sessions can only resolve hostnames through the bastion's DNS proxy, which per destination sessions are used without
+	if !tunnels.dynamic && net.ParseIP(host) == nil {
+		utils.Logger.Error("Hostnames require a bastion with DNS proxy enabled, connect by IP", "client", clientAddress, "target", targetAddress)
+		writeSocksReply(clientConn, socksReplyAddrNotSupp)
+		return
+	}
+	opened := time.Now()
+
+	bastionConn, err := tunnels.get(ctx, host, port)
+	if err != nil {
+		utils.Logger.Error("Failed to reach bastion", "client", clientAddress, "target", targetAddress, "error", err)
+		writeSocksReply(clientConn, socksReplyFailure)
+		return
+	}
+
+	remoteConn, err := bastionConn.Dial("tcp", targetAddress)
+	if err != nil {
+		utils.Logger.Error("Failed to open connection via bastion", "client", clientAddress, "target", targetAddress, "error", err)
+		writeSocksReply(clientConn, socksReplyUnreachable)
+		return
+	}
+	defer remoteConn.Close()
+
+	err = writeSocksReply(clientConn, socksReplySucceeded)
+	if err != nil {
+		return
+	}
+
+	utils.Logger.Info("Connection opened", "client", clientAddress, "target", targetAddress)
+
+	bytesSent, bytesReceived := pipeConnections(clientConn, remoteConn)
+
+	utils.Logger.Info("Connection closed", "client", clientAddress, "target", targetAddress, "sent", bytesSent, "received", bytesReceived, "duration", time.Since(opened).Round(time.Millisecond).String())
+}
+
+// Read the SOCKS5 method negotiation and CONNECT request, returns the requested destination
+// Only "no authentication" and CONNECT are supported, the proxy only listens on localhost
+func readSocksRequest(conn net.Conn) (string, int, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return "", 0, err
+	}
+
+	if header[0] != socksVersion {
+		return "", 0, errors.New("unsupported SOCKS version " + strconv.Itoa(int(header[0])))
+	}
+
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", 0, err
+	}
+
+	noAuth := false
+	for _, method := range methods {
+		if method == socksMethodNoAuth {
+			noAuth = true
+		}
+	}
+
+	if !noAuth {
+		conn.Write([]byte{socksVersion, socksMethodNoneMatch})
+		return "", 0, errors.New("client does not support SOCKS no authentication method")
+	}
+
+	if _, err := conn.Write([]byte{socksVersion, socksMethodNoAuth}); err != nil {
+		return "", 0, err
+	}
+
+	// Request: VER CMD RSV ATYP DST.ADDR DST.PORT
+	request := make([]byte, 4)
+	if _, err := io.ReadFull(conn, request); err != nil {
+		return "", 0, err
+	}
+
+	if request[1] != socksCmdConnect {
+		writeSocksReply(conn, socksReplyCmdNotSupp)
+		return "", 0, errors.New("unsupported SOCKS command " + strconv.Itoa(int(request[1])))
+	}
+
+	var host string
+	switch request[3] {
+	case socksAddrIPv4, socksAddrIPv6:
+		addressLength := net.IPv4len
+		if request[3] == socksAddrIPv6 {
+			addressLength = net.IPv6len
+		}
+
+		address := make([]byte, addressLength)
+		if _, err := io.ReadFull(conn, address); err != nil {
+			return "", 0, err
+		}
+		host = net.IP(address).String()
+	case socksAddrDomain:
+		domainLength := make([]byte, 1)
+		if _, err := io.ReadFull(conn, domainLength); err != nil {
+			return "", 0, err
+		}
+
+		domain := make([]byte, domainLength[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", 0, err
+		}
+		host = string(domain)
+	default:
+		writeSocksReply(conn, socksReplyAddrNotSupp)
+		return "", 0, errors.New("unsupported SOCKS address type " + strconv.Itoa(int(request[3])))
+	}
+
+	portBytes := make([]byte, 2)
+	if _, err := io.ReadFull(conn, portBytes); err != nil {
+		return "", 0, err
+	}
+
+	return host, int(binary.BigEndian.Uint16(portBytes)), nil
+}
+
+// Write a SOCKS5 reply, the bound address is not meaningful for a tunnel so it is always 0.0.0.0:0
+func writeSocksReply(conn net.Conn, reply byte) error {
+	_, err := conn.Write([]byte{socksVersion, reply, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
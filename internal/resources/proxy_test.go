@@ -0,0 +1,75 @@
+package resources
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cnopslabs/oshiv/internal/fake"
+	"github.com/oracle/oci-go-sdk/v65/bastion"
+)
+
+func TestSocksPerTargetRejectsHostnames(t *testing.T) {
+	backend := newBackend(t, 0)
+	tunnels := &bastionTunnels{bastionClient: backend, tunnels: make(map[string]*bastionTunnel)}
+
+	clientConn, proxyConn := net.Pipe()
+	defer clientConn.Close()
+
+	go handleSocksConnection(context.Background(), proxyConn, tunnels)
+
+	// Negotiate no authentication, then CONNECT db.internal:5432
+	request := []byte{socksVersion, 1, socksMethodNoAuth}
+	request = append(request, socksVersion, socksCmdConnect, 0x00, socksAddrDomain, byte(len("db.internal")))
+	request = append(request, "db.internal"...)
+	request = append(request, 0x15, 0x38)
+
+	go clientConn.Write(request)
+
+	reply := make([]byte, 12)
+	if _, err := io.ReadFull(clientConn, reply); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{socksVersion, socksMethodNoAuth, socksVersion, socksReplyAddrNotSupp}
+	if !bytes.Equal(reply[:4], want) {
+		t.Errorf("reply = %v, want %v", reply[:4], want)
+	}
+
+	// No bastion session is created for a destination that can't be reached
+	if calls := backend.Calls("CreateSession"); calls != 0 {
+		t.Errorf("CreateSession calls = %d, want 0", calls)
+	}
+}
+
+func TestBastionTunnelsGetCancelled(t *testing.T) {
+	backend := newBackend(t, 0)
+
+	// Sessions never become active
+	backend.SessionState = bastion.SessionLifecycleStateCreating
+
+	tunnels := &bastionTunnels{
+		bastionClient: backend,
+		bastionId:     fake.BastionId,
+		sshKey:        &SshKeyPair{PublicKey: testPublicKey, Ephemeral: true},
+		sessionTtl:    3600,
+		tunnels:       make(map[string]*bastionTunnel),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := tunnels.get(ctx, "10.0.1.10", 22)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want context canceled", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %s, want it to return once cancelled", elapsed)
+	}
+}
@@ -0,0 +1,39 @@
+package resources
+
+import (
+	"os"
+	"testing"
+
+	"github.com/cnopslabs/oshiv/internal/fake"
+	"github.com/spf13/viper"
+)
+
+// The fake backend implements all client interfaces
+var (
+	_ ComputeClient         = (*fake.Backend)(nil)
+	_ VirtualNetworkClient  = (*fake.Backend)(nil)
+	_ IdentityClient        = (*fake.Backend)(nil)
+	_ ContainerEngineClient = (*fake.Backend)(nil)
+	_ DatabaseClient        = (*fake.Backend)(nil)
+	_ BastionClient         = (*fake.Backend)(nil)
+)
+
+func TestMain(m *testing.M) {
+	// Responses are never cached in tests, every test starts from its own backend
+	viper.Set("no-cache", true)
+
+	os.Exit(m.Run())
+}
+
+// Create a fake backend serving the default fixture, paginated by pageSize items (zero for a single page)
+func newBackend(t *testing.T, pageSize int) *fake.Backend {
+	t.Helper()
+
+	backend, err := fake.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.PageSize = pageSize
+
+	return backend
+}
@@ -0,0 +1,53 @@
+package resources
+
+import (
+	"fmt"
+
+	"github.com/cnopslabs/oshiv/internal/utils"
+)
+
+// Region and compartment columns shown when results span regions (--all-regions) or compartments (--recursive)
+type Scope struct {
+	ShowRegion      bool
+	ShowCompartment bool
+}
+
+// Prepend the region and compartment columns to table, wide, and csv columns
+func (scope Scope) columns(columns []utils.Column) []utils.Column {
+	var scopeColumns []utils.Column
+
+	if scope.ShowRegion {
+		scopeColumns = append(scopeColumns, utils.Column{Header: "Region"})
+	}
+	if scope.ShowCompartment {
+		scopeColumns = append(scopeColumns, utils.Column{Header: "Compartment"})
+	}
+
+	return append(scopeColumns, columns...)
+}
+
+// Prepend the region and compartment values to a row
+func (scope Scope) row(region string, compartment string, row []string) []string {
+	var scopeRow []string
+
+	if scope.ShowRegion {
+		scopeRow = append(scopeRow, region)
+	}
+	if scope.ShowCompartment {
+		scopeRow = append(scopeRow, compartment)
+	}
+
+	return append(scopeRow, row...)
+}
+
+// Print the region and compartment of a result in detailed text output
+func (scope Scope) print(region string, compartment string) {
+	if scope.ShowRegion {
+		fmt.Print("Region: ")
+		utils.Yellow.Println(region)
+	}
+	if scope.ShowCompartment {
+		fmt.Print("Compartment: ")
+		utils.Yellow.Println(compartment)
+	}
+}
@@ -0,0 +1,357 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cnopslabs/oshiv/internal/utils"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// Determine the bastion SSH host (host.bastion.REGION.oci.oraclecloud.com) from the bastion API endpoint
+func bastionSshHost(bastionClient BastionClient) (string, error) {
+	bastionEndpointUrl, err := url.Parse(bastionClient.Endpoint())
+	if err != nil {
+		return "", fmt.Errorf("unable to parse bastion endpoint: %w", err)
+	}
+
+	return "host." + bastionEndpointUrl.Host, nil
+}
+
+// Read SSH private key (identity file) and return a signer, prompting for a passphrase if required
+func loadSshSigner(sshIdentityFile string) (ssh.Signer, error) {
+	keyContent, err := os.ReadFile(sshIdentityFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read SSH private key: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(keyContent)
+
+	var passphraseErr *ssh.PassphraseMissingError
+	if errors.As(err, &passphraseErr) {
+		fmt.Print("Enter passphrase for " + sshIdentityFile + ": ")
+		passphrase, readErr := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println("")
+		if readErr != nil {
+			return nil, fmt.Errorf("unable to read passphrase: %w", readErr)
+		}
+
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(keyContent, passphrase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse SSH private key %s: %w", sshIdentityFile, err)
+	}
+
+	return signer, nil
+}
+
+// Open an SSH connection to the bastion host, authenticating as the bastion session
+func dialBastion(bastionClient BastionClient, sessionId string, signer ssh.Signer) (*ssh.Client, error) {
+	bastionHost, err := bastionSshHost(bastionClient)
+	if err != nil {
+		return nil, err
+	}
+
+	bastionAddress := net.JoinHostPort(bastionHost, "22")
+	utils.Logger.Debug("Dialing bastion: " + sessionId + "@" + bastionAddress)
+
+	// Bastion host keys are not published ahead of time, this mirrors StrictHostKeyChecking=no in the printed commands
+	config := &ssh.ClientConfig{
+		User:            sessionId,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         30 * time.Second,
+	}
+
+	client, err := ssh.Dial("tcp", bastionAddress, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to bastion %s: %w", bastionAddress, err)
+	}
+
+	return client, nil
+}
+
+// Connect to an instance through a managed SSH bastion session and attach an interactive shell
+// Returns the exit status of the remote shell
+func ConnectManagedSsh(bastionClient BastionClient, sessionId *string, instanceIp string, sshUser string, sshPort int, sshKey *SshKeyPair) (int, error) {
+	signer, err := sshKey.Signer()
+	if err != nil {
+		return 0, err
+	}
+
+	bastionConn, err := dialBastion(bastionClient, *sessionId, signer)
+	if err != nil {
+		return 0, err
+	}
+	defer bastionConn.Close()
+
+	// Jump from the bastion to the target instance (equivalent to ssh -W %h:%p)
+	targetAddress := net.JoinHostPort(instanceIp, strconv.Itoa(sshPort))
+	utils.Logger.Debug("Dialing target via bastion: " + targetAddress)
+
+	targetConn, err := bastionConn.Dial("tcp", targetAddress)
+	if err != nil {
+		return 0, fmt.Errorf("unable to connect to %s via bastion: %w", targetAddress, err)
+	}
+
+	targetConfig := &ssh.ClientConfig{
+		User:            sshUser,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         30 * time.Second,
+	}
+
+	clientConn, channels, requests, err := ssh.NewClientConn(targetConn, targetAddress, targetConfig)
+	if err != nil {
+		return 0, fmt.Errorf("unable to authenticate to %s@%s: %w", sshUser, targetAddress, err)
+	}
+
+	targetClient := ssh.NewClient(clientConn, channels, requests)
+	defer targetClient.Close()
+
+	utils.Yellow.Println("\nConnected to " + sshUser + "@" + instanceIp)
+
+	return runInteractiveShell(targetClient)
+}
+
+// Attach local stdin/stdout/stderr to a remote shell, requesting a PTY when running in a terminal
+func runInteractiveShell(client *ssh.Client) (int, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return 0, fmt.Errorf("unable to open SSH session: %w", err)
+	}
+	defer session.Close()
+
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			return 0, err
+		}
+		defer term.Restore(fd, oldState)
+
+		width, height, err := term.GetSize(fd)
+		if err != nil {
+			width, height = 80, 24
+		}
+
+		termType := os.Getenv("TERM")
+		if termType == "" {
+			termType = "xterm-256color"
+		}
+
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+
+		err = session.RequestPty(termType, height, width, modes)
+		if err != nil {
+			return 0, fmt.Errorf("unable to request PTY: %w", err)
+		}
+
+		stopWatching := watchWindowSize(fd, session)
+		defer stopWatching()
+	}
+
+	err = session.Shell()
+	if err != nil {
+		return 0, fmt.Errorf("unable to start remote shell: %w", err)
+	}
+
+	err = session.Wait()
+	if err != nil {
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitStatus(), nil
+		}
+
+		// The connection dropped without an exit status (E.g. session TTL expired)
+		utils.Logger.Debug("SSH session ended: " + err.Error())
+		return 1, nil
+	}
+
+	return 0, nil
+}
+
+// Forward connections from a local port to targetIp:hostFwPort through a port forwarding bastion session
+// Equivalent to ssh -N -L localFwPort:targetIp:hostFwPort, runs until interrupted (Ctrl-C)
+func ForwardPort(bastionClient BastionClient, sessionId *string, targetIp string, localFwPort int, hostFwPort int, sshKey *SshKeyPair) error {
+	signer, err := sshKey.Signer()
+	if err != nil {
+		return err
+	}
+
+	bastionConn, err := dialBastion(bastionClient, *sessionId, signer)
+	if err != nil {
+		return err
+	}
+	defer bastionConn.Close()
+
+	localAddress := net.JoinHostPort("localhost", strconv.Itoa(localFwPort))
+	targetAddress := net.JoinHostPort(targetIp, strconv.Itoa(hostFwPort))
+
+	listener, err := net.Listen("tcp", localAddress)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %w", localAddress, err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Stop accepting connections on Ctrl-C or if the bastion drops the SSH connection (E.g. session TTL expired)
+	go func() {
+		bastionConn.Wait()
+		stop()
+	}()
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	utils.Yellow.Println("\nForwarding " + localAddress + " -> " + targetAddress + " (Ctrl-C to stop)")
+
+	err = serveConnections(ctx, listener, func(localConn net.Conn) {
+		forwardConnection(bastionConn, localConn, targetAddress)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to accept connections on %s: %w", localAddress, err)
+	}
+
+	fmt.Println("\nPort forwarding stopped")
+
+	return nil
+}
+
+// Longest wait before accepting again after a temporary accept error
+const maxAcceptBackoff = time.Second
+
+// Accept connections and serve each in its own goroutine until ctx is done (the listener must be closed then)
+// Temporary accept errors (E.g. too many open files) are retried with a backoff, other errors are returned
+// Connections still open on return are closed, serve must return once its connection is closed
+func serveConnections(ctx context.Context, listener net.Listener, serve func(conn net.Conn)) error {
+	var mutex sync.Mutex
+	activeConnections := make(map[net.Conn]struct{})
+	var wg sync.WaitGroup
+
+	var acceptErr error
+	var backoff time.Duration
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+
+			if !isTemporaryAcceptError(err) {
+				acceptErr = err
+				break
+			}
+
+			backoff = min(max(2*backoff, 5*time.Millisecond), maxAcceptBackoff)
+			utils.Logger.Error("Failed to accept connection, retrying", "error", err, "retry_in", backoff.String())
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+
+		// Registered under the shutdown lock before serving, every accepted connection is closed below or by serve
+		mutex.Lock()
+		activeConnections[conn] = struct{}{}
+		wg.Add(1)
+		mutex.Unlock()
+
+		go func() {
+			defer wg.Done()
+			defer func() {
+				mutex.Lock()
+				delete(activeConnections, conn)
+				mutex.Unlock()
+			}()
+
+			serve(conn)
+		}()
+	}
+
+	// Close any connections still open so their copy loops return
+	mutex.Lock()
+	for conn := range activeConnections {
+		conn.Close()
+	}
+	mutex.Unlock()
+	wg.Wait()
+
+	return acceptErr
+}
+
+// Accept errors that go away once connections are closed or the client retries
+func isTemporaryAcceptError(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) || errors.Is(err, syscall.ENOBUFS) || errors.Is(err, syscall.ECONNABORTED)
+}
+
+// Pipe a single local connection to the target address via the bastion SSH connection
+func forwardConnection(bastionConn *ssh.Client, localConn net.Conn, targetAddress string) {
+	defer localConn.Close()
+
+	clientAddress := localConn.RemoteAddr().String()
+	opened := time.Now()
+
+	remoteConn, err := bastionConn.Dial("tcp", targetAddress)
+	if err != nil {
+		utils.Logger.Error("Failed to open connection via bastion", "client", clientAddress, "target", targetAddress, "error", err)
+		return
+	}
+	defer remoteConn.Close()
+
+	utils.Logger.Info("Connection opened", "client", clientAddress, "target", targetAddress)
+
+	bytesSent, bytesReceived := pipeConnections(localConn, remoteConn)
+
+	utils.Logger.Info("Connection closed", "client", clientAddress, "target", targetAddress, "sent", bytesSent, "received", bytesReceived, "duration", time.Since(opened).Round(time.Millisecond).String())
+}
+
+// Copy data in both directions until either side closes, returns bytes sent (local to remote) and received
+func pipeConnections(localConn net.Conn, remoteConn net.Conn) (int64, int64) {
+	var bytesSent, bytesReceived int64
+	done := make(chan struct{}, 2)
+
+	go func() {
+		bytesSent, _ = io.Copy(remoteConn, localConn)
+		done <- struct{}{}
+	}()
+
+	go func() {
+		bytesReceived, _ = io.Copy(localConn, remoteConn)
+		done <- struct{}{}
+	}()
+
+	// When either side finishes, close both so the other copy returns
+	<-done
+	localConn.Close()
+	remoteConn.Close()
+	<-done
+
+	return bytesSent, bytesReceived
+}
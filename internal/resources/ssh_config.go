@@ -0,0 +1,264 @@
+package resources
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cnopslabs/oshiv/internal/utils"
+	"github.com/oracle/oci-go-sdk/v65/bastion"
+)
+
+// A Host block in the generated ssh_config include file
+type sshConfigHost struct {
+	alias       string
+	hostname    string
+	port        int
+	user        string
+	instanceId  string
+	sessionId   string
+	sessionName string
+	bastionHost string
+	expires     time.Time
+}
+
+var unsafeHostAliasChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Collect one Host entry per ACTIVE oshiv managed SSH session across the given bastions (OCI API call)
+// Only sessions created with the given public key are included (if any), the identity file can't connect to the others
+// If several sessions target the same instance, the one that expires last wins
+// Instances sharing a display name get the end of their OCID appended to the alias (E.g. web-1-abc123)
+func fetchSshConfigHosts(bastionClient BastionClient, bastions []Bastion, publicKeyContent string) ([]sshConfigHost, error) {
+	hostsByTarget := make(map[string]sshConfigHost)
+	fingerprint := publicKeyFingerprint(publicKeyContent)
+
+	bastionHost, err := bastionSshHost(bastionClient)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, b := range bastions {
+		sessions, err := fetchSessions(bastionClient, b.Id, bastion.ListSessionsSessionLifecycleStateActive)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, session := range sessions {
+			if session.DisplayName == nil || !strings.HasPrefix(*session.DisplayName, "oshiv-") {
+				continue
+			}
+
+			details, ok := session.TargetResourceDetails.(bastion.ManagedSshSessionTargetResourceDetails)
+			if !ok || details.TargetResourcePrivateIpAddress == nil {
+				continue
+			}
+
+			expires, ok := sessionExpiry(session)
+			if !ok {
+				continue
+			}
+
+			if fingerprint != "" {
+				sessionFingerprint, err := sessionKeyFingerprint(bastionClient, session.Id)
+				if err != nil {
+					return nil, err
+				}
+
+				if sessionFingerprint != fingerprint {
+					continue
+				}
+			}
+
+			alias := *details.TargetResourcePrivateIpAddress
+			if details.TargetResourceDisplayName != nil && *details.TargetResourceDisplayName != "" {
+				alias = unsafeHostAliasChars.ReplaceAllString(*details.TargetResourceDisplayName, "-")
+			}
+
+			host := sshConfigHost{
+				alias:       alias,
+				hostname:    *details.TargetResourcePrivateIpAddress,
+				port:        22,
+				user:        "opc",
+				sessionId:   *session.Id,
+				sessionName: *session.DisplayName,
+				bastionHost: bastionHost,
+				expires:     expires,
+			}
+
+			if details.TargetResourcePort != nil {
+				host.port = *details.TargetResourcePort
+			}
+
+			if details.TargetResourceOperatingSystemUserName != nil {
+				host.user = *details.TargetResourceOperatingSystemUserName
+			}
+
+			if details.TargetResourceId != nil {
+				host.instanceId = *details.TargetResourceId
+			}
+
+			target := host.instanceId
+			if target == "" {
+				target = host.hostname
+			}
+
+			existing, exists := hostsByTarget[target]
+			if !exists || host.expires.After(existing.expires) {
+				hostsByTarget[target] = host
+			}
+		}
+	}
+
+	targetsByAlias := make(map[string]int)
+	for _, host := range hostsByTarget {
+		targetsByAlias[host.alias]++
+	}
+
+	hosts := make([]sshConfigHost, 0, len(hostsByTarget))
+	for target, host := range hostsByTarget {
+		if targetsByAlias[host.alias] > 1 {
+			host.alias += "-" + aliasSuffix(target)
+		}
+		hosts = append(hosts, host)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].alias < hosts[j].alias })
+
+	return hosts, nil
+}
+
+// Return the end of an instance OCID (or the IP) to tell apart hosts sharing an alias
+func aliasSuffix(target string) string {
+	if strings.HasPrefix(target, "ocid1.") {
+		target = target[strings.LastIndex(target, ".")+1:]
+	}
+
+	suffix := strings.ReplaceAll(unsafeHostAliasChars.ReplaceAllString(target, "-"), ".", "-")
+	if len(suffix) > 6 {
+		suffix = suffix[len(suffix)-6:]
+	}
+
+	return suffix
+}
+
+// Render the ssh_config include file
+func renderSshConfig(hosts []sshConfigHost, sshIdentityFile string) string {
+	var sb strings.Builder
+
+	sb.WriteString("# Managed by oshiv (oshiv bastion ssh-config), do not edit. Regenerated on every run.\n")
+	sb.WriteString("# Generated: " + time.Now().Format(time.RFC3339) + "\n")
+
+	for _, host := range hosts {
+		hostKeyAlias := host.instanceId
+		if hostKeyAlias == "" {
+			hostKeyAlias = host.hostname
+		}
+
+		sb.WriteString("\n# " + host.sessionName + " expires " + host.expires.Local().Format(time.RFC3339) + "\n")
+		sb.WriteString("Host " + host.alias + "\n")
+		sb.WriteString("    HostName " + host.hostname + "\n")
+		sb.WriteString("    Port " + strconv.Itoa(host.port) + "\n")
+		sb.WriteString("    User " + host.user + "\n")
+		sb.WriteString("    IdentityFile \"" + sshIdentityFile + "\"\n")
+		sb.WriteString("    IdentitiesOnly yes\n")
+		sb.WriteString("    HostKeyAlias " + hostKeyAlias + "\n")
+		sb.WriteString("    ProxyCommand ssh -i \"" + sshIdentityFile + "\" -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -W %h:%p " + host.sessionId + "@" + host.bastionHost + "\n")
+	}
+
+	return sb.String()
+}
+
+// Atomically replace the file at path with content (write temp file in the same dir, then rename)
+func writeFileAtomic(path string, content string) error {
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := os.CreateTemp(dir, ".oshiv-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.WriteString(content)
+	if err != nil {
+		tempFile.Close()
+		return err
+	}
+
+	err = tempFile.Chmod(0600)
+	if err != nil {
+		tempFile.Close()
+		return err
+	}
+
+	err = tempFile.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tempFile.Name(), path)
+}
+
+// Generate an ssh_config include file with a Host block (via ProxyCommand) for each active oshiv session
+// Expired sessions drop out because the whole file is regenerated
+func WriteSshConfig(bastionClient BastionClient, bastions []Bastion, sshIdentityFile string, publicKeyContent string, configPath string) error {
+	hosts, err := fetchSshConfigHosts(bastionClient, bastions, publicKeyContent)
+	if err != nil {
+		return err
+	}
+
+	err = writeFileAtomic(configPath, renderSshConfig(hosts, sshIdentityFile))
+	if err != nil {
+		return fmt.Errorf("unable to write %s: %w", configPath, err)
+	}
+
+	utils.Faint.Println(strconv.Itoa(len(hosts)) + " host(s) written to " + configPath)
+
+	for _, host := range hosts {
+		fmt.Print("ssh ")
+		utils.Yellow.Print(host.alias)
+		utils.Faint.Println("  (" + host.user + "@" + host.hostname + ", expires " + host.expires.Local().Format(time.Kitchen) + ")")
+	}
+
+	// The include file does nothing unless the main ssh config includes it
+	includePath, err := filepath.Abs(configPath)
+	if err != nil {
+		return err
+	}
+
+	sshConfigPath := filepath.Join(utils.HomeDir(), ".ssh", "config")
+	if !sshConfigIncludes(sshConfigPath, includePath) {
+		fmt.Print("\nAdd this line to the top of " + sshConfigPath + ": ")
+		utils.Yellow.Println("Include \"" + includePath + "\"")
+	}
+
+	return nil
+}
+
+// Check if the main ssh config already includes a file, by absolute path, or relative to its directory (E.g. config.d/oshiv or config.d/*)
+func sshConfigIncludes(sshConfigPath string, includePath string) bool {
+	mainConfig, err := os.ReadFile(sshConfigPath)
+	if err != nil {
+		return false
+	}
+
+	if strings.Contains(string(mainConfig), includePath) {
+		return true
+	}
+
+	relativePath, err := filepath.Rel(filepath.Dir(sshConfigPath), includePath)
+	if err != nil || strings.HasPrefix(relativePath, "..") {
+		return false
+	}
+
+	relativeDir := filepath.Dir(relativePath)
+
+	return strings.Contains(string(mainConfig), relativePath) || (relativeDir != "." && strings.Contains(string(mainConfig), relativeDir+"/*"))
+}
@@ -0,0 +1,123 @@
+package resources
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/cnopslabs/oshiv/internal/fake"
+	"github.com/oracle/oci-go-sdk/v65/bastion"
+	"github.com/oracle/oci-go-sdk/v65/common"
+)
+
+func TestFetchSshConfigHosts(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(session *bastion.Session)
+		want   []string // Host aliases
+	}{
+		{"active", func(session *bastion.Session) {}, []string{"web-1"}},
+		// Not returned by OCI, E.g. while the session is created or deleted
+		{"no TTL", func(session *bastion.Session) { session.SessionTtlInSeconds = nil }, nil},
+		{"no creation time", func(session *bastion.Session) { session.TimeCreated = nil }, nil},
+	}
+
+	for _, test := range tests {
+		backend := newBackend(t, 0)
+
+		// oshiv-web-1, the only managed SSH session
+		test.modify(&backend.Sessions[0])
+
+		bastions, err := FetchBastions(fake.CompartmentId, backend)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hosts, err := fetchSshConfigHosts(backend, bastions, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var aliases []string
+		for _, host := range hosts {
+			aliases = append(aliases, host.alias)
+		}
+
+		if !reflect.DeepEqual(aliases, test.want) {
+			t.Errorf("%s: hosts = %v, want %v", test.name, aliases, test.want)
+		}
+	}
+}
+
+func TestFetchSshConfigHostsSharedDisplayName(t *testing.T) {
+	backend := newBackend(t, 0)
+
+	// A session to another instance named web-1
+	session := backend.Sessions[0]
+	session.Id = common.String("ocid1.bastionsession.oc1.iad.web1copy")
+	session.TargetResourceDetails = bastion.ManagedSshSessionTargetResourceDetails{
+		TargetResourceOperatingSystemUserName: common.String("opc"),
+		TargetResourceId:                      common.String("ocid1.instance.oc1.iad.other1"),
+		TargetResourceDisplayName:             common.String("web-1"),
+		TargetResourcePrivateIpAddress:        common.String("10.0.2.10"),
+		TargetResourcePort:                    common.Int(22),
+	}
+	backend.Sessions = append(backend.Sessions, session)
+
+	bastions, err := FetchBastions(fake.CompartmentId, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts, err := fetchSshConfigHosts(backend, bastions, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]string)
+	for _, host := range hosts {
+		got[host.alias] = host.hostname
+	}
+
+	want := map[string]string{"web-1-other1": "10.0.2.10", "web-1-web1": "10.0.1.10"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts = %v, want %v", got, want)
+	}
+}
+
+func TestSshConfigIncludes(t *testing.T) {
+	dir := t.TempDir()
+	sshConfigPath := filepath.Join(dir, "config")
+	includePath := filepath.Join(dir, "config.d", "oshiv")
+
+	tests := []struct {
+		name       string
+		mainConfig string
+		want       bool
+	}{
+		{"no include", "Host *\n    ServerAliveInterval 60\n", false},
+		{"relative path", "Include config.d/oshiv\n", true},
+		{"relative wildcard", "Include config.d/*\n", true},
+		{"absolute path", "Include \"" + includePath + "\"\n", true},
+		{"other file", "Include config.d/work\n", false},
+	}
+
+	for _, test := range tests {
+		err := os.WriteFile(sshConfigPath, []byte(test.mainConfig), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := sshConfigIncludes(sshConfigPath, includePath); got != test.want {
+			t.Errorf("%s: sshConfigIncludes = %v, want %v", test.name, got, test.want)
+		}
+	}
+
+	// A file outside of the ssh config dir must be included by absolute path
+	otherPath := filepath.Join(t.TempDir(), "config.d", "oshiv")
+	os.WriteFile(sshConfigPath, []byte("Include config.d/*\n"), 0600)
+	if sshConfigIncludes(sshConfigPath, otherPath) {
+		t.Error("sshConfigIncludes = true for a file outside of the ssh config dir, want false")
+	}
+}
@@ -0,0 +1,160 @@
+package resources
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cnopslabs/oshiv/internal/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+// SSH key pair used to create and connect to bastion sessions
+// Either read from disk (id_rsa/id_rsa.pub) or generated per session (ephemeral)
+type SshKeyPair struct {
+	PublicKey      string // authorized_keys format, uploaded with the bastion session
+	PrivateKeyPath string // identity file used in printed SSH commands
+	Ephemeral      bool
+	privateKey     crypto.PrivateKey
+	signer         ssh.Signer
+	tempDir        string
+}
+
+// Read an existing SSH key pair from disk
+// The private key is only parsed when a signer is needed (native SSH client) so a passphrase isn't prompted for otherwise
+func LoadSshKeyPair(privateKeyPath string, publicKeyPath string) (*SshKeyPair, error) {
+	publicKeyContent, err := os.ReadFile(publicKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read SSH public key: %w", err)
+	}
+
+	return &SshKeyPair{
+		PublicKey:      string(publicKeyContent),
+		PrivateKeyPath: privateKeyPath,
+	}, nil
+}
+
+// Generate an in-memory SSH key pair (ed25519 or rsa) for a single bastion session
+func GenerateEphemeralSshKeyPair(keyType string) (*SshKeyPair, error) {
+	var privateKey crypto.PrivateKey
+	var publicKey crypto.PublicKey
+
+	switch keyType {
+	case "ed25519":
+		edPublicKey, edPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		privateKey, publicKey = edPrivateKey, edPublicKey
+	case "rsa":
+		rsaPrivateKey, err := rsa.GenerateKey(rand.Reader, 4096)
+		if err != nil {
+			return nil, err
+		}
+		privateKey, publicKey = rsaPrivateKey, &rsaPrivateKey.PublicKey
+	default:
+		return nil, utils.UsageError("unsupported ephemeral key type: " + keyType + " (use ed25519 or rsa)")
+	}
+
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	utils.Logger.Debug("Generated ephemeral " + keyType + " key: " + ssh.FingerprintSHA256(sshPublicKey))
+
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPublicKey))) + " oshiv-ephemeral"
+
+	return &SshKeyPair{
+		PublicKey:  authorizedKey,
+		Ephemeral:  true,
+		privateKey: privateKey,
+		signer:     signer,
+	}, nil
+}
+
+// Return a signer for the native SSH client, reading the private key from disk if necessary
+func (keyPair *SshKeyPair) Signer() (ssh.Signer, error) {
+	if keyPair.signer == nil {
+		signer, err := loadSshSigner(keyPair.PrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		keyPair.signer = signer
+	}
+
+	return keyPair.signer, nil
+}
+
+// Write an ephemeral private key to a private (0700) temp dir so it can be used by external ssh/scp commands
+func (keyPair *SshKeyPair) WriteToTempDir() (string, error) {
+	if !keyPair.Ephemeral || keyPair.PrivateKeyPath != "" {
+		return keyPair.PrivateKeyPath, nil
+	}
+
+	tempDir, err := os.MkdirTemp("", "oshiv-")
+	if err != nil {
+		return "", fmt.Errorf("unable to create temp dir for ephemeral key: %w", err)
+	}
+	keyPair.tempDir = tempDir
+
+	err = os.Chmod(tempDir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	pemBlock, err := ssh.MarshalPrivateKey(keyPair.privateKey, "oshiv-ephemeral")
+	if err != nil {
+		return "", err
+	}
+
+	privateKeyPath := filepath.Join(tempDir, "id_oshiv")
+	keyPair.PrivateKeyPath = privateKeyPath
+
+	err = os.WriteFile(privateKeyPath, pem.EncodeToMemory(pemBlock), 0600)
+	if err != nil {
+		return "", fmt.Errorf("unable to write ephemeral key: %w", err)
+	}
+
+	return privateKeyPath, nil
+}
+
+// Securely delete an ephemeral private key written to disk (overwrite, sync, remove)
+// Keys read from disk are never touched
+func (keyPair *SshKeyPair) Destroy() {
+	if !keyPair.Ephemeral || keyPair.tempDir == "" {
+		return
+	}
+
+	file, err := os.OpenFile(keyPair.PrivateKeyPath, os.O_WRONLY, 0600)
+	if err == nil {
+		info, statErr := file.Stat()
+		if statErr == nil {
+			noise := make([]byte, info.Size())
+			rand.Read(noise)
+			file.WriteAt(noise, 0)
+			file.Sync()
+		}
+		file.Close()
+	}
+
+	err = os.RemoveAll(keyPair.tempDir)
+	if err != nil {
+		utils.Logger.Error("Failed to remove ephemeral key", "path", keyPair.tempDir, "error", err)
+		return
+	}
+
+	utils.Logger.Debug("Removed ephemeral key: " + keyPair.PrivateKeyPath)
+	keyPair.tempDir = ""
+}
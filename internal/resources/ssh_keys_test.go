@@ -0,0 +1,148 @@
+package resources
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/cnopslabs/oshiv/internal/utils"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestGenerateEphemeralSshKeyPair(t *testing.T) {
+	for _, keyType := range []string{"ed25519", "rsa"} {
+		t.Run(keyType, func(t *testing.T) {
+			keyPair, err := GenerateEphemeralSshKeyPair(keyType)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !keyPair.Ephemeral {
+				t.Error("Ephemeral = false, want true")
+			}
+
+			publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(keyPair.PublicKey))
+			if err != nil {
+				t.Fatalf("unable to parse public key %q: %v", keyPair.PublicKey, err)
+			}
+
+			signer, err := keyPair.Signer()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(signer.PublicKey().Marshal(), publicKey.Marshal()) {
+				t.Error("signer public key doesn't match the public key")
+			}
+		})
+	}
+}
+
+func TestGenerateEphemeralSshKeyPairUnsupportedType(t *testing.T) {
+	_, err := GenerateEphemeralSshKeyPair("dsa")
+
+	var exitErr *utils.ExitCodeError
+	if !errors.As(err, &exitErr) || exitErr.Code != utils.ExitUsage {
+		t.Errorf("error = %v, want usage error", err)
+	}
+}
+
+func TestEphemeralSshKeyPairWriteToTempDir(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	keyPair, err := GenerateEphemeralSshKeyPair("ed25519")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keyPair.Destroy()
+
+	privateKeyPath, err := keyPair.WriteToTempDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if keyPair.PrivateKeyPath != privateKeyPath {
+		t.Errorf("PrivateKeyPath = %s, want %s", keyPair.PrivateKeyPath, privateKeyPath)
+	}
+
+	// The written key is the key the session was created with
+	signer, err := loadSshSigner(privateKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(keyPair.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(signer.PublicKey().Marshal(), publicKey.Marshal()) {
+		t.Error("written private key doesn't match the public key")
+	}
+
+	// Permissions aren't POSIX modes on Windows
+	if runtime.GOOS != "windows" {
+		dirInfo, err := os.Stat(filepath.Dir(privateKeyPath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := dirInfo.Mode().Perm(); mode != 0700 {
+			t.Errorf("temp dir mode = %o, want 700", mode)
+		}
+
+		fileInfo, err := os.Stat(privateKeyPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := fileInfo.Mode().Perm(); mode != 0600 {
+			t.Errorf("key file mode = %o, want 600", mode)
+		}
+	}
+
+	keyPair.Destroy()
+
+	if _, err := os.Stat(filepath.Dir(privateKeyPath)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("temp dir still exists after Destroy (stat error: %v)", err)
+	}
+}
+
+func TestLoadedSshKeyPairDestroy(t *testing.T) {
+	dir := t.TempDir()
+	privateKeyPath := filepath.Join(dir, "id_rsa")
+	publicKeyPath := filepath.Join(dir, "id_rsa.pub")
+
+	for _, path := range []string{privateKeyPath, publicKeyPath} {
+		if err := os.WriteFile(path, []byte(testPublicKey), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keyPair, err := LoadSshKeyPair(privateKeyPath, publicKeyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys read from disk are never written or removed
+	path, err := keyPair.WriteToTempDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != privateKeyPath {
+		t.Errorf("WriteToTempDir path = %s, want %s", path, privateKeyPath)
+	}
+
+	keyPair.Destroy()
+
+	for _, path := range []string{privateKeyPath, publicKeyPath} {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%s removed by Destroy: %v", path, err)
+		}
+		if string(content) != testPublicKey {
+			t.Errorf("%s changed by Destroy", path)
+		}
+	}
+}
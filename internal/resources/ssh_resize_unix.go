@@ -0,0 +1,38 @@
+//go:build !windows
+
+package resources
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// Forward local terminal resizes (SIGWINCH) to the remote PTY
+func watchWindowSize(fd int, session *ssh.Session) func() {
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-resized:
+				width, height, err := term.GetSize(fd)
+				if err == nil {
+					session.WindowChange(height, width)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(resized)
+		close(done)
+	}
+}
@@ -0,0 +1,37 @@
+//go:build windows
+
+package resources
+
+import (
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// Windows has no SIGWINCH, poll the console size and forward changes to the remote PTY
+func watchWindowSize(fd int, session *ssh.Session) func() {
+	done := make(chan struct{})
+	go func() {
+		lastWidth, lastHeight, _ := term.GetSize(fd)
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				width, height, err := term.GetSize(fd)
+				if err == nil && (width != lastWidth || height != lastHeight) {
+					lastWidth, lastHeight = width, height
+					session.WindowChange(height, width)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+	}
+}
@@ -0,0 +1,88 @@
+package resources
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Listener returning the scripted connections and errors in order, then blocking until closed
+type testListener struct {
+	accepts []any // net.Conn or error
+	calls   int
+	closed  chan struct{}
+}
+
+func (listener *testListener) Accept() (net.Conn, error) {
+	listener.calls++
+	if len(listener.accepts) == 0 {
+		<-listener.closed
+		return nil, net.ErrClosed
+	}
+
+	next := listener.accepts[0]
+	listener.accepts = listener.accepts[1:]
+	if err, ok := next.(error); ok {
+		return nil, err
+	}
+
+	return next.(net.Conn), nil
+}
+
+func (listener *testListener) Close() error   { close(listener.closed); return nil }
+func (listener *testListener) Addr() net.Addr { return &net.TCPAddr{} }
+
+func TestServeConnections(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	tests := []struct {
+		name      string
+		accepts   []any
+		wantErr   bool
+		wantCalls int
+	}{
+		// Returned instead of retried forever
+		{"permanent error", []any{errors.New("listener broken")}, true, 1},
+		{"temporary errors", []any{syscall.EMFILE, syscall.ECONNABORTED, serverConn}, false, 4},
+	}
+
+	for _, test := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		listener := &testListener{accepts: test.accepts, closed: make(chan struct{})}
+
+		served := make(chan struct{})
+		done := make(chan error)
+		go func() {
+			done <- serveConnections(ctx, listener, func(conn net.Conn) {
+				close(served)
+				// Blocks until the connection is closed on shutdown
+				io.Copy(io.Discard, conn)
+			})
+		}()
+
+		if !test.wantErr {
+			<-served
+			cancel()
+			listener.Close()
+		}
+
+		select {
+		case err := <-done:
+			if (err != nil) != test.wantErr {
+				t.Errorf("%s: error = %v, want error %t", test.name, err, test.wantErr)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: serveConnections didn't return", test.name)
+		}
+
+		if listener.calls != test.wantCalls {
+			t.Errorf("%s: Accept calls = %d, want %d", test.name, listener.calls, test.wantCalls)
+		}
+		cancel()
+	}
+}
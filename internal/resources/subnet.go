@@ -2,18 +2,22 @@ package resources
 
 import (
 	"context"
+	"fmt"
 	"sort"
 
 	"github.com/cnopslabs/oshiv/internal/utils"
 	"github.com/oracle/oci-go-sdk/v65/core"
-	"github.com/rodaine/table"
 )
 
 type Subnet struct {
-	cidr       string
-	name       string
-	access     string
-	subnetType string
+	Cidr        string `json:"cidr" yaml:"cidr"`
+	Name        string `json:"name" yaml:"name"`
+	Id          string `json:"id" yaml:"id"`
+	Access      string `json:"access" yaml:"access"`
+	Type        string `json:"type" yaml:"type"`
+	VcnId       string `json:"vcn_id" yaml:"vcn_id"`
+	Region      string `json:"region,omitempty" yaml:"region,omitempty"`           // Only set with --all-regions
+	Compartment string `json:"compartment,omitempty" yaml:"compartment,omitempty"` // Compartment path, only set with --recursive
 }
 
 // TODO: This sorts alphabetically, so not great for CIDR blocks. Revert to sort by name or create CIDR sort function
@@ -21,47 +25,60 @@ type Subnet struct {
 type subnetsByCidr []Subnet
 
 func (subnets subnetsByCidr) Len() int           { return len(subnets) }
-func (subnets subnetsByCidr) Less(i, j int) bool { return subnets[i].cidr < subnets[j].cidr }
+func (subnets subnetsByCidr) Less(i, j int) bool { return subnets[i].Cidr < subnets[j].Cidr }
 func (subnets subnetsByCidr) Swap(i, j int)      { subnets[i], subnets[j] = subnets[j], subnets[i] }
 
-// List and print subnets (OCI API call)
-func ListSubnets(client core.VirtualNetworkClient, compartmentId string) {
-	response, err := client.ListSubnets(context.Background(), core.ListSubnetsRequest{CompartmentId: &compartmentId})
-	utils.CheckError(err)
+// Fetch all subnets sorted by CIDR via OCI API call, cached (see utils.Cached)
+func FetchSubnets(client VirtualNetworkClient, compartmentId string) ([]Subnet, error) {
+	return utils.Cached(client.Endpoint(), compartmentId, "subnets", false, func() ([]Subnet, error) {
+		response, err := client.ListSubnets(context.Background(), core.ListSubnetsRequest{CompartmentId: &compartmentId})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list subnets: %w", err)
+		}
 
-	var Subnets []Subnet
-	var subnetAccess string
-	var subnetType string
+		var Subnets []Subnet
+		var subnetAccess string
+		var subnetType string
 
-	for _, s := range response.Items {
-		if *s.ProhibitInternetIngress && *s.ProhibitPublicIpOnVnic {
-			subnetAccess = "private"
-		} else if !*s.ProhibitInternetIngress && !*s.ProhibitPublicIpOnVnic {
-			subnetAccess = "public"
-		} else {
-			subnetAccess = "?"
-		}
+		for _, s := range response.Items {
+			if *s.ProhibitInternetIngress && *s.ProhibitPublicIpOnVnic {
+				subnetAccess = "private"
+			} else if !*s.ProhibitInternetIngress && !*s.ProhibitPublicIpOnVnic {
+				subnetAccess = "public"
+			} else {
+				subnetAccess = "?"
+			}
 
-		if s.AvailabilityDomain == nil {
-			subnetType = "Regional"
-		} else {
-			subnetType = *s.AvailabilityDomain
+			if s.AvailabilityDomain == nil {
+				subnetType = "Regional"
+			} else {
+				subnetType = *s.AvailabilityDomain
+			}
+
+			subnet := Subnet{*s.CidrBlock, *s.DisplayName, *s.Id, subnetAccess, subnetType, *s.VcnId, "", ""}
+			Subnets = append(Subnets, subnet)
 		}
 
-		subnet := Subnet{*s.CidrBlock, *s.DisplayName, subnetAccess, subnetType}
-		Subnets = append(Subnets, subnet)
-	}
+		if len(Subnets) > 0 {
+			sort.Sort(subnetsByCidr(Subnets))
+		}
 
-	if len(Subnets) > 0 {
-		sort.Sort(subnetsByCidr(Subnets))
-	}
+		return Subnets, nil
+	})
+}
 
-	tbl := table.New("CIDR", "Name", "Access", "Type")
-	tbl.WithHeaderFormatter(utils.HeaderFmt).WithFirstColumnFormatter(utils.ColumnFmt)
+// Print subnets as a table, or in the format set by --output
+// The region and compartment are included when subnets span regions (--all-regions) or compartments (--recursive)
+func PrintSubnets(subnets []Subnet, scope Scope) error {
+	columns := []utils.Column{{Header: "CIDR"}, {Header: "Name"}, {Header: "Access"}, {Header: "Type"}, {Header: "OCID", Wide: true}, {Header: "VCN OCID", Wide: true}}
+	columns = scope.columns(columns)
 
-	for _, subnet := range Subnets {
-		tbl.AddRow(subnet.cidr, subnet.name, subnet.access, subnet.subnetType)
+	var rows [][]string
+	for _, subnet := range subnets {
+		row := []string{subnet.Cidr, subnet.Name, subnet.Access, subnet.Type, subnet.Id, subnet.VcnId}
+		row = scope.row(subnet.Region, subnet.Compartment, row)
+		rows = append(rows, row)
 	}
 
-	tbl.Print()
+	return utils.PrintOutput(subnets, columns, rows)
 }
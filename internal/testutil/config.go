@@ -0,0 +1,86 @@
+package testutil
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cnopslabs/oshiv/internal/fake"
+	"golang.org/x/crypto/ssh"
+)
+
+// Write an OCI config file with a DEFAULT API key profile for the fake tenancy in us-ashburn-1 and return its path
+// The API key is generated, the emulator ignores request signatures
+func WriteOciConfig(t testing.TB, dir string) string {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// API key fingerprint, colon separated MD5 of the DER public key (like the OCI console)
+	var fingerprint []string
+	for _, b := range md5.Sum(publicKey) {
+		fingerprint = append(fingerprint, fmt.Sprintf("%02x", b))
+	}
+
+	keyPath := filepath.Join(dir, "oci_api_key.pem")
+	writeFile(t, keyPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+
+	configPath := filepath.Join(dir, "config")
+	config := "[DEFAULT]\n" +
+		"user=ocid1.user.oc1..fake\n" +
+		"fingerprint=" + strings.Join(fingerprint, ":") + "\n" +
+		"tenancy=" + fake.TenancyId + "\n" +
+		"region=us-ashburn-1\n" +
+		"key_file=" + keyPath + "\n"
+	writeFile(t, configPath, []byte(config))
+
+	return configPath
+}
+
+// Write an SSH key pair to dir/id_rsa and dir/id_rsa.pub (oshiv's default SSH key paths when dir is $HOME/.ssh)
+func WriteSshKeyPair(t testing.TB, dir string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicKey, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeFile(t, filepath.Join(dir, "id_rsa"), pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	writeFile(t, filepath.Join(dir, "id_rsa.pub"), ssh.MarshalAuthorizedKey(publicKey))
+}
+
+// Write a private file, creating its directory
+func writeFile(t testing.TB, path string, data []byte) {
+	t.Helper()
+
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,344 @@
+// Local OCI API emulator for end to end tests
+// An httptest server serving the OCI REST endpoints oshiv calls from a fake backend (internal/fake), request signing is ignored
+package testutil
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/cnopslabs/oshiv/internal/fake"
+	"github.com/oracle/oci-go-sdk/v65/bastion"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/containerengine"
+	"github.com/oracle/oci-go-sdk/v65/core"
+	"github.com/oracle/oci-go-sdk/v65/database"
+	"github.com/oracle/oci-go-sdk/v65/identity"
+)
+
+// OCI API emulator, all services are served on the same host (see oshiv --endpoint)
+type Server struct {
+	*httptest.Server
+	Backend *fake.Backend
+
+	mu       sync.Mutex
+	faults   map[string][]int
+	requests map[string]int
+}
+
+// Handle a request to an operation, return the response body and the next page token (opc-next-page header)
+type handler func(request *http.Request) (any, *string, error)
+
+// Start an OCI API emulator serving a fake backend, it is closed when the test completes
+func NewServer(t testing.TB, backend *fake.Backend) *Server {
+	server := &Server{Backend: backend, faults: make(map[string][]int), requests: make(map[string]int)}
+
+	mux := http.NewServeMux()
+	server.routes(mux)
+
+	server.Server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// Fail the next count requests of an operation (E.g. "ListInstances") with an HTTP status code (E.g. 429 or 500)
+// Requests after that are served normally
+func (server *Server) Fault(operation string, statusCode int, count int) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	for i := 0; i < count; i++ {
+		server.faults[operation] = append(server.faults[operation], statusCode)
+	}
+}
+
+// Return the number of requests received for an operation, including failed requests
+func (server *Server) Requests(operation string) int {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	return server.requests[operation]
+}
+
+// Record a request and return the status code of the fault to fail it with, zero if it isn't failed
+func (server *Server) nextFault(operation string) int {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	server.requests[operation]++
+
+	faults := server.faults[operation]
+	if len(faults) == 0 {
+		return 0
+	}
+	server.faults[operation] = faults[1:]
+
+	return faults[0]
+}
+
+// Register an operation's handler on a method and path pattern (E.g. "GET /20160918/instances")
+func (server *Server) handle(mux *http.ServeMux, pattern string, operation string, handle handler) {
+	mux.HandleFunc(pattern, func(w http.ResponseWriter, request *http.Request) {
+		w.Header().Set("opc-request-id", operation+"-"+strconv.Itoa(server.Requests(operation)+1))
+
+		if statusCode := server.nextFault(operation); statusCode != 0 {
+			writeError(w, fake.ServiceError{StatusCode: statusCode, Code: faultCode(statusCode), Message: "injected fault"})
+			return
+		}
+
+		body, nextPage, err := handle(request)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		if nextPage != nil {
+			w.Header().Set("opc-next-page", *nextPage)
+		}
+
+		if body == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		// Empty lists are [] like OCI, the SDK is unable to unmarshal null lists of polymorphic items (E.g. sessions)
+		if value := reflect.ValueOf(body); value.Kind() == reflect.Slice && value.IsNil() {
+			body = []any{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	})
+}
+
+// Write an OCI error response, the status code of fake service errors, 500 otherwise
+func writeError(w http.ResponseWriter, err error) {
+	serviceErr := fake.ServiceError{StatusCode: http.StatusInternalServerError, Code: "InternalServerError", Message: err.Error()}
+	errors.As(err, &serviceErr)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(serviceErr.StatusCode)
+	json.NewEncoder(w).Encode(map[string]string{"code": serviceErr.Code, "message": serviceErr.Message})
+}
+
+// Return the OCI error code of an injected fault's status code
+func faultCode(statusCode int) string {
+	switch statusCode {
+	case http.StatusUnauthorized:
+		return "NotAuthenticated"
+	case http.StatusTooManyRequests:
+		return "TooManyRequests"
+	case http.StatusNotFound:
+		return "NotAuthorizedOrNotFound"
+	case http.StatusServiceUnavailable:
+		return "ServiceUnavailable"
+	}
+
+	return "InternalServerError"
+}
+
+// Return an optional query parameter, nil if it isn't set
+func query(request *http.Request, name string) *string {
+	value := request.URL.Query().Get(name)
+	if value == "" {
+		return nil
+	}
+
+	return &value
+}
+
+// Return an optional integer query parameter, nil if it isn't set or invalid
+func queryInt(request *http.Request, name string) *int {
+	value, err := strconv.Atoi(request.URL.Query().Get(name))
+	if err != nil {
+		return nil
+	}
+
+	return &value
+}
+
+// Return an optional path parameter (E.g. {imageId})
+func path(request *http.Request, name string) *string {
+	value := request.PathValue(name)
+	return &value
+}
+
+// OCI REST endpoints of the operations oshiv calls, see the API version (E.g. 20160918) of each service's SDK client
+func (server *Server) routes(mux *http.ServeMux) {
+	backend := server.Backend
+
+	// Identity
+	server.handle(mux, "GET /20160918/tenancies/{tenancyId}", "GetTenancy", func(request *http.Request) (any, *string, error) {
+		response, err := backend.GetTenancy(request.Context(), identity.GetTenancyRequest{TenancyId: path(request, "tenancyId")})
+		return response.Tenancy, nil, err
+	})
+	server.handle(mux, "GET /20160918/tenancies/{tenancyId}/regionSubscriptions", "ListRegionSubscriptions", func(request *http.Request) (any, *string, error) {
+		response, err := backend.ListRegionSubscriptions(request.Context(), identity.ListRegionSubscriptionsRequest{TenancyId: path(request, "tenancyId")})
+		return response.Items, nil, err
+	})
+	server.handle(mux, "GET /20160918/compartments", "ListCompartments", func(request *http.Request) (any, *string, error) {
+		response, err := backend.ListCompartments(request.Context(), identity.ListCompartmentsRequest{
+			CompartmentId:          query(request, "compartmentId"),
+			CompartmentIdInSubtree: common.Bool(request.URL.Query().Get("compartmentIdInSubtree") == "true"),
+			LifecycleState:         identity.CompartmentLifecycleStateEnum(request.URL.Query().Get("lifecycleState")),
+			Page:                   query(request, "page"),
+			Limit:                  queryInt(request, "limit"),
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	server.handle(mux, "GET /20160918/policies", "ListPolicies", func(request *http.Request) (any, *string, error) {
+		response, err := backend.ListPolicies(request.Context(), identity.ListPoliciesRequest{
+			CompartmentId: query(request, "compartmentId"),
+			Page:          query(request, "page"),
+			Limit:         queryInt(request, "limit"),
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+
+	// Compute
+	server.handle(mux, "GET /20160918/instances", "ListInstances", func(request *http.Request) (any, *string, error) {
+		response, err := backend.ListInstances(request.Context(), core.ListInstancesRequest{
+			CompartmentId:  query(request, "compartmentId"),
+			LifecycleState: core.InstanceLifecycleStateEnum(request.URL.Query().Get("lifecycleState")),
+			Page:           query(request, "page"),
+			Limit:          queryInt(request, "limit"),
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	server.handle(mux, "GET /20160918/instances/{instanceId}", "GetInstance", func(request *http.Request) (any, *string, error) {
+		response, err := backend.GetInstance(request.Context(), core.GetInstanceRequest{InstanceId: path(request, "instanceId")})
+		return response.Instance, nil, err
+	})
+	server.handle(mux, "POST /20160918/instances/{instanceId}", "InstanceAction", func(request *http.Request) (any, *string, error) {
+		response, err := backend.InstanceAction(request.Context(), core.InstanceActionRequest{
+			InstanceId: path(request, "instanceId"),
+			Action:     core.InstanceActionActionEnum(request.URL.Query().Get("action")),
+		})
+		return response.Instance, nil, err
+	})
+	server.handle(mux, "GET /20160918/vnicAttachments", "ListVnicAttachments", func(request *http.Request) (any, *string, error) {
+		response, err := backend.ListVnicAttachments(request.Context(), core.ListVnicAttachmentsRequest{
+			CompartmentId: query(request, "compartmentId"),
+			InstanceId:    query(request, "instanceId"),
+			Page:          query(request, "page"),
+			Limit:         queryInt(request, "limit"),
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	server.handle(mux, "GET /20160918/images", "ListImages", func(request *http.Request) (any, *string, error) {
+		response, err := backend.ListImages(request.Context(), core.ListImagesRequest{
+			CompartmentId: query(request, "compartmentId"),
+			Page:          query(request, "page"),
+			Limit:         queryInt(request, "limit"),
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	server.handle(mux, "GET /20160918/images/{imageId}", "GetImage", func(request *http.Request) (any, *string, error) {
+		response, err := backend.GetImage(request.Context(), core.GetImageRequest{ImageId: path(request, "imageId")})
+		return response.Image, nil, err
+	})
+
+	// Virtual network
+	server.handle(mux, "GET /20160918/subnets", "ListSubnets", func(request *http.Request) (any, *string, error) {
+		response, err := backend.ListSubnets(request.Context(), core.ListSubnetsRequest{
+			CompartmentId: query(request, "compartmentId"),
+			VcnId:         query(request, "vcnId"),
+			Page:          query(request, "page"),
+			Limit:         queryInt(request, "limit"),
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	server.handle(mux, "GET /20160918/subnets/{subnetId}", "GetSubnet", func(request *http.Request) (any, *string, error) {
+		response, err := backend.GetSubnet(request.Context(), core.GetSubnetRequest{SubnetId: path(request, "subnetId")})
+		return response.Subnet, nil, err
+	})
+	server.handle(mux, "GET /20160918/vcns/{vcnId}", "GetVcn", func(request *http.Request) (any, *string, error) {
+		response, err := backend.GetVcn(request.Context(), core.GetVcnRequest{VcnId: path(request, "vcnId")})
+		return response.Vcn, nil, err
+	})
+	server.handle(mux, "GET /20160918/vnics/{vnicId}", "GetVnic", func(request *http.Request) (any, *string, error) {
+		response, err := backend.GetVnic(request.Context(), core.GetVnicRequest{VnicId: path(request, "vnicId")})
+		return response.Vnic, nil, err
+	})
+	server.handle(mux, "GET /20160918/privateIps", "ListPrivateIps", func(request *http.Request) (any, *string, error) {
+		response, err := backend.ListPrivateIps(request.Context(), core.ListPrivateIpsRequest{
+			SubnetId:  query(request, "subnetId"),
+			VnicId:    query(request, "vnicId"),
+			IpAddress: query(request, "ipAddress"),
+			Page:      query(request, "page"),
+			Limit:     queryInt(request, "limit"),
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+
+	// Container engine
+	server.handle(mux, "GET /20180222/clusters", "ListClusters", func(request *http.Request) (any, *string, error) {
+		response, err := backend.ListClusters(request.Context(), containerengine.ListClustersRequest{
+			CompartmentId: query(request, "compartmentId"),
+			Page:          query(request, "page"),
+			Limit:         queryInt(request, "limit"),
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+
+	// Database
+	server.handle(mux, "GET /20160918/autonomousDatabases", "ListAutonomousDatabases", func(request *http.Request) (any, *string, error) {
+		response, err := backend.ListAutonomousDatabases(request.Context(), database.ListAutonomousDatabasesRequest{
+			CompartmentId: query(request, "compartmentId"),
+			Page:          query(request, "page"),
+			Limit:         queryInt(request, "limit"),
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+
+	// Bastion
+	server.handle(mux, "GET /20210331/bastions", "ListBastions", func(request *http.Request) (any, *string, error) {
+		response, err := backend.ListBastions(request.Context(), bastion.ListBastionsRequest{
+			CompartmentId: query(request, "compartmentId"),
+			BastionId:     query(request, "bastionId"),
+			Name:          query(request, "name"),
+			Page:          query(request, "page"),
+			Limit:         queryInt(request, "limit"),
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	server.handle(mux, "GET /20210331/bastions/{bastionId}", "GetBastion", func(request *http.Request) (any, *string, error) {
+		response, err := backend.GetBastion(request.Context(), bastion.GetBastionRequest{BastionId: path(request, "bastionId")})
+		return response.Bastion, nil, err
+	})
+	server.handle(mux, "GET /20210331/sessions", "ListSessions", func(request *http.Request) (any, *string, error) {
+		response, err := backend.ListSessions(request.Context(), bastion.ListSessionsRequest{
+			BastionId:             query(request, "bastionId"),
+			SessionId:             query(request, "sessionId"),
+			DisplayName:           query(request, "displayName"),
+			SessionLifecycleState: bastion.ListSessionsSessionLifecycleStateEnum(request.URL.Query().Get("sessionLifecycleState")),
+			Page:                  query(request, "page"),
+			Limit:                 queryInt(request, "limit"),
+		})
+		return response.Items, response.OpcNextPage, err
+	})
+	server.handle(mux, "GET /20210331/sessions/{sessionId}", "GetSession", func(request *http.Request) (any, *string, error) {
+		response, err := backend.GetSession(request.Context(), bastion.GetSessionRequest{SessionId: path(request, "sessionId")})
+		return response.Session, nil, err
+	})
+	server.handle(mux, "POST /20210331/sessions", "CreateSession", func(request *http.Request) (any, *string, error) {
+		var details bastion.CreateSessionDetails
+		err := json.NewDecoder(request.Body).Decode(&details)
+		if err != nil {
+			return nil, nil, fake.ServiceError{StatusCode: http.StatusBadRequest, Code: "InvalidParameter", Message: err.Error()}
+		}
+
+		response, err := backend.CreateSession(request.Context(), bastion.CreateSessionRequest{CreateSessionDetails: details})
+		return response.Session, nil, err
+	})
+	server.handle(mux, "DELETE /20210331/sessions/{sessionId}", "DeleteSession", func(request *http.Request) (any, *string, error) {
+		_, err := backend.DeleteSession(request.Context(), bastion.DeleteSessionRequest{SessionId: path(request, "sessionId")})
+		return nil, nil, err
+	})
+}
@@ -0,0 +1,246 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Default time cached responses are used as is (--cache-ttl, OSHIV_CACHE_TTL)
+const DefaultCacheTTL = 5 * time.Minute
+
+// Cached responses older than this are never used, they are fetched again before the command continues
+const cacheMaxStale = 24 * time.Hour
+
+// Cached response of a list call
+type cacheEntry[T any] struct {
+	Time time.Time `json:"time"`
+	Data T         `json:"data"`
+}
+
+var cacheState struct {
+	sync.Mutex
+	backgroundRefresh bool          // Stale responses may be used (see EnableBackgroundRefresh)
+	staleAge          time.Duration // Age of the oldest stale response used, zero if none
+}
+
+// Return the cache directory, $XDG_CACHE_HOME/oshiv or $HOME/.cache/oshiv
+func CacheDir() string {
+	cacheHome, envVarExists := os.LookupEnv("XDG_CACHE_HOME")
+	if !envVarExists || cacheHome == "" {
+		cacheHome = filepath.Join(HomeDir(), ".cache")
+	}
+
+	return filepath.Join(cacheHome, "oshiv")
+}
+
+// Return the time cached responses are used as is
+func CacheTTL() time.Duration {
+	ttl := viper.GetDuration("cache-ttl")
+	if ttl < 0 {
+		return 0
+	}
+
+	return ttl
+}
+
+// Allow stale cached responses to be used, they are refreshed in the background after the command (see RefreshStaleCache)
+// Only enabled for commands that are safe to run again in the background (list and find commands)
+func EnableBackgroundRefresh() {
+	cacheState.Lock()
+	defer cacheState.Unlock()
+
+	cacheState.backgroundRefresh = true
+}
+
+// Return a cached response of a list call, or call fetch and cache its response
+// Responses are cached per tenancy, service endpoint (region), compartment (the subnet for private IPs), and resource type (E.g. instances)
+// Responses younger than the cache TTL are used as is, older ones are used and refreshed in the background if enabled (EnableBackgroundRefresh)
+// With refresh (or --refresh) fetch is always called and its response cached, E.g. when the caller needs current states
+// --no-cache always calls fetch without caching
+func Cached[T any](endpoint string, compartmentId string, resource string, refresh bool, fetch func() (T, error)) (T, error) {
+	if viper.GetBool("no-cache") {
+		return fetch()
+	}
+
+	cachePath := cacheFile(endpoint, compartmentId, resource)
+
+	if !refresh && !viper.GetBool("refresh") {
+		var entry cacheEntry[T]
+		if readCache(cachePath, &entry) {
+			age := time.Since(entry.Time)
+
+			if age < CacheTTL() {
+				Logger.Debug("Using cached " + resource + " from " + cachePath)
+				return entry.Data, nil
+			}
+
+			if age < cacheMaxStale && useStale(age) {
+				Logger.Debug("Using stale cached " + resource + " from " + cachePath)
+				return entry.Data, nil
+			}
+		}
+	}
+
+	data, err := fetch()
+	if err != nil {
+		return data, err
+	}
+
+	// The cache is an optimization, failing to write it doesn't fail the command
+	err = writeCache(cachePath, cacheEntry[T]{time.Now(), data})
+	if err != nil {
+		Logger.Debug("Unable to write cache file " + cachePath + ": " + err.Error())
+	}
+
+	return data, nil
+}
+
+// Record that a stale response is used, if stale responses may be used
+func useStale(age time.Duration) bool {
+	cacheState.Lock()
+	defer cacheState.Unlock()
+
+	if !cacheState.backgroundRefresh {
+		return false
+	}
+
+	if age > cacheState.staleAge {
+		cacheState.staleAge = age
+	}
+
+	return true
+}
+
+// Return the cache file of a response, E.g. ~/.cache/oshiv/TENANCY_ID/iaas.us-ashburn-1.oraclecloud.com/COMPARTMENT_ID/instances.json
+// The service endpoint host is part of the key since it identifies the region
+func cacheFile(endpoint string, compartmentId string, resource string) string {
+	host := endpoint
+	endpointUrl, err := url.Parse(endpoint)
+	if err == nil && endpointUrl.Host != "" {
+		host = endpointUrl.Host
+	}
+
+	// Note: ports (E.g. a local endpoint) are not valid in Windows file names
+	host = strings.ReplaceAll(host, ":", "_")
+
+	return filepath.Join(CacheDir(), viper.GetString("tenancy-id"), host, compartmentId, resource+".json")
+}
+
+// Read a cache file, false if it doesn't exist or can't be read (E.g. written by an older version)
+func readCache(cachePath string, entry any) bool {
+	cacheContent, err := os.ReadFile(cachePath)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			Logger.Debug("Unable to read cache file " + cachePath + ": " + err.Error())
+		}
+		return false
+	}
+
+	err = json.Unmarshal(cacheContent, entry)
+	if err != nil {
+		Logger.Debug("Unable to parse cache file " + cachePath + ": " + err.Error())
+		return false
+	}
+
+	return true
+}
+
+// Write a cache file, only readable by the user
+func writeCache(cachePath string, entry any) error {
+	cacheContent, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(cachePath), 0700)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it, concurrent commands never read a partially written cache file
+	tempFile, err := os.CreateTemp(filepath.Dir(cachePath), filepath.Base(cachePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = tempFile.Write(cacheContent)
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), cachePath)
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return err
+	}
+
+	return nil
+}
+
+// Refresh stale cached responses used by the command in the background
+// The command is run again with --refresh as a detached process, its output is discarded
+func RefreshStaleCache() {
+	cacheState.Lock()
+	staleAge := cacheState.staleAge
+	cacheState.Unlock()
+
+	if staleAge == 0 {
+		return
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		Logger.Debug("Unable to refresh cache: " + err.Error())
+		return
+	}
+
+	refreshCmd := exec.Command(executable, append(os.Args[1:], "--refresh")...)
+	detachProcess(refreshCmd)
+
+	err = refreshCmd.Start()
+	if err != nil {
+		Logger.Debug("Unable to refresh cache: " + err.Error())
+		return
+	}
+	refreshCmd.Process.Release()
+
+	Faint.Fprintf(os.Stderr, "Using cached results from %s ago, refreshing in the background (--refresh to wait for fresh results)\n", staleAge.Round(time.Second))
+}
+
+// Remove cached responses of resource types matching a glob (E.g. instances-*) in a compartment, after changing the resources
+func InvalidateCache(endpoint string, compartmentId string, resourcePattern string) {
+	cachePaths, err := filepath.Glob(cacheFile(endpoint, compartmentId, resourcePattern))
+	if err != nil {
+		Logger.Debug("Invalid cache pattern " + resourcePattern + ": " + err.Error())
+		return
+	}
+
+	for _, cachePath := range cachePaths {
+		err := os.Remove(cachePath)
+		if err != nil {
+			Logger.Debug("Unable to remove cache file " + cachePath + ": " + err.Error())
+		}
+	}
+}
+
+// Remove all cached responses
+func ClearCache() error {
+	err := os.RemoveAll(CacheDir())
+	if err != nil {
+		return fmt.Errorf("unable to clear cache %s: %w", CacheDir(), err)
+	}
+
+	return nil
+}
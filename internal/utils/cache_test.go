@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	testEndpoint      = "https://iaas.us-ashburn-1.oraclecloud.com"
+	testCompartmentId = "ocid1.compartment.oc1..test"
+)
+
+// Use a temporary cache directory and the cache settings of a command, reset after the test
+func setupCache(t *testing.T, ttl time.Duration, noCache bool, refresh bool) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	viper.Set("tenancy-id", "ocid1.tenancy.oc1..test")
+	viper.Set("cache-ttl", ttl)
+	viper.Set("no-cache", noCache)
+	viper.Set("refresh", refresh)
+	cacheState.backgroundRefresh = false
+	cacheState.staleAge = 0
+
+	t.Cleanup(func() {
+		for _, key := range []string{"tenancy-id", "cache-ttl", "no-cache", "refresh"} {
+			viper.Set(key, nil)
+		}
+		cacheState.backgroundRefresh = false
+		cacheState.staleAge = 0
+	})
+}
+
+func TestCacheFile(t *testing.T) {
+	setupCache(t, DefaultCacheTTL, false, false)
+
+	tests := []struct {
+		endpoint string
+		want     string // Relative to the tenancy cache directory
+	}{
+		{testEndpoint, "iaas.us-ashburn-1.oraclecloud.com/" + testCompartmentId + "/instances.json"},
+		// Ports aren't valid in Windows file names
+		{"http://127.0.0.1:8080", "127.0.0.1_8080/" + testCompartmentId + "/instances.json"},
+		{"iaas.us-phoenix-1.oraclecloud.com", "iaas.us-phoenix-1.oraclecloud.com/" + testCompartmentId + "/instances.json"},
+	}
+
+	for _, test := range tests {
+		want := filepath.Join(CacheDir(), "ocid1.tenancy.oc1..test", filepath.FromSlash(test.want))
+		if got := cacheFile(test.endpoint, testCompartmentId, "instances"); got != want {
+			t.Errorf("cacheFile(%q) = %s, want %s", test.endpoint, got, want)
+		}
+	}
+}
+
+func TestCached(t *testing.T) {
+	tests := []struct {
+		name              string
+		age               time.Duration // Age of the cached response, zero if none
+		backgroundRefresh bool
+		noCache           bool
+		refreshFlag       bool
+		refresh           bool
+		wantFetch         bool
+		wantStale         bool
+	}{
+		{"not cached", 0, false, false, false, false, true, false},
+		{"fresh", time.Minute, false, false, false, false, false, false},
+		{"expired", time.Hour, false, false, false, false, true, false},
+		{"stale with background refresh", time.Hour, true, false, false, false, false, true},
+		{"too stale with background refresh", 48 * time.Hour, true, false, false, false, true, false},
+		{"no-cache", time.Minute, false, true, false, false, true, false},
+		{"refresh flag", time.Minute, false, false, true, false, true, false},
+		{"refresh", time.Minute, false, false, false, true, true, false},
+		{"refresh with background refresh", time.Hour, true, false, false, true, true, false},
+	}
+
+	for _, test := range tests {
+		setupCache(t, DefaultCacheTTL, test.noCache, test.refreshFlag)
+		cacheState.backgroundRefresh = test.backgroundRefresh
+
+		cachePath := cacheFile(testEndpoint, testCompartmentId, "instances")
+		if test.age != 0 {
+			err := writeCache(cachePath, cacheEntry[string]{time.Now().Add(-test.age), "cached"})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := Cached(testEndpoint, testCompartmentId, "instances", test.refresh, func() (string, error) {
+			return "fetched", nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fetched := got == "fetched"; fetched != test.wantFetch {
+			t.Errorf("%s: fetched = %t, want %t", test.name, fetched, test.wantFetch)
+		}
+
+		if stale := cacheState.staleAge != 0; stale != test.wantStale {
+			t.Errorf("%s: stale response used = %t, want %t", test.name, stale, test.wantStale)
+		}
+
+		// Fetched responses are cached, except with no-cache
+		var entry cacheEntry[string]
+		cached := readCache(cachePath, &entry) && entry.Data == "fetched"
+		if wantCached := test.wantFetch && !test.noCache; cached != wantCached {
+			t.Errorf("%s: fetched response cached = %t, want %t", test.name, cached, wantCached)
+		}
+	}
+}
+
+func TestCachedInvalid(t *testing.T) {
+	setupCache(t, DefaultCacheTTL, false, false)
+
+	// E.g. written by an older version
+	cachePath := cacheFile(testEndpoint, testCompartmentId, "instances")
+	err := os.MkdirAll(filepath.Dir(cachePath), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(cachePath, []byte(`{"time":"2024-05-02T12:00:00Z","data":{"name":"web-1"}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Cached(testEndpoint, testCompartmentId, "instances", false, func() ([]string, error) {
+		return []string{"web-1"}, nil
+	})
+	if err != nil || len(got) != 1 {
+		t.Errorf("Cached = %v, %v, want the fetched response", got, err)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	tests := []struct {
+		ttl  time.Duration
+		want time.Duration
+	}{
+		{DefaultCacheTTL, DefaultCacheTTL},
+		{0, 0},
+		{-time.Minute, 0},
+	}
+
+	for _, test := range tests {
+		setupCache(t, test.ttl, false, false)
+
+		if got := CacheTTL(); got != test.want {
+			t.Errorf("CacheTTL() with cache-ttl %s = %s, want %s", test.ttl, got, test.want)
+		}
+	}
+}
+
+func TestInvalidateCache(t *testing.T) {
+	setupCache(t, DefaultCacheTTL, false, false)
+
+	resources := []string{"instances-running", "instances-all", "images"}
+	for _, resource := range resources {
+		err := writeCache(cacheFile(testEndpoint, testCompartmentId, resource), cacheEntry[string]{time.Now(), resource})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	InvalidateCache(testEndpoint, testCompartmentId, "instances-*")
+
+	for _, resource := range resources {
+		var entry cacheEntry[string]
+		cached := readCache(cacheFile(testEndpoint, testCompartmentId, resource), &entry)
+		if wantCached := resource == "images"; cached != wantCached {
+			t.Errorf("%s cached = %t, want %t", resource, cached, wantCached)
+		}
+	}
+}
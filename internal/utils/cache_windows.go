@@ -0,0 +1,16 @@
+//go:build windows
+
+package utils
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Windows DETACHED_PROCESS creation flag, not defined by syscall
+const detachedProcess = 0x00000008
+
+// Run the process without a console in its own process group, so it isn't interrupted when the console closes
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP}
+}
@@ -2,61 +2,59 @@ package utils
 
 import (
 	"context"
+	"fmt"
 
-	"github.com/oracle/oci-go-sdk/v65/common"
 	"github.com/oracle/oci-go-sdk/v65/identity"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 // Validate tenancy ID using the OCI API and lookup/return tenancy name
-func validateTenancyId(identityClient identity.IdentityClient, tenancyId string) string {
+func validateTenancyId(identityClient identity.IdentityClient, tenancyId string) (string, error) {
 	response, err := identityClient.GetTenancy(context.Background(), identity.GetTenancyRequest{TenancyId: &tenancyId})
-	CheckError(err)
+	if err != nil {
+		return "", fmt.Errorf("unable to get tenancy %s: %w", tenancyId, err)
+	}
 
 	Logger.Debug("Current tenancy", "response.Tenancy.Name", *response.Tenancy.Name)
 	tenancyName := *response.Tenancy.Name
-	return tenancyName
+	return tenancyName, nil
 }
 
-func SetTenancyConfig(FlagTenancyId *pflag.Flag, ociConfig common.ConfigurationProvider) {
+func SetTenancyConfig(FlagTenancyId *pflag.Flag, identityClient identity.IdentityClient) error {
 	// Add tenancy ID to Viper config
 	viper.BindPFlag("tenancy-id", FlagTenancyId)
 	// Determine tenancyId from Viper: 2)flag, 3)ENV, 4)file, 6) default
 	tenancyId := viper.GetString("tenancy-id")
 
 	// Validate tenancy and get tenancy name
-	identityClient, identityErr := identity.NewIdentityClientWithConfigurationProvider(ociConfig)
-	CheckError(identityErr)
-	tenancyName := validateTenancyId(identityClient, tenancyId)
+	tenancyName, err := validateTenancyId(identityClient, tenancyId)
+	if err != nil {
+		return err
+	}
+
 	viper.Set("tenancy-name", tenancyName)
+	return nil
 }
 
-func SetCompartmentConfig(FlagCompartment *pflag.Flag, compartments map[string]string, tenancyName string) {
+// Set compartment (name or path) in Viper config, the root compartment is used if compartmentExists rejects it
+// A compartment passed with the flag must exist, an error is returned instead of using the root compartment
+func SetCompartmentConfig(FlagCompartment *pflag.Flag, compartmentExists func(compartment string) bool, tenancyName string) error {
 	viper.BindPFlag("compartment", FlagCompartment)
 
 	// Determine compartment from Viper: 2)flag, 4)file
 	compartment := viper.GetString("compartment")
 
 	// Validate compartment
-	compartmentIsValid := validateCompartment(compartment, compartments)
+	if !compartmentExists(compartment) {
+		if FlagCompartment != nil && FlagCompartment.Changed {
+			return UsageError("compartment " + compartment + " not found in tenancy " + tenancyName)
+		}
 
-	if !compartmentIsValid {
 		// The compartment is not in the current tenant, use tenancy (root compartment)
-		// This occurs if compartment was set in a file (or flag) but Tenancy has changed
+		// This occurs if compartment was set in a file (or environment) but Tenancy has changed
 		viper.Set("compartment", tenancyName)
 	}
-}
-
-func validateCompartment(compartment string, compartments map[string]string) bool {
-	var compartmentIsValid bool = false
-
-	for valid_compartment := range compartments {
-		if compartment == valid_compartment {
-			compartmentIsValid = true
-			break
-		}
-	}
 
-	return compartmentIsValid
+	return nil
 }
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// Saved tenancy, compartment, region, profile, bastion, and SSH user (like kubectl contexts)
+// Values of the current context are used when not set by flag or environment variable
+type Context struct {
+	TenancyId   string `json:"tenancy_id,omitempty" yaml:"tenancy_id,omitempty"`
+	Compartment string `json:"compartment,omitempty" yaml:"compartment,omitempty"`
+	Region      string `json:"region,omitempty" yaml:"region,omitempty"`
+	Profile     string `json:"profile,omitempty" yaml:"profile,omitempty"`
+	Bastion     string `json:"bastion,omitempty" yaml:"bastion,omitempty"`
+	SshUser     string `json:"ssh_user,omitempty" yaml:"ssh_user,omitempty"`
+}
+
+// oshiv config file (ConfigFile)
+type Config struct {
+	CurrentContext string             `yaml:"current_context,omitempty"`
+	Contexts       map[string]Context `yaml:"contexts,omitempty"`
+}
+
+// Return the oshiv config file path, $XDG_CONFIG_HOME/oshiv/config.yaml or $HOME/.config/oshiv/config.yaml
+func ConfigFile() string {
+	configHome, envVarExists := os.LookupEnv("XDG_CONFIG_HOME")
+	if !envVarExists || configHome == "" {
+		configHome = filepath.Join(HomeDir(), ".config")
+	}
+
+	return filepath.Join(configHome, "oshiv", "config.yaml")
+}
+
+// Read the oshiv config file, an empty config if it doesn't exist yet
+func LoadConfig() (*Config, error) {
+	config := &Config{Contexts: make(map[string]Context)}
+
+	configPath := ConfigFile()
+	configFile, err := os.ReadFile(configPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return config, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read config file %s: %w", configPath, err)
+	}
+
+	err = yaml.Unmarshal(configFile, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %w", configPath, err)
+	}
+
+	if config.Contexts == nil {
+		config.Contexts = make(map[string]Context)
+	}
+
+	return config, nil
+}
+
+// Write the oshiv config file, only readable by the user
+func (config *Config) Save() error {
+	configPath := ConfigFile()
+
+	err := os.MkdirAll(filepath.Dir(configPath), 0700)
+	if err != nil {
+		return fmt.Errorf("unable to create config directory: %w", err)
+	}
+
+	configFile, err := yaml.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("unable to encode config: %w", err)
+	}
+
+	// Write to a temporary file and rename it, so an interrupted write never leaves a truncated config file
+	// The file name is unique, concurrent commands saving the config never write to the same temporary file
+	tempFile, err := os.CreateTemp(filepath.Dir(configPath), ".config-*.yaml")
+	if err != nil {
+		return fmt.Errorf("unable to write config file %s: %w", configPath, err)
+	}
+
+	_, err = tempFile.Write(configFile)
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), configPath)
+	}
+	if err != nil {
+		os.Remove(tempFile.Name())
+		return fmt.Errorf("unable to write config file %s: %w", configPath, err)
+	}
+
+	Logger.Debug("Wrote config file " + configPath)
+	return nil
+}
+
+// Add the current context's values to Viper config as config file values
+// Flags and environment variables take precedence over them, OCI config file values (Viper defaults) don't
+func UseCurrentContext() error {
+	config, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	if config.CurrentContext == "" {
+		return nil
+	}
+
+	context, found := config.Contexts[config.CurrentContext]
+	if !found {
+		return errors.New("current context " + config.CurrentContext + " not found in " + ConfigFile() + ", run 'oshiv context use' to select another")
+	}
+
+	Logger.Debug("Using context " + config.CurrentContext)
+
+	values := make(map[string]any)
+	for key, value := range map[string]string{
+		"tenancy-id":  context.TenancyId,
+		"compartment": context.Compartment,
+		"region":      context.Region,
+		"profile":     context.Profile,
+		"bastion":     context.Bastion,
+		"ssh-user":    context.SshUser,
+	} {
+		if value != "" {
+			values[key] = value
+		}
+	}
+
+	viper.Set("context", config.CurrentContext)
+	return viper.MergeConfigMap(values)
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestConfigSaveConcurrent(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	// Commands saving the config at the same time each write their own temporary file
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			name := "context-" + strconv.Itoa(i)
+			config := &Config{CurrentContext: name, Contexts: map[string]Context{name: {Compartment: "prod"}}}
+			errs[i] = config.Save()
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The last save wins, the config file is complete and only readable by the user
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := config.Contexts[config.CurrentContext]; !found || len(config.Contexts) != 1 {
+		t.Errorf("config = %+v, want the contexts of one save", config)
+	}
+
+	info, err := os.Stat(ConfigFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("config file mode = %o, want 600", mode)
+	}
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(filepath.Dir(ConfigFile()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("config directory = %v, want only config.yaml", names)
+	}
+}
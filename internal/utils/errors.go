@@ -1,7 +1,109 @@
 package utils
 
-func CheckError(err error) {
-	if err != nil {
-		panic(err)
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/fatih/color"
+	"github.com/oracle/oci-go-sdk/v65/common"
+)
+
+// Process exit codes, wrapper scripts can branch on these
+const (
+	ExitGeneral          = 1 // Any other error
+	ExitUsage            = 2 // Invalid flags or arguments
+	ExitNotAuthenticated = 3 // 401 NotAuthenticated (E.g. expired session token)
+	ExitNotFound         = 4 // 404 NotAuthorizedOrNotFound
+	ExitThrottled        = 5 // 429 TooManyRequests
+	ExitServiceError     = 6 // 5xx OCI service error
+)
+
+// Error with a specific exit code
+// An empty message means the error was already reported (E.g. a remote shell's exit status) and is only used for the exit code
+type ExitCodeError struct {
+	Code    int
+	Message string
+}
+
+func (err *ExitCodeError) Error() string { return err.Message }
+
+// Usage error (exit code 2), E.g. missing or conflicting flags
+func UsageError(message string) error {
+	return &ExitCodeError{ExitUsage, message}
+}
+
+// Exit with a status without printing anything else
+func ExitStatus(code int) error {
+	return &ExitCodeError{code, ""}
+}
+
+// Print an error with a hint for known OCI service errors and return the exit code for it
+func HandleError(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	var exitErr *ExitCodeError
+	if errors.As(err, &exitErr) {
+		if exitErr.Message != "" {
+			printError(err.Error(), "")
+		}
+		return exitErr.Code
+	}
+
+	var serviceErr common.ServiceError
+	if errors.As(err, &serviceErr) {
+		code, message, hint := describeServiceError(serviceErr)
+
+		Logger.Debug("OCI service error", "status", serviceErr.GetHTTPStatusCode(), "code", serviceErr.GetCode(), "opc-request-id", serviceErr.GetOpcRequestID(), "error", err.Error())
+		printError(message, hint)
+
+		if serviceErr.GetOpcRequestID() != "" {
+			color.New(color.Faint).Fprintln(os.Stderr, "opc-request-id: "+serviceErr.GetOpcRequestID())
+		}
+
+		return code
+	}
+
+	printError(err.Error(), "")
+	return ExitGeneral
+}
+
+// Map an OCI service error to an exit code, message, and hint
+func describeServiceError(serviceErr common.ServiceError) (int, string, string) {
+	status := serviceErr.GetHTTPStatusCode()
+	statusCode := strconv.Itoa(status) + " " + serviceErr.GetCode()
+
+	switch {
+	case status == 401:
+		return ExitNotAuthenticated,
+			"Not authenticated (" + statusCode + ")",
+			"If using a session token it may have expired, run `oci session refresh` (or `oci session authenticate`). Otherwise check the API key and fingerprint in your OCI config file"
+	case status == 404:
+		return ExitNotFound,
+			"Resource not found or not authorized (" + statusCode + "): " + serviceErr.GetMessage(),
+			"Check the tenancy (-t), compartment (-c), and OCIDs are correct, and that your IAM policies allow access"
+	case status == 429:
+		return ExitThrottled,
+			"Too many requests, OCI is still throttling API calls after retrying (" + statusCode + ")",
+			"Wait a minute and try again"
+	case status >= 500:
+		return ExitServiceError,
+			"OCI service error (" + statusCode + "): " + serviceErr.GetMessage(),
+			"This is usually temporary, try again later"
+	}
+
+	return ExitGeneral, "OCI request failed (" + statusCode + "): " + serviceErr.GetMessage(), ""
+}
+
+// Print an error (and hint) to stderr
+func printError(message string, hint string) {
+	color.New(color.FgRed).Fprint(os.Stderr, "Error: ")
+	fmt.Fprintln(os.Stderr, message)
+
+	if hint != "" {
+		color.New(color.Faint).Fprintln(os.Stderr, "Hint: "+hint)
 	}
 }
@@ -5,9 +5,12 @@ import (
 	"os"
 )
 
+// Returns an empty string if the home dir can't be determined ($HOME unset), paths based on it then fail when read
 func HomeDir() string {
 	homeDir, err := os.UserHomeDir()
-	CheckError(err)
+	if err != nil {
+		Logger.Debug("Unable to determine home dir: " + err.Error())
+	}
 
 	return homeDir
 }
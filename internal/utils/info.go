@@ -22,16 +22,20 @@ type OciTenancyEnvironment struct {
 
 var tenancyMapPath string = filepath.Join(HomeDir(), ".oci", "tenancy-map.yaml")
 
-func PrintTenancyMap() {
+func PrintTenancyMap() error {
 	var ociTenancyEnvironments []OciTenancyEnvironment
 	_, err_stat := os.Stat(tenancyMapPath)
 
 	if err_stat == nil {
 		yamlFile, err := os.ReadFile(tenancyMapPath)
-		CheckError(err)
+		if err != nil {
+			return err
+		}
 
 		err = yaml.Unmarshal(yamlFile, &ociTenancyEnvironments)
-		CheckError(err)
+		if err != nil {
+			return fmt.Errorf("unable to parse %s: %w", tenancyMapPath, err)
+		}
 
 		tbl := table.New("ENVIRONMENT", "TENANCY", "REALM", "COMPARTMENTS", "REGIONS")
 		tbl.WithHeaderFormatter(HeaderFmt).WithFirstColumnFormatter(ColumnFmt)
@@ -51,6 +55,8 @@ func PrintTenancyMap() {
 	} else {
 		fmt.Println("No tenancy info file found.")
 	}
+
+	return nil
 }
 
 func LookUpTenancyID(tenancyName string) (string, error) {
@@ -59,10 +65,14 @@ func LookUpTenancyID(tenancyName string) (string, error) {
 
 	if err_stat == nil {
 		yamlFile, err := os.ReadFile(tenancyMapPath)
-		CheckError(err)
+		if err != nil {
+			return "", err
+		}
 
 		err = yaml.Unmarshal(yamlFile, &ociTenancyEnvironments)
-		CheckError(err)
+		if err != nil {
+			return "", fmt.Errorf("unable to parse %s: %w", tenancyMapPath, err)
+		}
 
 		for _, env := range ociTenancyEnvironments {
 			if tenancyName == env.Tenancy {
@@ -70,7 +80,7 @@ func LookUpTenancyID(tenancyName string) (string, error) {
 			}
 		}
 
-		return "", errors.New("tenancy not found")
+		return "", errors.New("tenancy " + tenancyName + " not found in " + tenancyMapPath)
 	} else {
 		return "", errors.New("no tenancy info file found")
 	}
@@ -1,33 +1,72 @@
 package utils
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/common/auth"
+	"github.com/spf13/viper"
 )
 
-func OciConfig() common.ConfigurationProvider {
-	var config common.ConfigurationProvider
+// Authentication methods accepted by --auth and OCI_CLI_AUTH (same names as the OCI CLI)
+var AuthMethods = []string{"api_key", "security_token", "instance_principal", "resource_principal"}
+
+// Return an OCI configuration provider for the authentication method set by --auth or OCI_CLI_AUTH
+// Without either, the profile in the OCI config file is used as is (API key or session token)
+func OciConfig() (common.ConfigurationProvider, error) {
+	authMethod := OciAuth()
 	profile := OciProfile()
+	configPath := OciConfigFile()
+
+	Logger.Debug("OCI authentication", "auth", authMethod, "profile", profile, "config", configPath)
 
-	if profile == "DEFAULT" { // TODO: Do I actually need this? How is DefaultConfigProvider different
-		Logger.Debug("Using default profile")
-		config = common.DefaultConfigProvider()
-	} else {
-		Logger.Debug("Using profile " + profile)
-		configPath := HomeDir() + "/.oci/config"
-		config = common.CustomProfileConfigProvider(configPath, profile)
+	switch authMethod {
+	case "", "api_key":
+		return common.CustomProfileConfigProvider(configPath, profile), nil
+	case "security_token":
+		// Signs requests with the session token from `oci session authenticate`, refreshed when the token file changes
+		provider, err := common.ConfigurationProviderForSessionTokenWithProfile(configPath, profile, "")
+		if err != nil {
+			return nil, fmt.Errorf("unable to load session token profile %s from %s: %w", profile, configPath, err)
+		}
+		return provider, nil
+	case "instance_principal":
+		provider, err := auth.InstancePrincipalConfigurationProvider()
+		if err != nil {
+			return nil, fmt.Errorf("unable to authenticate as instance principal: %w", err)
+		}
+		return provider, nil
+	case "resource_principal":
+		provider, err := auth.ResourcePrincipalConfigurationProvider()
+		if err != nil {
+			return nil, fmt.Errorf("unable to authenticate as resource principal: %w", err)
+		}
+		return provider, nil
 	}
 
-	return config
+	return nil, UsageError("invalid authentication method " + authMethod + ", must be one of: " + strings.Join(AuthMethods, ", "))
+}
+
+// Return the authentication method set by --auth or OCI_CLI_AUTH, empty if neither is set
+func OciAuth() string {
+	return strings.ToLower(viper.GetString("auth"))
 }
 
+// Return the OCI config file profile set by --profile, OCI_CLI_PROFILE, or the current context, DEFAULT otherwise
 func OciProfile() string {
-	profile, envVarExists := os.LookupEnv("OCI_CLI_PROFILE")
+	return viper.GetString("profile")
+}
+
+// Return the OCI config file path, OCI_CLI_CONFIG_FILE (OCI CLI convention) or $HOME/.oci/config
+func OciConfigFile() string {
+	configPath, envVarExists := os.LookupEnv("OCI_CLI_CONFIG_FILE")
 
-	if envVarExists {
-		return profile
-	} else {
-		return "DEFAULT"
+	if envVarExists && configPath != "" {
+		return configPath
 	}
+
+	return filepath.Join(HomeDir(), ".oci", "config")
 }
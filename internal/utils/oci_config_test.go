@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Bind --auth and OCI_CLI_AUTH like the root command, the flag is set if flagAuth isn't empty
+func setupAuth(t *testing.T, flagAuth string, envAuth string) {
+	t.Setenv("OCI_CLI_AUTH", envAuth)
+
+	flags := pflag.NewFlagSet("oshiv", pflag.ContinueOnError)
+	flags.String("auth", "", "")
+	if flagAuth != "" {
+		flags.Set("auth", flagAuth)
+	}
+
+	viper.BindPFlag("auth", flags.Lookup("auth"))
+	viper.BindEnv("auth", "OCI_CLI_AUTH")
+
+	t.Cleanup(viper.Reset)
+}
+
+// Write an OCI config file with a DEFAULT profile and point OCI_CLI_CONFIG_FILE at it
+func writeOciConfig(t *testing.T) string {
+	t.Helper()
+
+	configPath := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(configPath, []byte("[DEFAULT]\ntenancy=ocid1.tenancy.oc1..test\nregion=us-ashburn-1\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("OCI_CLI_CONFIG_FILE", configPath)
+
+	return configPath
+}
+
+func TestOciAuth(t *testing.T) {
+	tests := []struct {
+		name     string
+		flagAuth string
+		envAuth  string
+		want     string
+	}{
+		{"default", "", "", ""},
+		{"flag", "security_token", "", "security_token"},
+		{"environment variable", "", "instance_principal", "instance_principal"},
+		{"flag takes precedence", "api_key", "resource_principal", "api_key"},
+		{"case insensitive", "SECURITY_TOKEN", "", "security_token"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupAuth(t, test.flagAuth, test.envAuth)
+
+			if got := OciAuth(); got != test.want {
+				t.Errorf("OciAuth() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestOciConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		flagAuth    string
+		envAuth     string
+		refreshable bool   // Session token providers are refreshable, API key providers aren't
+		wantError   string // Empty for a provider reading the OCI config file
+	}{
+		{"default", "", "", false, ""},
+		{"api key", "api_key", "", false, ""},
+		{"session token flag", "security_token", "", true, ""},
+		{"session token environment variable", "", "security_token", true, ""},
+		{"resource principal outside of a resource", "resource_principal", "", false, "unable to authenticate as resource principal"},
+		{"unknown flag value", "password", "", false, "invalid authentication method password"},
+		{"unknown environment variable value", "", "password", false, "invalid authentication method password"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writeOciConfig(t)
+			setupAuth(t, test.flagAuth, test.envAuth)
+			viper.Set("profile", "DEFAULT")
+			t.Setenv("OCI_RESOURCE_PRINCIPAL_VERSION", "")
+
+			provider, err := OciConfig()
+
+			if test.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantError) {
+					t.Fatalf("error = %v, want %q", err, test.wantError)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, refreshable := provider.(common.RefreshableConfigurationProvider)
+			if refreshable != test.refreshable {
+				t.Errorf("refreshable provider = %v, want %v", refreshable, test.refreshable)
+			}
+
+			// The provider reads the config file from OCI_CLI_CONFIG_FILE
+			tenancyId, err := provider.TenancyOCID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tenancyId != "ocid1.tenancy.oc1..test" {
+				t.Errorf("tenancy = %s, want ocid1.tenancy.oc1..test", tenancyId)
+			}
+		})
+	}
+}
+
+func TestOciConfigUnknownAuthIsUsageError(t *testing.T) {
+	setupAuth(t, "password", "")
+
+	_, err := OciConfig()
+
+	var exitErr *ExitCodeError
+	if !errors.As(err, &exitErr) || exitErr.Code != ExitUsage {
+		t.Errorf("error = %v, want usage error", err)
+	}
+}
+
+func TestOciConfigFile(t *testing.T) {
+	t.Run("environment variable", func(t *testing.T) {
+		configPath := writeOciConfig(t)
+
+		if got := OciConfigFile(); got != configPath {
+			t.Errorf("OciConfigFile() = %s, want %s", got, configPath)
+		}
+	})
+
+	t.Run("default", func(t *testing.T) {
+		t.Setenv("OCI_CLI_CONFIG_FILE", "")
+
+		want := filepath.Join(HomeDir(), ".oci", "config")
+		if got := OciConfigFile(); got != want {
+			t.Errorf("OciConfigFile() = %s, want %s", got, want)
+		}
+	})
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Output formats accepted by the global --output flag
+var OutputFormats = []string{"json", "yaml", "csv", "table", "wide", "go-template=TEMPLATE", "custom-columns=SPEC"}
+
+// Column of table, wide, and csv output
+type Column struct {
+	Header string
+	Wide   bool // Only included with --output wide or csv
+}
+
+// Value of the global --output flag, rejects unknown formats, invalid templates, and column specs when flags are parsed
+type OutputFlag string
+
+func (flag *OutputFlag) String() string { return string(*flag) }
+func (flag *OutputFlag) Type() string   { return "format" }
+
+func (flag *OutputFlag) Set(value string) error {
+	_, err := newPrinter(value)
+	if err != nil {
+		return err
+	}
+
+	*flag = OutputFlag(value)
+	return nil
+}
+
+// Return the output format set by --output (without a template or column spec), empty for the default (detailed text) output
+func OutputFormat() string {
+	format, _, _ := strings.Cut(viper.GetString("output"), "=")
+	return strings.ToLower(format)
+}
+
+// Check if output is meant for scripts (json, yaml, csv, go-template, custom-columns)
+// Informational messages (match counts, tenancy/compartment, hints) are not printed in this case so the output can be piped to jq etc
+func StructuredOutput() bool {
+	switch OutputFormat() {
+	case "", "table", "wide":
+		return false
+	}
+
+	return true
+}
+
+// Print the number of results, E.g. "3 matches" for find or "12 instances" for list
+// Not printed for structured output
+func PrintCount(count int, searchString string, resourceName string) {
+	if StructuredOutput() {
+		return
+	}
+
+	if searchString != "" {
+		Faint.Println(strconv.Itoa(count) + " matches")
+	} else {
+		Faint.Println(strconv.Itoa(count) + " " + resourceName)
+	}
+}
+
+// Render items in the format set by --output
+// Every list and find command routes its results through here, rows (one value per column) are used by table, wide, and csv
+func PrintOutput(items any, columns []Column, rows [][]string) error {
+	printer, err := newPrinter(viper.GetString("output"))
+	if err != nil {
+		return UsageError("invalid --output: " + err.Error())
+	}
+
+	return printer.Print(items, columns, rows)
+}
+
+// Select the printer for an --output value
+func newPrinter(output string) (Printer, error) {
+	format, argument, hasArgument := strings.Cut(output, "=")
+
+	switch strings.ToLower(format) {
+	case "json":
+		return jsonPrinter{}, nil
+	case "yaml":
+		return yamlPrinter{}, nil
+	case "csv":
+		return csvPrinter{}, nil
+	case "", "table":
+		return tablePrinter{wide: false}, nil
+	case "wide":
+		return tablePrinter{wide: true}, nil
+	case "go-template":
+		if !hasArgument || argument == "" {
+			return nil, errors.New("go-template requires a template, E.g. go-template='{{.name}}'")
+		}
+		return newTemplatePrinter(argument)
+	case "custom-columns":
+		if !hasArgument || argument == "" {
+			return nil, errors.New("custom-columns requires a column spec, E.g. custom-columns=NAME:.name,IP:.private_ip")
+		}
+		return newCustomColumnsPrinter(argument)
+	}
+
+	return nil, errors.New("must be one of: " + strings.Join(OutputFormats, ", "))
+}
@@ -0,0 +1,450 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/rodaine/table"
+	"gopkg.in/yaml.v2"
+)
+
+// Renders list and find results
+// items is a slice of resource structs (exported, json/yaml tagged fields), columns and rows are the tabular view of the same items
+type Printer interface {
+	Print(items any, columns []Column, rows [][]string) error
+}
+
+type jsonPrinter struct{}
+
+func (jsonPrinter) Print(items any, columns []Column, rows [][]string) error {
+	// Print empty results as [] rather than null
+	if value := reflect.ValueOf(items); value.Kind() == reflect.Slice && value.IsNil() {
+		items = []any{}
+	}
+
+	content, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(content))
+	return nil
+}
+
+type yamlPrinter struct{}
+
+func (yamlPrinter) Print(items any, columns []Column, rows [][]string) error {
+	content, err := yaml.Marshal(items)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(string(content))
+	return nil
+}
+
+type csvPrinter struct{}
+
+func (csvPrinter) Print(items any, columns []Column, rows [][]string) error {
+	writer := csv.NewWriter(os.Stdout)
+
+	headers := make([]string, len(columns))
+	for i, column := range columns {
+		headers[i] = column.Header
+	}
+	writer.Write(headers)
+
+	for _, row := range rows {
+		writer.Write(row)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+type tablePrinter struct {
+	wide bool // Include wide columns
+}
+
+func (printer tablePrinter) Print(items any, columns []Column, rows [][]string) error {
+	var included []int
+	var headers []interface{}
+	for i, column := range columns {
+		if !column.Wide || printer.wide {
+			included = append(included, i)
+			headers = append(headers, column.Header)
+		}
+	}
+
+	tbl := table.New(headers...)
+	tbl.WithHeaderFormatter(HeaderFmt).WithFirstColumnFormatter(ColumnFmt)
+
+	for _, row := range rows {
+		var values []interface{}
+		for _, i := range included {
+			values = append(values, row[i])
+		}
+		tbl.AddRow(values...)
+	}
+
+	tbl.Print()
+	return nil
+}
+
+// Executes a Go template once per item, fields are referenced by their json names like custom-columns (E.g. {{.name}} {{.private_ip}})
+type templatePrinter struct {
+	tmpl *template.Template
+}
+
+func newTemplatePrinter(text string) (Printer, error) {
+	// Unknown fields fail instead of printing <no value>
+	tmpl, err := template.New("output").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.New("invalid go-template: " + err.Error())
+	}
+
+	return templatePrinter{tmpl}, nil
+}
+
+func (printer templatePrinter) Print(items any, columns []Column, rows [][]string) error {
+	values, err := jsonItems(items)
+	if err != nil {
+		return err
+	}
+
+	fields := jsonFieldNames(itemType(items))
+
+	for _, value := range values {
+		// Fields omitted from the json representation when empty are still known fields, they print <no value>
+		if object, ok := value.(map[string]any); ok {
+			for _, field := range fields {
+				if _, found := object[field]; !found {
+					object[field] = nil
+				}
+			}
+		}
+
+		var output bytes.Buffer
+
+		err := printer.tmpl.Execute(&output, value)
+		if err != nil {
+			return UsageError("unable to execute go-template: " + err.Error() + " (fields: " + strings.Join(fields, ", ") + ")")
+		}
+
+		// One line per item unless the template ends the line itself
+		if !bytes.HasSuffix(output.Bytes(), []byte("\n")) {
+			output.WriteString("\n")
+		}
+
+		os.Stdout.Write(output.Bytes())
+	}
+
+	return nil
+}
+
+// Column of custom-columns output: a header and a JSONPath expression evaluated against the item's json fields
+type customColumn struct {
+	header string
+	path   []pathSegment
+}
+
+// Prints a table with user defined columns, E.g. custom-columns=NAME:.name,IP:.private_ip
+type customColumnsPrinter struct {
+	columns []customColumn
+}
+
+func newCustomColumnsPrinter(spec string) (Printer, error) {
+	var columns []customColumn
+
+	for _, columnSpec := range strings.Split(spec, ",") {
+		header, expression, found := strings.Cut(columnSpec, ":")
+		if !found || header == "" || expression == "" {
+			return nil, errors.New("invalid custom-columns spec " + columnSpec + ", expected HEADER:.field")
+		}
+
+		path, err := parsePath(expression)
+		if err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, customColumn{header, path})
+	}
+
+	return customColumnsPrinter{columns}, nil
+}
+
+func (printer customColumnsPrinter) Print(items any, columns []Column, rows [][]string) error {
+	// Paths must name fields of the items, a typo would otherwise print <none> for every item
+	for _, column := range printer.columns {
+		err := checkPath(itemType(items), column.path)
+		if err != nil {
+			return UsageError("invalid custom-columns column " + column.header + ": " + err.Error())
+		}
+	}
+
+	// Evaluate paths against the json representation so they match --output json
+	values, err := jsonItems(items)
+	if err != nil {
+		return err
+	}
+
+	var headers []interface{}
+	for _, column := range printer.columns {
+		headers = append(headers, column.header)
+	}
+
+	tbl := table.New(headers...)
+	tbl.WithHeaderFormatter(HeaderFmt).WithFirstColumnFormatter(ColumnFmt)
+
+	for _, value := range values {
+		var row []interface{}
+		for _, column := range printer.columns {
+			row = append(row, formatPathResults(evaluatePath(value, column.path)))
+		}
+		tbl.AddRow(row...)
+	}
+
+	tbl.Print()
+	return nil
+}
+
+// Return the json representation of each item (E.g. a map per struct), a value that isn't a slice is a single item
+func jsonItems(items any) ([]any, error) {
+	if value := reflect.ValueOf(items); value.Kind() != reflect.Slice {
+		items = []any{items}
+	}
+
+	content, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+
+	var values []any
+	err = json.Unmarshal(content, &values)
+	if err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
+
+// Return the type of the items, the element type of a slice, nil if unknown
+func itemType(items any) reflect.Type {
+	t := reflect.TypeOf(items)
+	if t != nil && t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+// Return the json names of a struct's fields, in order (none if t isn't a struct)
+func jsonFieldNames(t reflect.Type) []string {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		if name, ok := jsonFieldName(t.Field(i)); ok {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// Return the json name of a struct field, false if it isn't marshalled
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	if !field.IsExported() {
+		return "", false
+	}
+
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = field.Name
+	}
+
+	return name, true
+}
+
+// Check that a path only names json fields of t, map keys and values of interface type can't be checked
+func checkPath(t reflect.Type, path []pathSegment) error {
+	for _, segment := range path {
+		for t != nil && t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+
+		if t == nil || t.Kind() == reflect.Interface {
+			return nil
+		}
+
+		if segment.field != "" {
+			switch t.Kind() {
+			case reflect.Struct:
+				var fieldType reflect.Type
+				for i := 0; i < t.NumField(); i++ {
+					if name, ok := jsonFieldName(t.Field(i)); ok && name == segment.field {
+						fieldType = t.Field(i).Type
+					}
+				}
+
+				if fieldType == nil {
+					return errors.New("no field " + segment.field + ", must be one of: " + strings.Join(jsonFieldNames(t), ", "))
+				}
+				t = fieldType
+			case reflect.Map:
+				t = t.Elem()
+			default:
+				return errors.New("no field " + segment.field + ", the value is not an object")
+			}
+		}
+
+		if segment.indexed || segment.wildcard {
+			for t.Kind() == reflect.Pointer {
+				t = t.Elem()
+			}
+
+			switch t.Kind() {
+			case reflect.Slice, reflect.Array:
+				t = t.Elem()
+			case reflect.Interface:
+				return nil
+			default:
+				return errors.New("unable to index " + segment.field + ", the value is not a list")
+			}
+		}
+	}
+
+	return nil
+}
+
+// Field of a JSONPath expression, optionally indexed: .name, .tags[0], .statements[*]
+type pathSegment struct {
+	field    string
+	index    int
+	indexed  bool
+	wildcard bool
+}
+
+// Parse the JSONPath subset used by custom-columns: dot separated fields with optional [N] or [*] index
+// Surrounding braces are optional ({.name} and .name are equivalent)
+func parsePath(expression string) ([]pathSegment, error) {
+	path := strings.TrimSuffix(strings.TrimPrefix(expression, "{"), "}")
+	if !strings.HasPrefix(path, ".") {
+		return nil, errors.New("invalid path " + expression + ", must start with .")
+	}
+
+	var segments []pathSegment
+
+	for _, part := range strings.Split(path[1:], ".") {
+		var segment pathSegment
+
+		field, index, found := strings.Cut(part, "[")
+		segment.field = field
+
+		if found {
+			index = strings.TrimSuffix(index, "]")
+
+			if index == "*" {
+				segment.wildcard = true
+			} else {
+				i, err := strconv.Atoi(index)
+				if err != nil {
+					return nil, errors.New("invalid index in path " + expression)
+				}
+				segment.index = i
+				segment.indexed = true
+			}
+		}
+
+		if segment.field == "" && !found && len(segments) > 0 {
+			return nil, errors.New("invalid path " + expression)
+		}
+
+		segments = append(segments, segment)
+	}
+
+	return segments, nil
+}
+
+// Evaluate a parsed path against a json value, wildcards can produce multiple results
+func evaluatePath(value any, path []pathSegment) []any {
+	results := []any{value}
+
+	for _, segment := range path {
+		var next []any
+
+		for _, result := range results {
+			if segment.field != "" {
+				object, ok := result.(map[string]any)
+				if !ok {
+					continue
+				}
+
+				result, ok = object[segment.field]
+				if !ok {
+					continue
+				}
+			}
+
+			list, isList := result.([]any)
+			switch {
+			case segment.wildcard && isList:
+				next = append(next, list...)
+			case segment.indexed && isList:
+				if segment.index >= 0 && segment.index < len(list) {
+					next = append(next, list[segment.index])
+				}
+			case !segment.wildcard && !segment.indexed:
+				next = append(next, result)
+			}
+		}
+
+		results = next
+	}
+
+	return results
+}
+
+// Format path results for a table cell, kubectl style <none> if the path didn't match
+func formatPathResults(results []any) string {
+	var values []string
+
+	for _, result := range results {
+		switch value := result.(type) {
+		case nil:
+			continue
+		case string:
+			values = append(values, value)
+		case float64:
+			values = append(values, strconv.FormatFloat(value, 'f', -1, 64))
+		case bool:
+			values = append(values, strconv.FormatBool(value))
+		default:
+			content, _ := json.Marshal(value)
+			values = append(values, string(content))
+		}
+	}
+
+	if len(values) == 0 {
+		return "<none>"
+	}
+
+	return strings.Join(values, ",")
+}
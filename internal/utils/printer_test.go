@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Resource struct like the ones printed by the resources package
+type testItem struct {
+	Name        string            `json:"name"`
+	Ip          string            `json:"private_ip"`
+	Statements  []string          `json:"statements"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Created     time.Time         `json:"time_created"`
+	Image       *testImage        `json:"image,omitempty"`
+	Compartment string            `json:"compartment,omitempty"`
+	internal    string
+}
+
+type testImage struct {
+	Name string `json:"name"`
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       []pathSegment
+		wantErr    bool
+	}{
+		{".name", []pathSegment{{field: "name"}}, false},
+		{"{.name}", []pathSegment{{field: "name"}}, false},
+		{".image.name", []pathSegment{{field: "image"}, {field: "name"}}, false},
+		{".statements[1]", []pathSegment{{field: "statements", index: 1, indexed: true}}, false},
+		{".statements[*]", []pathSegment{{field: "statements", wildcard: true}}, false},
+		{".", []pathSegment{{}}, false},
+		{"name", nil, true},
+		{".statements[first]", nil, true},
+		{".image..name", nil, true},
+	}
+
+	for _, test := range tests {
+		path, err := parsePath(test.expression)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parsePath(%q) = %+v, want an error", test.expression, path)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parsePath(%q) error: %v", test.expression, err)
+		} else if !reflect.DeepEqual(path, test.want) {
+			t.Errorf("parsePath(%q) = %+v, want %+v", test.expression, path, test.want)
+		}
+	}
+}
+
+func TestEvaluatePath(t *testing.T) {
+	// json representation of an item (see jsonItems)
+	value := map[string]any{
+		"name":       "web-1",
+		"statements": []any{"allow a", "allow b"},
+		"image":      map[string]any{"name": "Oracle-Linux-9"},
+		"tags":       nil,
+	}
+
+	tests := []struct {
+		expression string
+		want       []any
+	}{
+		{".name", []any{"web-1"}},
+		{".image.name", []any{"Oracle-Linux-9"}},
+		{".statements[1]", []any{"allow b"}},
+		{".statements[*]", []any{"allow a", "allow b"}},
+		{".statements[5]", nil},
+		{".name[0]", nil},
+		{".missing", nil},
+		{".tags", []any{nil}},
+	}
+
+	for _, test := range tests {
+		path, err := parsePath(test.expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if results := evaluatePath(value, path); !reflect.DeepEqual(results, test.want) {
+			t.Errorf("evaluatePath(%q) = %#v, want %#v", test.expression, results, test.want)
+		}
+	}
+}
+
+func TestFormatPathResults(t *testing.T) {
+	tests := []struct {
+		results []any
+		want    string
+	}{
+		{nil, "<none>"},
+		{[]any{nil}, "<none>"},
+		{[]any{"web-1"}, "web-1"},
+		{[]any{"allow a", "allow b"}, "allow a,allow b"},
+		{[]any{float64(16)}, "16"},
+		{[]any{2.5}, "2.5"},
+		{[]any{true}, "true"},
+		{[]any{map[string]any{"team": "web"}}, `{"team":"web"}`},
+	}
+
+	for _, test := range tests {
+		if got := formatPathResults(test.results); got != test.want {
+			t.Errorf("formatPathResults(%#v) = %q, want %q", test.results, got, test.want)
+		}
+	}
+}
+
+func TestCheckPath(t *testing.T) {
+	tests := []struct {
+		expression string
+		wantErr    string
+	}{
+		{".name", ""},
+		{".private_ip", ""},
+		{".statements[0]", ""},
+		{".tags.team", ""},
+		{".image.name", ""},
+		{".compartment", ""},
+		{".time_created", ""},
+		{".ip", "no field ip, must be one of: name, private_ip, statements, tags, time_created, image, compartment"},
+		{".Name", "no field Name"},
+		{".internal", "no field internal"},
+		{".image.id", "no field id, must be one of: name"},
+		{".name[0]", "unable to index name, the value is not a list"},
+		{".name.first", "no field first, the value is not an object"},
+	}
+
+	for _, test := range tests {
+		path, err := parsePath(test.expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = checkPath(itemType([]testItem{}), path)
+		if test.wantErr == "" && err != nil {
+			t.Errorf("checkPath(%q) error: %v", test.expression, err)
+		} else if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("checkPath(%q) = %v, want %q", test.expression, err, test.wantErr)
+		}
+	}
+}
+
+func TestPrinterUnknownFields(t *testing.T) {
+	items := []testItem{{Name: "web-1", Ip: "10.0.1.10"}}
+
+	tests := []struct {
+		output  string
+		wantErr string
+	}{
+		// Go field names and misspelled json names are errors, not empty values
+		{"go-template={{.Name}}", `map has no entry for key "Name"`},
+		{"go-template={{.name}} {{.ip}}", `map has no entry for key "ip"`},
+		{"custom-columns=NAME:.name,IP:.ip", "invalid custom-columns column IP: no field ip"},
+	}
+
+	for _, test := range tests {
+		printer, err := newPrinter(test.output)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = printer.Print(items, nil, nil)
+
+		var exitErr *ExitCodeError
+		if !errors.As(err, &exitErr) || exitErr.Code != ExitUsage || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%s error = %v, want usage error %q", test.output, err, test.wantErr)
+		}
+	}
+}
+
+func TestPrinterFormatHints(t *testing.T) {
+	items := []testItem{{Name: "web-1", Ip: "10.0.1.10"}}
+
+	// The example in the error of a format without an argument must work when copied
+	for _, output := range []string{"go-template", "custom-columns="} {
+		_, err := newPrinter(output)
+		if err == nil {
+			t.Fatalf("%s: want an error", output)
+		}
+
+		_, example, found := strings.Cut(err.Error(), "E.g. ")
+		if !found {
+			t.Fatalf("%s: error %q has no example", output, err)
+		}
+
+		printer, err := newPrinter(strings.ReplaceAll(example, "'", ""))
+		if err != nil {
+			t.Fatalf("%s: example %s: %v", output, example, err)
+		}
+
+		if err := printer.Print(items, nil, nil); err != nil {
+			t.Errorf("%s: example %s: %v", output, example, err)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Ask a yes/no question on stderr and read the answer from stdin, anything but y or yes (E.g. no input) is no
+func Confirm(question string) bool {
+	fmt.Fprint(os.Stderr, question+" [y/N] ")
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(os.Stderr)
+		return false
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+)
+
+// OCI requests are shared by all clients (and regions), so concurrent fetches can't exceed OCI API rate limits together
+const (
+	maxConcurrentRequests = 16   // Requests in flight at the same time
+	requestsPerSecond     = 10.0 // Sustained request rate (token bucket rate)
+	requestBurst          = 20.0 // Requests allowed at once before the rate applies (token bucket size)
+)
+
+// Retries of throttled (429) and unavailable (5xx) requests
+const (
+	maxRequestAttempts = 6
+	minRetryBackoff    = 500 * time.Millisecond
+	maxRetryBackoff    = 30 * time.Second
+)
+
+var requestSlots = make(chan struct{}, maxConcurrentRequests)
+
+var requestTokens = &tokenBucket{rate: requestsPerSecond, burst: requestBurst, tokens: requestBurst, last: time.Now()}
+
+var throttledNotice sync.Once
+
+// Token bucket rate limiter, tokens are added at rate per second up to burst
+type tokenBucket struct {
+	sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// Take a token, waiting until one is available
+// Tokens are reserved in order, so waiting requests don't all wake up for the same token
+func (bucket *tokenBucket) wait(ctx context.Context) error {
+	bucket.Lock()
+	now := time.Now()
+	bucket.tokens = min(bucket.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*bucket.rate)
+	bucket.last = now
+	bucket.tokens--
+	wait := time.Duration(-bucket.tokens / bucket.rate * float64(time.Second))
+	bucket.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// HTTP dispatcher sending requests through the shared request pool
+type pooledDispatcher struct {
+	dispatcher common.HTTPRequestDispatcher
+}
+
+func (pool pooledDispatcher) Do(request *http.Request) (*http.Response, error) {
+	// Requests cancelled (E.g. timed out) while waiting for a slot give up their place
+	select {
+	case requestSlots <- struct{}{}:
+	case <-request.Context().Done():
+		return nil, request.Context().Err()
+	}
+	defer func() { <-requestSlots }()
+
+	err := requestTokens.wait(request.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	return pool.dispatcher.Do(request)
+}
+
+// Send a client's requests through the shared request pool and retry throttled requests
+// Every OCI client is expected to be configured with this once created
+func UseRequestPool(client *common.BaseClient) {
+	client.HTTPClient = pooledDispatcher{client.HTTPClient}
+
+	// Note: not NewRetryPolicyWithOptions, its eventual consistency handling replaces shouldRetryRequest and retryBackoff with the SDK defaults
+	retryPolicy := common.NewRetryPolicy(maxRequestAttempts, shouldRetryRequest, retryBackoff)
+	client.Configuration.RetryPolicy = &retryPolicy
+}
+
+// Retry throttled requests (429), and reads (GET) the service was unable to handle (5xx)
+func shouldRetryRequest(response common.OCIOperationResponse) bool {
+	serviceErr, ok := common.IsServiceError(response.Error)
+	if !ok {
+		return false
+	}
+
+	statusCode := serviceErr.GetHTTPStatusCode()
+	if statusCode == http.StatusTooManyRequests {
+		throttledNotice.Do(func() {
+			fmt.Fprintln(os.Stderr, "Throttled by OCI, retrying requests with backoff...")
+		})
+		return true
+	}
+
+	httpResponse := operationHttpResponse(response)
+	isRead := httpResponse != nil && httpResponse.Request != nil && httpResponse.Request.Method == http.MethodGet
+
+	return isRead && (statusCode == http.StatusInternalServerError || statusCode == http.StatusBadGateway || statusCode == http.StatusServiceUnavailable || statusCode == http.StatusGatewayTimeout)
+}
+
+// Exponential backoff with jitter, at least the time asked for by the Retry-After header
+func retryBackoff(response common.OCIOperationResponse) time.Duration {
+	backoff := minRetryBackoff << (response.AttemptNumber - 1)
+	if backoff > maxRetryBackoff || backoff <= 0 {
+		backoff = maxRetryBackoff
+	}
+
+	// Equal jitter: half the backoff plus a random part of the other half, so concurrent retries spread out
+	backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+
+	if httpResponse := operationHttpResponse(response); httpResponse != nil {
+		retryAfter := parseRetryAfter(httpResponse.Header.Get("Retry-After"))
+		if retryAfter > backoff {
+			backoff = retryAfter
+		}
+	}
+
+	Logger.Debug("Retrying request", "attempt", response.AttemptNumber, "backoff", backoff.String())
+	return backoff
+}
+
+// Parse a Retry-After header, in seconds or an HTTP date, zero if missing or invalid
+func parseRetryAfter(retryAfter string) time.Duration {
+	if retryAfter == "" {
+		return 0
+	}
+
+	seconds, err := strconv.Atoi(retryAfter)
+	if err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	retryTime, err := http.ParseTime(retryAfter)
+	if err == nil {
+		return time.Until(retryTime)
+	}
+
+	return 0
+}
+
+// Return the HTTP response of an operation, nil if there isn't one (E.g. network error)
+func operationHttpResponse(response common.OCIOperationResponse) *http.Response {
+	if response.Response == nil {
+		return nil
+	}
+
+	return response.Response.HTTPResponse()
+}
+
+// Call fn for each index from 0 to count concurrently, on at most maxConcurrentRequests workers
+// Return the first error by index, after all calls completed
+func ForEach(count int, fn func(i int) error) error {
+	errs := make([]error, count)
+	indexes := make(chan int)
+
+	workers := min(count, maxConcurrentRequests)
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				errs[i] = fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
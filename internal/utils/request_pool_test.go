@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/oracle/oci-go-sdk/v65/common"
+)
+
+// Service error returned by OCI, see common.ServiceError
+type testServiceError struct {
+	statusCode int
+}
+
+func (err testServiceError) Error() string           { return http.StatusText(err.statusCode) }
+func (err testServiceError) GetHTTPStatusCode() int  { return err.statusCode }
+func (err testServiceError) GetMessage() string      { return http.StatusText(err.statusCode) }
+func (err testServiceError) GetCode() string         { return "" }
+func (err testServiceError) GetOpcRequestID() string { return "" }
+
+// Operation response carrying the raw HTTP response, see common.OCIResponse
+type testResponse struct {
+	response *http.Response
+}
+
+func (response testResponse) HTTPResponse() *http.Response { return response.response }
+
+// Return the response of an operation that failed with a status code
+func operationResponse(method string, statusCode int, retryAfter string, attempt uint) common.OCIOperationResponse {
+	httpResponse := &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{},
+		Request:    &http.Request{Method: method},
+	}
+	if retryAfter != "" {
+		httpResponse.Header.Set("Retry-After", retryAfter)
+	}
+
+	return common.NewOCIOperationResponse(testResponse{httpResponse}, testServiceError{statusCode}, attempt)
+}
+
+func TestShouldRetryRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		response common.OCIOperationResponse
+		want     bool
+	}{
+		{"throttled read", operationResponse(http.MethodGet, 429, "", 1), true},
+		{"throttled write", operationResponse(http.MethodPost, 429, "", 1), true},
+		{"unavailable read", operationResponse(http.MethodGet, 503, "", 1), true},
+		{"server error read", operationResponse(http.MethodGet, 500, "", 1), true},
+		{"gateway timeout read", operationResponse(http.MethodGet, 504, "", 1), true},
+		{"unavailable write", operationResponse(http.MethodPost, 503, "", 1), false},
+		{"not implemented read", operationResponse(http.MethodGet, 501, "", 1), false},
+		{"not found", operationResponse(http.MethodGet, 404, "", 1), false},
+		{"unauthorized", operationResponse(http.MethodGet, 401, "", 1), false},
+		{"network error", common.NewOCIOperationResponse(nil, errors.New("connection reset"), 1), false},
+		{"success", common.NewOCIOperationResponse(nil, nil, 1), false},
+		{"unavailable without response", common.NewOCIOperationResponse(nil, testServiceError{503}, 1), false},
+	}
+
+	for _, test := range tests {
+		if got := shouldRetryRequest(test.response); got != test.want {
+			t.Errorf("%s: shouldRetryRequest = %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		retryAfter string
+		min, max   time.Duration
+	}{
+		{"", 0, 0},
+		{"5", 5 * time.Second, 5 * time.Second},
+		{"0", 0, 0},
+		{"soon", 0, 0},
+		{time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), 8 * time.Second, 10 * time.Second},
+		{time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), -2 * time.Minute, 0},
+	}
+
+	for _, test := range tests {
+		if got := parseRetryAfter(test.retryAfter); got < test.min || got > test.max {
+			t.Errorf("parseRetryAfter(%q) = %s, want between %s and %s", test.retryAfter, got, test.min, test.max)
+		}
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempt    uint
+		retryAfter string
+		min, max   time.Duration
+	}{
+		{1, "", minRetryBackoff / 2, minRetryBackoff},
+		{2, "", minRetryBackoff, 2 * minRetryBackoff},
+		{4, "", 4 * minRetryBackoff, 8 * minRetryBackoff},
+		// Capped, also when the shift overflows
+		{10, "", maxRetryBackoff / 2, maxRetryBackoff},
+		{100, "", maxRetryBackoff / 2, maxRetryBackoff},
+		// Retry-After wins when it's longer than the backoff, not when it's shorter
+		{1, "45", 45 * time.Second, 45 * time.Second},
+		{4, "1", 4 * minRetryBackoff, 8 * minRetryBackoff},
+	}
+
+	for _, test := range tests {
+		// Jitter is random, every result must be in bounds
+		for i := 0; i < 100; i++ {
+			got := retryBackoff(operationResponse(http.MethodGet, 429, test.retryAfter, test.attempt))
+			if got < test.min || got > test.max {
+				t.Fatalf("retryBackoff(attempt %d, Retry-After %q) = %s, want between %s and %s", test.attempt, test.retryAfter, got, test.min, test.max)
+			}
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		ctx     context.Context
+		wantErr bool
+		want    float64 // Tokens left
+	}{
+		{"token available", 2, 0, context.Background(), false, 1},
+		{"refilled", 0, 100 * time.Millisecond, context.Background(), false, 0},
+		{"refill capped at burst", 0, time.Hour, context.Background(), false, 1},
+		// The token stays reserved, the next request waits longer
+		{"cancelled while waiting", 0, 0, cancelled, true, -1},
+		{"available while cancelled", 1, 0, cancelled, false, 0},
+	}
+
+	for _, test := range tests {
+		bucket := &tokenBucket{rate: 10, burst: 2, tokens: test.tokens, last: time.Now().Add(-test.elapsed)}
+
+		err := bucket.wait(test.ctx)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error = %v, want error %t", test.name, err, test.wantErr)
+		}
+
+		// Allow for the time passed since last
+		if bucket.tokens < test.want || bucket.tokens > test.want+0.1 {
+			t.Errorf("%s: tokens = %.2f, want %.2f", test.name, bucket.tokens, test.want)
+		}
+	}
+}
+
+func TestTokenBucketRate(t *testing.T) {
+	bucket := &tokenBucket{rate: 50, burst: 1, tokens: 1, last: time.Now()}
+
+	// The burst is taken at once, the following tokens at the rate
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := bucket.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Errorf("3 tokens took %s, want about 40ms", elapsed)
+	}
+}
+
+func TestPooledDispatcherCancelled(t *testing.T) {
+	// Fill every slot, as if maxConcurrentRequests requests were in flight
+	for i := 0; i < maxConcurrentRequests; i++ {
+		requestSlots <- struct{}{}
+	}
+	defer func() {
+		for i := 0; i < maxConcurrentRequests; i++ {
+			<-requestSlots
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = pooledDispatcher{http.DefaultClient}.Do(request)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}